@@ -0,0 +1,57 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"ciascrape/pkg/anythingllm"
+)
+
+// ask puts the question given as arguments to the workspace and prints the answer with the reading room
+// documents it cites.
+func ask(cfg *Config) error {
+	question := strings.TrimSpace(strings.Join(args(), " "))
+	if question == "" {
+		return errors.New("missing question, usage: ask \"...\"")
+	}
+	return askTo(os.Stdout, cfg, question)
+}
+
+func askTo(w io.Writer, cfg *Config, question string) error {
+	var (
+		res *anythingllm.ChatResponse
+		err error
+	)
+	if cfg.Stream {
+		res, err = cfg.AnythingLLM.StreamChat(cfg.ChatMode, question, func(text string) {
+			_, _ = fmt.Fprint(w, text)
+		})
+	} else {
+		switch cfg.ChatMode {
+		case anythingllm.ChatModeChat:
+			res, err = cfg.AnythingLLM.Chat(question)
+		case anythingllm.ChatModeQuery:
+			res, err = cfg.AnythingLLM.Query(question)
+		default:
+			err = fmt.Errorf("%w: '%s'", anythingllm.ErrInvalidChatMode, cfg.ChatMode)
+		}
+		if err == nil {
+			_, _ = fmt.Fprint(w, res.TextResponse)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	_, _ = fmt.Fprintln(w)
+
+	if links := res.Links(); len(links) > 0 {
+		_, _ = fmt.Fprintln(w, "\nSources:")
+		for _, link := range links {
+			_, _ = fmt.Fprintf(w, "  %s\n", link)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"ciascrape/pkg/anythingllm"
+)
+
+func TestAsk_PrintsAnswerAndSources(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		source := `{"title": "CIA-RDP96-00788R001200410003-2.pdf", "url": "file:///docs/CIA-RDP96-00788R001200410003-2.pdf", "chunkSource": "link://https://www.cia.gov/readingroom/docs/CIA-RDP96-00788R001200410003-2.pdf"}`
+		switch r.URL.Path {
+		case "/v1/workspace/stargate/chat":
+			_, _ = w.Write([]byte(`{"id": "1", "type": "textResponse", "textResponse": "Remote viewing.", "sources": [` + source + `], "close": true, "error": null}`))
+		case "/v1/workspace/stargate/stream-chat":
+			_, _ = w.Write([]byte(`data: {"id": "1", "type": "textResponseChunk", "textResponse": "Remote ", "close": false, "error": false}` + "\n\n"))
+			_, _ = w.Write([]byte(`data: {"id": "1", "type": "textResponseChunk", "textResponse": "viewing.", "sources": [` + source + `], "close": true, "error": false}` + "\n\n"))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	anythingLLM := anythingllm.NewConfig().WithEndpoint(server.URL + "/").WithWorkspace("stargate")
+	for _, stream := range []bool{false, true} {
+		cfg := NewConfig("").WithAnythingLLM(anythingLLM).WithChat(anythingllm.ChatModeQuery, stream)
+		out := &bytes.Buffer{}
+		if err := askTo(out, cfg, "what is stargate?"); err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(out.String(), "Remote viewing.\n") {
+			t.Errorf("unexpected answer (stream %v): %q", stream, out.String())
+		}
+		if !strings.Contains(out.String(), "readingroom/docs/CIA-RDP96-00788R001200410003-2.pdf") {
+			t.Errorf("missing source (stream %v): %q", stream, out.String())
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"ciascrape/pkg/cia"
+)
+
+const defaultCommand = "scrape"
+
+type command func(cfg *Config) error
+
+var commands = map[string]command{
+	"scrape":      scrape,
+	"collections": collections,
+	"mirror":      mirror,
+	"ask":         ask,
+	"purge":       purge,
+}
+
+// commandArgs are the arguments given right after the sub-command, before any flags.
+var commandArgs []string
+
+// commandFromArgs removes the leading sub-command and its arguments from os.Args, if any,
+// so the remaining flags can be parsed.
+func commandFromArgs() string {
+	if len(os.Args) < 2 || strings.HasPrefix(os.Args[1], "-") {
+		return defaultCommand
+	}
+	name := os.Args[1]
+	rest := os.Args[2:]
+	for len(rest) > 0 && !strings.HasPrefix(rest[0], "-") {
+		commandArgs = append(commandArgs, rest[0])
+		rest = rest[1:]
+	}
+	os.Args = append(os.Args[:1], rest...)
+	return name
+}
+
+// args returns the positional arguments of the sub-command, whether given before or after the flags.
+func args() []string {
+	return append(append([]string(nil), commandArgs...), flag.Args()...)
+}
+
+func usage() {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	_, _ = fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [%s] [args] [flags]\n", os.Args[0], strings.Join(names, "|"))
+	flag.PrintDefaults()
+}
+
+func scrape(cfg *Config) error {
+	if err := cfg.Validate(); err != nil {
+		return fmt.Errorf("invalid configuration: %w", err)
+	}
+	log.Printf("configuration validated: %v", cfg)
+	return run(cfg)
+}
+
+func collections(_ *Config) error {
+	infos, err := cia.ListCollections()
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "SLUG\tNAME\t~DOCUMENTS\tDESCRIPTION")
+	for _, info := range infos {
+		desc := strings.Join(strings.Fields(info.Description), " ")
+		if runes := []rune(desc); len(runes) > 80 {
+			desc = string(runes[:77]) + "..."
+		}
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%d\t%s\n", info.Slug, info.Name, info.Documents, desc)
+	}
+
+	return w.Flush()
+}
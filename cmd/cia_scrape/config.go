@@ -4,33 +4,103 @@ import (
 	"errors"
 	"flag"
 	"fmt"
-	"log"
+	"regexp"
+	"strings"
+	"time"
 
 	"ciascrape/pkg/anythingllm"
+	"ciascrape/pkg/archive"
 	"ciascrape/pkg/cia"
+	"ciascrape/pkg/export"
+	http2 "ciascrape/pkg/http"
+	"ciascrape/pkg/ocr"
+	"ciascrape/pkg/openwebui"
+	"ciascrape/pkg/pdftext"
+	"ciascrape/pkg/rag"
+	"ciascrape/pkg/rotate"
+	"ciascrape/pkg/vectordb"
 )
 
 const (
-	defaultMaxPages = 50
+	defaultMaxPages  = 50
+	defaultMirrorDir = "mirror"
+	defaultExportDir = "export"
 )
 
 var (
 	ErrInvalidConfig = errors.New("invalid config")
+
+	checkpointNameRegex = regexp.MustCompile(`[^a-zA-Z0-9_-]+`)
 )
 
 type Config struct {
-	Collection  string
-	MaxPages    int
-	StartPage   int
-	ForceEmbed  bool
-	AnythingLLM *anythingllm.Config
+	Collection    string
+	Search        string
+	MaxPages      int
+	StartPage     int
+	ForceEmbed    bool
+	Checkpoint    string
+	Resume        bool
+	RPS           float64
+	Burst         int
+	Jitter        time.Duration
+	MirrorDir     string
+	WARCDir       string
+	WARCMaxSize   int64
+	Replay        string
+	LocalFetch    bool
+	Rotation      *RotationConfig
+	Proxies       []string
+	ProxyMode     string
+	ProxyCooldown time.Duration
+	ChatMode      string
+	Stream        bool
+	DryRun        bool
+	AnythingLLM   *anythingllm.Config
+	OpenWebUI     *openwebui.Config
+	Vector        *VectorConfig
+	ExportDir     string
+	ExportMaxSize int64
+	ExportGzip    bool
+	// OCR reads PDFs without a text layer, nil disables it.
+	OCR *ocr.OCR
+	// BackendName selects where the scraped documents are stored, see backends.
+	BackendName string
+	// Backend overrides BackendName.
+	Backend rag.Backend
+	// built is the backend selected by BackendName, built by Validate.
+	built rag.Backend
 }
 
+const (
+	backendAnythingLLM = "anythingllm"
+	backendOpenWebUI   = "openwebui"
+	backendQdrant      = "qdrant"
+	backendChroma      = "chroma"
+	backendJSONL       = "jsonl"
+	backendMarkdown    = "markdown"
+)
+
+var backends = []string{backendAnythingLLM, backendOpenWebUI, backendQdrant, backendChroma, backendJSONL, backendMarkdown}
+
 func NewConfig(collection string) *Config {
 	return &Config{
-		Collection:  collection,
-		MaxPages:    defaultMaxPages,
-		AnythingLLM: anythingllm.NewConfig(),
+		Collection:    collection,
+		MaxPages:      defaultMaxPages,
+		RPS:           http2.DefaultRPS,
+		Burst:         http2.DefaultBurst,
+		Jitter:        http2.DefaultJitter,
+		MirrorDir:     defaultMirrorDir,
+		WARCMaxSize:   archive.DefaultWARCMaxSize,
+		Rotation:      &RotationConfig{Timeout: rotate.DefaultTimeout},
+		ProxyCooldown: http2.DefaultProxyCooldown,
+		ChatMode:      anythingllm.ChatModeQuery,
+		AnythingLLM:   anythingllm.NewConfig(),
+		OpenWebUI:     openwebui.NewConfig(),
+		Vector:        NewVectorConfig(anythingllm.DefaultWorkspace),
+		ExportDir:     defaultExportDir,
+		ExportMaxSize: export.DefaultJSONLMaxSize,
+		BackendName:   backendAnythingLLM,
 	}
 }
 
@@ -52,6 +122,213 @@ func (c *Config) WithStartPage(startPage int) *Config {
 	return c
 }
 
+// WithSearch scrapes the results of a reading room site search instead of a collection.
+func (c *Config) WithSearch(query string) *Config {
+	c.Search = strings.TrimSpace(query)
+	return c
+}
+
+// WithCheckpoint sets the file crawl progress is recorded to. If resume is set the
+// progress already recorded there is picked up instead of starting over.
+func (c *Config) WithCheckpoint(path string, resume bool) *Config {
+	c.Checkpoint = strings.TrimSpace(path)
+	c.Resume = resume
+	return c
+}
+
+func (c *Config) sourceName() string {
+	if c.Search != "" {
+		return cia.SearchName(c.Search)
+	}
+	return c.Collection
+}
+
+func (c *Config) checkpoint() (*cia.Checkpoint, error) {
+	path := c.Checkpoint
+	if path == "" && c.Resume {
+		path = checkpointNameRegex.ReplaceAllString(c.sourceName(), "-") + ".checkpoint.json"
+	}
+	if path == "" {
+		return nil, nil
+	}
+	if !c.Resume {
+		return cia.NewCheckpoint(path, c.sourceName()), nil
+	}
+	return cia.LoadCheckpoint(path, c.sourceName())
+}
+
+// source returns the document listing the configuration scrapes.
+func (c *Config) source(checkpoint *cia.Checkpoint) cia.Source {
+	if c.Search != "" {
+		return cia.NewSearch(c.Search).WithMaxPages(c.MaxPages).WithStartPage(c.StartPage).
+			WithCheckpoint(checkpoint)
+	}
+	return cia.NewCollection(c.Collection).WithMaxPages(c.MaxPages).WithStartPage(c.StartPage).
+		WithCheckpoint(checkpoint)
+}
+
+// WithRateLimit configures the limiter shared by all reading room requests.
+func (c *Config) WithRateLimit(rps float64, burst int, jitter time.Duration) *Config {
+	c.RPS = rps
+	c.Burst = burst
+	c.Jitter = jitter
+	return c
+}
+
+func (c *Config) limiter() *http2.Limiter {
+	return http2.NewLimiter(c.RPS, c.Burst).WithJitter(c.Jitter)
+}
+
+func (c *Config) WithMirrorDir(dir string) *Config {
+	c.MirrorDir = strings.TrimSpace(dir)
+	return c
+}
+
+// WithWARC records all reading room traffic to WARC files in dir, rotated once they grow past maxSize bytes.
+// An empty dir disables WARC output.
+func (c *Config) WithWARC(dir string, maxSize int64) *Config {
+	c.WARCDir = strings.TrimSpace(dir)
+	c.WARCMaxSize = maxSize
+	return c
+}
+
+func (c *Config) warcWriter() (*archive.WARCWriter, error) {
+	if c.WARCDir == "" {
+		return nil, nil
+	}
+	w, err := archive.NewWARCWriter(c.WARCDir)
+	if err != nil {
+		return nil, err
+	}
+	return w.WithMaxSize(c.WARCMaxSize), nil
+}
+
+// WithLocalFetch downloads document pages and PDFs ourselves and uploads their text to AnythingLLM,
+// instead of having AnythingLLM fetch them from the reading room.
+func (c *Config) WithLocalFetch(local bool) *Config {
+	c.LocalFetch = local
+	if c.AnythingLLM != nil {
+		c.AnythingLLM.WithLocalFetch(local)
+	}
+	return c
+}
+
+// WithReplay serves every reading room request from the mirror directory or WARC files at path
+// instead of the live site.
+func (c *Config) WithReplay(path string) *Config {
+	c.Replay = strings.TrimSpace(path)
+	return c
+}
+
+func (c *Config) WithRotation(rotation *RotationConfig) *Config {
+	c.Rotation = rotation
+	return c
+}
+
+// WithProxies spreads all reading room traffic across proxies, rotating per request or on throttling (mode).
+func (c *Config) WithProxies(proxies []string, mode string, cooldown time.Duration) *Config {
+	c.Proxies = proxies
+	c.ProxyMode = mode
+	c.ProxyCooldown = cooldown
+	return c
+}
+
+// WithChat sets how the ask command talks to the workspace.
+func (c *Config) WithChat(mode string, stream bool) *Config {
+	c.ChatMode = mode
+	c.Stream = stream
+	return c
+}
+
+// WithDryRun makes the purge command only list what it would remove.
+func (c *Config) WithDryRun(dryRun bool) *Config {
+	c.DryRun = dryRun
+	return c
+}
+
+func (c *Config) WithBackend(backend rag.Backend) *Config {
+	c.Backend = backend
+	return c
+}
+
+// WithBackendName selects one of backends to store the scraped documents in.
+func (c *Config) WithBackendName(name string) *Config {
+	c.BackendName = strings.ToLower(strings.TrimSpace(name))
+	c.built = nil
+	return c
+}
+
+func (c *Config) WithOpenWebUI(config *openwebui.Config) *Config {
+	c.OpenWebUI = config
+	return c
+}
+
+func (c *Config) WithVector(config *VectorConfig) *Config {
+	c.Vector = config
+	return c
+}
+
+// WithExport sets the directory the jsonl and markdown backends write to. The JSONL files are rotated once
+// they grow past maxSize bytes and gzip-compressed if compress is set.
+func (c *Config) WithExport(dir string, maxSize int64, compress bool) *Config {
+	c.ExportDir = strings.TrimSpace(dir)
+	c.ExportMaxSize = maxSize
+	c.ExportGzip = compress
+	return c
+}
+
+// WithOCR runs PDFs without a text layer through o, for every backend.
+func (c *Config) WithOCR(o *ocr.OCR) *Config {
+	c.OCR = o
+	if c.AnythingLLM != nil {
+		c.AnythingLLM.WithOCR(o)
+	}
+	return c
+}
+
+// extractText reads the text of PDFs for the backends that index text themselves: their text layer,
+// or what OCR reads from their page images if they have none.
+func (c *Config) extractText(name string, data []byte) (string, error) {
+	if !pdftext.IsPDF(data) {
+		return pdftext.Extractor(name, data)
+	}
+	text, err := ocr.TextOrOCR(name, data, c.OCR)
+	if err != nil {
+		return "", fmt.Errorf("%w: '%s': %w", rag.ErrUnsupported, name, err)
+	}
+	return text, nil
+}
+
+// backend returns the RAG store the scraping pipeline uploads to: Backend, or the one Validate built.
+func (c *Config) backend() rag.Backend {
+	if c.Backend != nil {
+		return c.Backend
+	}
+	return c.built
+}
+
+// newBackend builds the backend named by BackendName, or returns nil if there is no such backend.
+func (c *Config) newBackend() rag.Backend {
+	switch c.BackendName {
+	case backendOpenWebUI:
+		return openwebui.NewBackend(c.OpenWebUI)
+	case backendAnythingLLM, "":
+		return anythingllm.NewBackend(c.AnythingLLM)
+	case backendQdrant, backendChroma:
+		if b := c.Vector.backend(c.BackendName, c.extractText); b != nil {
+			return b
+		}
+		return nil
+	case backendMarkdown:
+		return export.NewMarkdown(c.ExportDir).WithExtractor(c.extractText)
+	case backendJSONL:
+		return export.NewJSONL(c.ExportDir).WithMaxSize(c.ExportMaxSize).WithGzip(c.ExportGzip).WithExtractor(c.extractText).
+			WithPrefix(checkpointNameRegex.ReplaceAllString(c.sourceName(), "-"))
+	default:
+		return nil
+	}
+}
+
 func (c *Config) WithAnythingLLM(config *anythingllm.Config) *Config {
 	c.AnythingLLM = config
 	return c
@@ -61,43 +338,154 @@ func ConfigFromFlags() *Config {
 	maxPages := flag.Int("pages", defaultMaxPages, "Maximum number of pages to scrape")
 	startPage := flag.Int("start-page", 1, "Page to start scraping from")
 	collection := flag.String("collection", "", "Collection to scrape")
+	search := flag.String("search", "", "Scrape the results of a reading room site search instead of a collection")
+	backend := flag.String("backend", backendAnythingLLM, "Where to store the scraped documents: "+strings.Join(backends, " or "))
+	owEndpoint := flag.String("openwebui-endpoint", openwebui.DefaultEndpoint, "Open WebUI endpoint")
+	owKey := flag.String("openwebui-key", "", "Open WebUI API key")
+	vectorEndpoint := flag.String("vector-endpoint", "", "Qdrant or Chroma endpoint (default "+vectordb.DefaultQdrantEndpoint+" or "+vectordb.DefaultChromaEndpoint+")")
+	vectorKey := flag.String("vector-key", "", "Qdrant or Chroma API key")
+	embeddingsEndpoint := flag.String("embeddings-endpoint", vectordb.DefaultEmbeddingsEndpoint, "OpenAI-compatible endpoint serving /embeddings, used by the qdrant and chroma backends")
+	embeddingsModel := flag.String("embeddings-model", vectordb.DefaultEmbeddingsModel, "Embeddings model used by the qdrant and chroma backends")
+	embeddingsKey := flag.String("embeddings-key", "", "Embeddings endpoint API key")
+	chunkSize := flag.Int("chunk-size", vectordb.DefaultChunkSize, "Size in characters of the chunks documents are split into by the qdrant and chroma backends")
+	chunkOverlap := flag.Int("chunk-overlap", vectordb.DefaultChunkOverlap, "Characters consecutive chunks overlap by")
+	exportDir := flag.String("export-dir", defaultExportDir, "Directory the jsonl and markdown backends write to")
+	exportMaxSize := flag.Int64("export-max-size", export.DefaultJSONLMaxSize>>20, "Size in MiB after which the jsonl backend starts a new file")
+	exportGzip := flag.Bool("export-gzip", false, "Compress the files of the jsonl backend with gzip")
+	ocrEnabled := flag.Bool("ocr", false, "Run PDFs without a text layer through the OCR command")
+	ocrCommand := flag.String("ocr-command", ocr.DefaultCommand, "Shell command that prints the text of the page image at $1, as plain text or tesseract TSV")
+	ocrMinConfidence := flag.Float64("ocr-min-confidence", 0, "Leave out OCR pages recognized with a lower confidence (0-1)")
+	ocrTimeout := flag.Duration("ocr-timeout", ocr.DefaultTimeout, "Maximum time the OCR command may take for a page image")
+	pdfPagesPerDoc := flag.Int("pdf-pages-per-doc", 0, "Upload the text of PDFs to AnythingLLM as documents of this many pages, so answers cite the page (0 keeps PDFs whole, needs -local-fetch)")
 	aEndpoint := flag.String("anythingllm-endpoint", anythingllm.DefaultEndpoint, "AnythingLLM endpoint")
 	aKey := flag.String("anythingllm-key", "", "AnythingLLM key")
-	aWorkspace := flag.String("anythingllm-workspace", "cia-reading-room", "AnythingLLM workspace")
+	aWorkspace := flag.String("anythingllm-workspace", anythingllm.DefaultWorkspace, "AnythingLLM workspace (the knowledge or vector collection with the other backends)")
 	aForceEmbed := flag.Bool("anythingllm-force-embed", false, "Force embeds in AnythingLLM")
 	aForceProcess := flag.Bool("anythingllm-force-process", false, "Force processing documents")
-	mullvadFIFOTrigger := flag.String(
-		"mullvad-fifo", "", "path to a FIFO where this app will write when the CIA throttles the scraper",
-	)
+	checkpoint := flag.String("checkpoint", "", "File to record crawl progress to (default <collection>.checkpoint.json when -resume is set)")
+	resume := flag.Bool("resume", false, "Resume the crawl recorded in the checkpoint file")
+	rps := flag.Float64("rps", http2.DefaultRPS, "Maximum requests per second to the reading room")
+	burst := flag.Int("burst", http2.DefaultBurst, "Maximum burst of requests to the reading room")
+	jitter := flag.Duration("jitter", http2.DefaultJitter, "Maximum random delay added to each reading room request")
+	mirrorDir := flag.String("mirror-dir", defaultMirrorDir, "Directory the mirror command saves reading room pages and PDFs to")
+	warcDir := flag.String("warc-dir", "", "Directory to write WARC files of all reading room traffic to (disabled when empty)")
+	warcMaxSize := flag.Int64("warc-max-size", archive.DefaultWARCMaxSize>>20, "Size in MiB after which a new WARC file is started")
+	localFetch := flag.Bool("local-fetch", false, "Download pages and PDFs ourselves and upload them as text instead of having AnythingLLM fetch links")
+	replay := flag.String("replay", "", "Read the reading room from a mirror directory, WARC file or directory of WARC files instead of the network")
+	rotateCommand := flag.String("rotate-command", "", "Shell command that rotates our IP address when the reading room throttles us")
+	rotateWebhook := flag.String("rotate-webhook", "", "URL to POST to when the reading room throttles us, answered once the IP address has been rotated")
+	rotateFIFO := flag.String("rotate-fifo", "", "path to a FIFO to write to when the reading room throttles us")
+	rotateFIFOAck := flag.String("rotate-fifo-ack", "", "path to a FIFO to wait on for a line confirming the rotation (see mullvad_switch.sh)")
+	rotateProxies := flag.String("rotate-proxies", "", "Comma separated list of http:// or socks5:// proxies to cycle through when the reading room throttles us")
+	proxies := flag.String("proxies", "", "Comma separated list of http:// or socks5:// proxies to spread reading room traffic across")
+	proxyMode := flag.String("proxy-mode", "request", "When to switch proxies: every request ('request') or when throttled ('throttle')")
+	proxyCooldown := flag.Duration("proxy-cooldown", http2.DefaultProxyCooldown, "How long to leave a throttled or failing proxy alone")
+	rotateTimeout := flag.Duration("rotate-timeout", rotate.DefaultTimeout, "Maximum time to wait for an IP address rotation")
+	chatMode := flag.String("chat-mode", anythingllm.ChatModeQuery, "How the ask command talks to the workspace: 'query' answers only from the scraped documents, 'chat' may use the model's own knowledge")
+	stream := flag.Bool("stream", true, "Print the answer of the ask command as it is generated")
+	embedJournal := flag.String("embed-journal", "", "File to keep the queue of documents to embed in across runs (default <workspace>.embed.jsonl)")
+	embedRetries := flag.Int("embed-retries", anythingllm.DefaultEmbedRetries, "Attempts to embed a document before it is moved to the dead-letter file next to the embed journal")
+	dryRun := flag.Bool("dry-run", false, "Only list the documents the purge command would remove")
+	mullvadFIFOTrigger := flag.String("mullvad-fifo", "", "Deprecated: use -rotate-fifo")
 
 	flag.Parse()
 
+	if *embedJournal == "" {
+		*embedJournal = checkpointNameRegex.ReplaceAllString(*aWorkspace, "-") + ".embed.jsonl"
+	}
+
 	anythingLLM := anythingllm.NewConfig().
 		WithEndpoint(*aEndpoint).WithAPIKey(*aKey).
 		WithWorkspace(*aWorkspace).WithForceEmbed(*aForceEmbed).
-		WithMullvadFIFO(*mullvadFIFOTrigger).WithForceEmbed(*aForceProcess)
+		WithForceEmbed(*aForceProcess).WithEmbedJournal(*embedJournal).WithEmbedRetries(*embedRetries).
+		WithPageSplit(*pdfPagesPerDoc)
 
-	if *collection == "" {
-		log.Fatal("Collection is required")
+	if *rotateFIFO == "" {
+		*rotateFIFO = *mullvadFIFOTrigger
+	}
+
+	rotation := &RotationConfig{
+		Command: *rotateCommand,
+		Webhook: *rotateWebhook,
+		FIFO:    *rotateFIFO,
+		FIFOAck: *rotateFIFOAck,
+		Timeout: *rotateTimeout,
+	}
+	rotation.Proxies = splitList(*rotateProxies)
+
+	openWebUI := openwebui.NewConfig().
+		WithEndpoint(*owEndpoint).WithAPIKey(*owKey).WithKnowledge(*aWorkspace)
+
+	vector := NewVectorConfig(*aWorkspace)
+	vector.Endpoint, vector.APIKey = *vectorEndpoint, *vectorKey
+	vector.EmbeddingsEndpoint, vector.EmbeddingsModel, vector.EmbeddingsKey = *embeddingsEndpoint, *embeddingsModel, *embeddingsKey
+	vector.ChunkSize, vector.ChunkOverlap = *chunkSize, *chunkOverlap
+
+	var pdfOCR *ocr.OCR
+	if *ocrEnabled {
+		pdfOCR = ocr.NewOCR(*ocrCommand).WithMinConfidence(*ocrMinConfidence).WithTimeout(*ocrTimeout)
 	}
 
 	return NewConfig(*collection).
-		WithAnythingLLM(anythingLLM).WithMaxPages(*maxPages).WithStartPage(*startPage)
+		WithAnythingLLM(anythingLLM).WithOpenWebUI(openWebUI).WithVector(vector).WithBackendName(*backend).WithMaxPages(*maxPages).WithStartPage(*startPage).
+		WithSearch(*search).WithCheckpoint(*checkpoint, *resume).WithRateLimit(*rps, *burst, *jitter).
+		WithMirrorDir(*mirrorDir).WithWARC(*warcDir, *warcMaxSize<<20).
+		WithReplay(*replay).WithLocalFetch(*localFetch).WithRotation(rotation).WithProxies(splitList(*proxies), *proxyMode, *proxyCooldown).
+		WithChat(*chatMode, *stream).WithDryRun(*dryRun).WithExport(*exportDir, *exportMaxSize<<20, *exportGzip).
+		WithOCR(pdfOCR)
+}
+
+func splitList(s string) []string {
+	if strings.TrimSpace(s) == "" {
+		return nil
+	}
+	return strings.Split(s, ",")
 }
 
 func (c *Config) Validate() error {
-	if c.Collection == "" {
-		return fmt.Errorf("%w: missing collection name", ErrInvalidConfig)
+	if err := c.validateSource(); err != nil {
+		return err
 	}
-	ciaCol := cia.NewCollection(c.Collection)
-	if err := ciaCol.Validate(); err != nil {
+	if c.Backend == nil && c.built == nil {
+		c.built = c.newBackend()
+	}
+	backend := c.backend()
+	if backend == nil {
+		return fmt.Errorf("%w: unknown backend '%s' (expected one of %s)", ErrInvalidConfig, c.BackendName, strings.Join(backends, ", "))
+	}
+	if err := backend.Validate(); err != nil {
 		return fmt.Errorf("%w: %v", ErrInvalidConfig, err)
 	}
-	if c.MaxPages <= 0 {
-		return fmt.Errorf("%w: max pages must be positive", ErrInvalidConfig)
+	return nil
+}
+
+// validateSource checks the part of the configuration that selects what is scraped from the reading room.
+func (c *Config) validateSource() error {
+	if c.Collection == "" && c.Search == "" {
+		return fmt.Errorf("%w: missing collection name or search query", ErrInvalidConfig)
 	}
-	if err := c.AnythingLLM.Validate(); err != nil {
+	if c.Collection != "" && c.Search != "" {
+		return fmt.Errorf("%w: collection and search are mutually exclusive", ErrInvalidConfig)
+	}
+	if err := c.validateCollection(); err != nil {
 		return fmt.Errorf("%w: %v", ErrInvalidConfig, err)
 	}
+	if c.MaxPages <= 0 {
+		return fmt.Errorf("%w: max pages must be positive", ErrInvalidConfig)
+	}
 	return nil
 }
+
+func (c *Config) validateCollection() error {
+	if c.Collection == "" {
+		return nil
+	}
+	ciaCol := cia.NewCollection(c.Collection)
+	err := ciaCol.Validate()
+	if errors.Is(err, cia.ErrCollectionNotFound) {
+		if suggestions := cia.SuggestCollections(c.Collection); len(suggestions) > 0 {
+			err = fmt.Errorf("%w (did you mean: %s?)", err, strings.Join(suggestions, ", "))
+		}
+	}
+	return err
+}
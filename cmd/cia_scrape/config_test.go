@@ -8,6 +8,9 @@ import (
 	"testing"
 
 	"ciascrape/pkg/anythingllm"
+	"ciascrape/pkg/export"
+	"ciascrape/pkg/openwebui"
+	"ciascrape/pkg/vectordb"
 )
 
 func TestNewConfig_SetsDefaultValues(t *testing.T) {
@@ -69,6 +72,10 @@ func TestValidate_ReturnsErrorForInvalidAnythingLLMConfig(t *testing.T) {
 func TestValidate_Success(t *testing.T) {
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if r.Header.Get("Authorization") == "Bearer testKey" {
+			if strings.HasSuffix(r.URL.Path, "/v1/workspace/"+anythingllm.DefaultWorkspace) {
+				_, _ = w.Write([]byte(`{"workspace": [{"id": 1, "slug": "` + anythingllm.DefaultWorkspace + `"}]}`))
+				return
+			}
 			_, _ = w.Write([]byte(`{"authenticated": true}`))
 			w.WriteHeader(http.StatusOK)
 			return
@@ -93,3 +100,65 @@ func TestValidate_Success(t *testing.T) {
 		t.Errorf("expected error to contain 'Invalid API Key', got %v", err)
 	}
 }
+
+func TestValidate_ReturnsErrorForCollectionAndSearch(t *testing.T) {
+	config := NewConfig("testCollection").WithSearch("mkultra")
+	err := config.Validate()
+	if !errors.Is(err, ErrInvalidConfig) {
+		t.Errorf("expected error %v, got %v", ErrInvalidConfig, err)
+	}
+}
+
+func TestCheckpoint_DefaultsToSourceName(t *testing.T) {
+	config := NewConfig("").WithSearch("remote viewing").WithCheckpoint("", true)
+	checkpoint, err := config.checkpoint()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if checkpoint.Path() != "search-remote-viewing.checkpoint.json" {
+		t.Errorf("expected checkpoint path to be derived from the search, got '%s'", checkpoint.Path())
+	}
+}
+
+func TestConfig_Backend(t *testing.T) {
+	config := NewConfig("stargate")
+	if _, ok := config.newBackend().(*anythingllm.Backend); !ok {
+		t.Errorf("expected the AnythingLLM backend by default, got %T", config.newBackend())
+	}
+	if _, ok := config.WithBackendName(" OpenWebUI ").newBackend().(*openwebui.Backend); !ok {
+		t.Errorf("expected the Open WebUI backend, got %T", config.newBackend())
+	}
+	if backend, ok := config.WithBackendName("qdrant").newBackend().(*vectordb.Backend); !ok || backend.Name() != "qdrant" {
+		t.Errorf("expected the Qdrant backend, got %T", backend)
+	}
+	if backend := config.WithBackendName("chroma").newBackend(); backend == nil || backend.Name() != "chroma" {
+		t.Errorf("expected the Chroma backend, got %T", backend)
+	}
+	if _, ok := config.WithBackendName("jsonl").newBackend().(*export.JSONL); !ok {
+		t.Errorf("expected the JSONL backend, got %T", config.newBackend())
+	}
+	if _, ok := config.WithBackendName("markdown").newBackend().(*export.Markdown); !ok {
+		t.Errorf("expected the Markdown backend, got %T", config.newBackend())
+	}
+	if backend := config.WithBackendName("pinecone").newBackend(); backend != nil {
+		t.Errorf("expected no backend, got %T", backend)
+	}
+}
+
+func TestValidate_BuildsBackendOnce(t *testing.T) {
+	config := NewConfig("").WithSearch("remote viewing").WithExport(t.TempDir(), 0, false).WithBackendName("jsonl")
+	if config.backend() != nil {
+		t.Fatal("expected no backend before Validate")
+	}
+	if err := config.Validate(); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	jsonl, ok := config.backend().(*export.JSONL)
+	if !ok || config.backend() != jsonl {
+		t.Errorf("expected the JSONL backend Validate built to be kept, got %T", config.backend())
+	}
+
+	if err := config.WithBackendName("pinecone").Validate(); !errors.Is(err, ErrInvalidConfig) {
+		t.Errorf("expected error %v, got %v", ErrInvalidConfig, err)
+	}
+}
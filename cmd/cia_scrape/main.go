@@ -3,18 +3,52 @@ package main
 import (
 	"context"
 	"errors"
+	"flag"
+	"fmt"
 	"log"
 	"os"
+	"path"
 	"strings"
 	"time"
 
 	"github.com/l0nax/go-spew/spew"
 
-	"ciascrape/pkg/anythingllm"
+	"ciascrape/pkg/archive"
 	"ciascrape/pkg/cia"
 	"ciascrape/pkg/mu"
+	"ciascrape/pkg/rag"
+	"ciascrape/pkg/rotate"
 )
 
+const (
+	maxAccessDeniedRetries = 10
+	// embedFlushTimeout bounds how long run waits for queued documents to be embedded before exiting.
+	embedFlushTimeout = 5 * time.Minute
+)
+
+// crawl starts scraping the configured source and returns the document URLs as they are discovered.
+func crawl(cfg *Config) (cia.Source, chan string, error) {
+	checkpoint, err := cfg.checkpoint()
+	if err != nil {
+		return nil, nil, err
+	}
+	if checkpoint != nil {
+		log.Printf("recording crawl progress to '%s' (resume: %t)", checkpoint.Path(), cfg.Resume)
+	}
+
+	source := cfg.source(checkpoint)
+
+	go func() {
+		if err := source.GetPages(); err != nil {
+			log.Printf("[err] failed to get pages: %v", err)
+		}
+	}()
+
+	pages, _ := source.Drain(context.Background())
+
+	return source, pages, nil
+}
+
 func run(cfg *Config) error {
 	defer func() {
 		if r := recover(); r != nil {
@@ -29,83 +63,224 @@ func run(cfg *Config) error {
 		}
 	}()
 
-	ciaCol := cia.NewCollection(cfg.Collection).WithMaxPages(cfg.MaxPages).WithStartPage(cfg.StartPage)
+	ciaCol, pages, err := crawl(cfg)
+	if err != nil {
+		return err
+	}
 
-	go func() {
-		if err := ciaCol.GetPages(); err != nil {
-			log.Printf("[err] failed to get pages: %v", err)
+	defer func() {
+		if err := ciaCol.SaveCheckpoint(); err != nil {
+			log.Printf("[err] failed to save checkpoint: %v", err)
 		}
 	}()
 
-	_ = mu.NewSharedMutex("net").WithSIGHUPUnlock()
+	backend := cfg.backend()
 
-	pages, doneCh := ciaCol.Drain(context.Background())
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), embedFlushTimeout)
+		defer cancel()
+		if err := backend.Flush(ctx); err != nil {
+			log.Printf("[err] failed to embed all documents: %v", err)
+		}
+		if err := backend.Close(); err != nil {
+			log.Printf("[err] failed to close %s backend: %v", backend.Name(), err)
+		}
+	}()
 
 	count := 0
-	retries := 0
 	dupes := 0
+	localFetch := cfg.LocalFetch
 
 	for page := range pages {
-		doc, err := cfg.AnythingLLM.UploadLink(page)
-		if errors.Is(err, anythingllm.ErrDuplicate) {
+		var doc *rag.Document
+		if !localFetch {
+			doc, err = uploadLink(backend, page)
+			if errors.Is(err, rag.ErrUnsupported) {
+				log.Printf("the %s backend can't fetch links, fetching pages locally", backend.Name())
+				localFetch = true
+			}
+		}
+		if localFetch {
+			doc, err = uploadLocal(backend, page)
+		}
+		if errors.Is(err, rag.ErrDuplicate) {
+			ciaCol.MarkEmitted(page)
 			dupes++
 			// log.Printf("duplicate link: %s", page)
 			continue
 		}
 
-		log.Printf("uploading page (dupes skipped: %d): %s", dupes, page)
-
 		if err != nil {
-			if errors.Is(err, anythingllm.ErrAccessDenied) {
-				retries++
-				log.Printf("[err] access denied (%d), retrying and sleeping...", retries)
-				if err := cfg.AnythingLLM.DeleteDocument(doc.Location); err != nil {
-					log.Printf("[err] failed to delete document '%s': %v", doc.Location, err)
-					return err
-				}
-				log.Printf("deleted document '%s'", doc.Location)
-				go func() {
-					time.Sleep(time.Second / 2)
-					select {
-					case <-doneCh:
-						return
-					default:
-					}
-					pages <- page
-				}()
-				switch {
-				case retries > 10 && retries <= 100:
-					time.Sleep(time.Millisecond * time.Duration(retries*25))
-				case retries > 100:
-					time.Sleep(time.Duration(time.Second*time.Duration(retries)) / 4)
-				default:
-					time.Sleep(time.Duration(time.Second*time.Duration(retries)) / 4)
-				}
-				continue
-			}
 			log.Printf("[err] failed to upload link: %v", err)
 			continue
 		}
 		spew.Dump(doc)
-		if err := cfg.AnythingLLM.AddDocument(doc); err != nil {
+		if err := backend.Attach(doc); err != nil {
 			log.Printf("[err] failed to add document '%s': %v", doc.ID, err)
 			return err
 		}
+		ciaCol.MarkEmitted(page)
 		count++
 	}
 
-	log.Printf("uploaded %d links", count)
+	log.Printf("uploaded %d links (%d duplicates skipped)", count, dupes)
 
 	return nil
 }
 
+// uploadLink uploads page, retrying while the reading room answers with Access Denied.
+// Pacing between attempts is left to the cia.Client rate limiter, which backs off on every denial.
+func uploadLink(backend rag.Backend, page string) (*rag.Document, error) {
+	for retries := 0; ; retries++ {
+		log.Printf("uploading page: %s", page)
+
+		doc, err := backend.UploadLink(page)
+		if !errors.Is(err, rag.ErrAccessDenied) {
+			return doc, err
+		}
+
+		log.Printf("[err] access denied (%d), retrying...", retries+1)
+		// the backend keeps the Access Denied page it fetched
+		if doc != nil && doc.Location != "" {
+			if err := backend.Delete(doc); err != nil {
+				log.Printf("[err] failed to delete document '%s': %v", doc.Location, err)
+				return nil, err
+			}
+			log.Printf("deleted document '%s'", doc.Location)
+		}
+
+		if retries >= maxAccessDeniedRetries {
+			return nil, fmt.Errorf("%w: gave up on '%s' after %d attempts", err, page, retries+1)
+		}
+	}
+}
+
+// uploadLocal fetches page and its PDFs through cia.Client and uploads them, so the backend never touches
+// the reading room. The PDFs are attached right away, the page is left to the caller.
+// Access Denied pages are retried by getDocument and never uploaded.
+func uploadLocal(backend rag.Backend, page string) (*rag.Document, error) {
+	if backend.Seen(page) {
+		return nil, rag.ErrDuplicate
+	}
+
+	log.Printf("fetching page: %s", page)
+
+	ciaDoc, err := getDocument(page)
+	if err != nil {
+		return nil, err
+	}
+
+	doc, err := backend.UploadText(ciaDoc)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, pdf := range ciaDoc.PDFs() {
+		pdfDoc, err := uploadPDF(backend, ciaDoc.Collection, pdf)
+		if errors.Is(err, rag.ErrDuplicate) {
+			continue
+		}
+		if err == nil {
+			err = backend.Attach(pdfDoc)
+		}
+		if err != nil {
+			log.Printf("[err] failed to upload PDF '%s' of '%s': %v", pdf, page, err)
+		}
+	}
+
+	return doc, nil
+}
+
+// uploadPDF finds where the PDF linked as url from a document of collection is, downloads it, retrying while
+// the reading room answers with Access Denied, and uploads it as url, which the backend knows it by.
+func uploadPDF(backend rag.Backend, collection, url string) (*rag.Document, error) {
+	if backend.Seen(url) {
+		return nil, rag.ErrDuplicate
+	}
+
+	log.Printf("fetching PDF: %s", url)
+
+	var (
+		loc  *cia.PDFLocation
+		data []byte
+		err  error
+	)
+	for retries := 0; ; retries++ {
+		if loc, err = cia.ResolvePDF(collection, url); err == nil {
+			data, err = cia.GetFile(loc.URL)
+		}
+		if !errors.Is(err, cia.ErrAccessDenied) || retries >= maxAccessDeniedRetries {
+			break
+		}
+		log.Printf("[err] access denied (%d), retrying...", retries+1)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return backend.UploadFile(url, path.Base(url), data)
+}
+
 func main() {
+	name := commandFromArgs()
+	cmd, ok := commands[name]
+	if !ok {
+		log.Fatalf("unknown command '%s'", name)
+	}
+	flag.Usage = usage
 	cfg := ConfigFromFlags()
-	if err := cfg.Validate(); err != nil {
-		log.Fatalf("invalid configuration: %v", err)
+
+	_ = mu.NewSharedMutex("net")
+
+	cia.Client.WithLimiter(cfg.limiter())
+
+	if cfg.Replay != "" {
+		rt, err := archive.NewReplayTransport(cfg.Replay)
+		if err != nil {
+			log.Fatalf("failed to open replay archive: %v", err)
+		}
+		// nothing to pace or rotate when reading from disk
+		cia.Client.WithTransport(rt).WithLimiter(nil)
+		cfg.WithLocalFetch(true)
+		log.Printf("replaying the reading room from '%s'", cfg.Replay)
+	} else {
+		rotator, err := cfg.Rotation.rotator()
+		if err != nil {
+			log.Fatalf("failed to set up IP rotation: %v", err)
+		}
+		if rotator != nil {
+			cia.Client.WithRotator(rotate.NewRotation(rotator).WithTimeout(cfg.Rotation.Timeout))
+		}
+		pool, err := cfg.proxyPool()
+		if err != nil {
+			log.Fatalf("failed to set up proxies: %v", err)
+		}
+		if pool != nil {
+			cia.Client.WithProxyPool(pool)
+		}
+	}
+
+	warc, err := cfg.warcWriter()
+	if err != nil {
+		log.Fatalf("failed to open WARC output: %v", err)
+	}
+	if warc != nil {
+		cia.Client.WithRecorder(warc)
+	}
+
+	err = cmd(cfg)
+
+	if warc != nil {
+		if err := warc.Close(); err != nil {
+			log.Printf("[err] failed to close WARC output: %v", err)
+		}
+	}
+	if pool := cia.Client.ProxyPool(); pool != nil {
+		for _, stats := range pool.Stats() {
+			log.Printf("[proxy] %s", stats)
+		}
 	}
-	log.Printf("configuration validated: %v", cfg)
-	if err := run(cfg); err != nil {
-		log.Fatalf("run failed: %v", err)
+	if err != nil {
+		log.Fatalf("%s failed: %v", name, err)
 	}
 }
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"sync"
+	"testing"
+
+	"ciascrape/pkg/cia"
+	http2 "ciascrape/pkg/http"
+	"ciascrape/pkg/rag"
+)
+
+// fakeBackend keeps everything in memory and can't fetch links.
+type fakeBackend struct {
+	texts    []string
+	files    []string
+	attached []string
+	seen     map[string]bool
+	flushed  bool
+	closed   bool
+	mu       sync.Mutex
+}
+
+func (f *fakeBackend) Name() string    { return "fake" }
+func (f *fakeBackend) Validate() error { return nil }
+
+func (f *fakeBackend) Seen(url string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.seen[url]
+}
+
+func (f *fakeBackend) UploadText(doc *cia.Document) (*rag.Document, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.seen[doc.URL] = true
+	f.texts = append(f.texts, doc.Title)
+	return &rag.Document{ID: doc.Title, Location: "text/" + doc.Title, URL: doc.URL}, nil
+}
+
+func (f *fakeBackend) UploadFile(url, name string, data []byte) (*rag.Document, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.seen[url] = true
+	f.files = append(f.files, name)
+	return &rag.Document{ID: name, Location: "files/" + name, URL: url}, nil
+}
+
+func (f *fakeBackend) UploadLink(string) (*rag.Document, error) {
+	return nil, rag.ErrUnsupported
+}
+
+func (f *fakeBackend) Attach(docs ...*rag.Document) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, doc := range docs {
+		f.attached = append(f.attached, doc.Location)
+	}
+	return nil
+}
+
+func (f *fakeBackend) Delete(...*rag.Document) error { return nil }
+
+func (f *fakeBackend) Flush(context.Context) error {
+	f.flushed = true
+	return nil
+}
+
+func (f *fakeBackend) Close() error {
+	f.closed = true
+	return nil
+}
+
+func TestRun_UploadsThroughBackend(t *testing.T) {
+	server := testReadingRoom()
+	defer server.Close()
+	cia.EndpointBase = server.URL + "/"
+	cia.Client.WithLimiter(http2.NewLimiter(1000, 1000))
+
+	backend := &fakeBackend{seen: map[string]bool{
+		server.URL + "/readingroom/docs/doc-2.pdf": true,
+	}}
+	cfg := NewConfig("test").WithMaxPages(1).WithBackend(backend)
+	if err := run(cfg); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	sort.Strings(backend.texts)
+	sort.Strings(backend.attached)
+	if len(backend.texts) != 2 || backend.texts[0] != "doc-1" || backend.texts[1] != "doc-2" {
+		t.Errorf("expected both pages to be uploaded as text, got %v", backend.texts)
+	}
+	if len(backend.files) != 1 || backend.files[0] != "doc-1.pdf" {
+		t.Errorf("expected only the unseen PDF to be uploaded, got %v", backend.files)
+	}
+	if len(backend.attached) != 3 || backend.attached[0] != "files/doc-1.pdf" {
+		t.Errorf("expected the pages and the PDF to be attached, got %v", backend.attached)
+	}
+	if !backend.flushed || !backend.closed {
+		t.Error("expected the backend to be flushed and closed")
+	}
+}
+
+func TestUploadPDF_KeepsLinkedURL(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/readingroom/docs/DOC-1.pdf" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/pdf")
+		_, _ = w.Write([]byte("%PDF-1.4"))
+	}))
+	defer server.Close()
+	cia.Client.WithLimiter(http2.NewLimiter(1000, 1000))
+
+	backend := &fakeBackend{seen: make(map[string]bool)}
+	url := server.URL + "/readingroom/docs/doc-1.pdf"
+	doc, err := uploadPDF(backend, "moved", url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if doc.URL != url || len(backend.files) != 1 || backend.files[0] != "doc-1.pdf" {
+		t.Errorf("expected the PDF to be uploaded as linked, got %+v %v", doc, backend.files)
+	}
+	if _, err = uploadPDF(backend, "moved", url); !errors.Is(err, rag.ErrDuplicate) {
+		t.Errorf("expected %v, got %v", rag.ErrDuplicate, err)
+	}
+}
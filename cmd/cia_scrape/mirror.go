@@ -0,0 +1,103 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+
+	"ciascrape/pkg/archive"
+	"ciascrape/pkg/cia"
+)
+
+// mirror crawls the configured source and saves every collection page, document page and PDF
+// to cfg.MirrorDir without uploading anything.
+func mirror(cfg *Config) error {
+	if err := cfg.validateSource(); err != nil {
+		return fmt.Errorf("invalid configuration: %w", err)
+	}
+	if cfg.MirrorDir == "" {
+		return fmt.Errorf("invalid configuration: %w: missing mirror directory", ErrInvalidConfig)
+	}
+
+	m, err := archive.NewMirror(cfg.MirrorDir)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := m.Close(); err != nil {
+			log.Printf("[err] failed to close mirror: %v", err)
+		}
+	}()
+
+	cia.Client.WithRecorder(m)
+	defer cia.Client.WithoutRecorder(m)
+
+	log.Printf("mirroring '%s' to '%s'", cfg.sourceName(), m.Dir())
+
+	source, pages, err := crawl(cfg)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if err := source.SaveCheckpoint(); err != nil {
+			log.Printf("[err] failed to save checkpoint: %v", err)
+		}
+	}()
+
+	count := 0
+	pdfs := 0
+
+	for page := range pages {
+		doc, err := getDocument(page)
+		if err != nil {
+			log.Printf("[err] failed to mirror document '%s': %v", page, err)
+			continue
+		}
+
+		failed := false
+		for _, pdf := range doc.PDFs() {
+			if m.Has(pdf) {
+				continue
+			}
+			if err := mirrorFile(pdf); err != nil {
+				log.Printf("[err] failed to mirror PDF '%s': %v", pdf, err)
+				failed = true
+				continue
+			}
+			pdfs++
+		}
+
+		if !failed {
+			source.MarkEmitted(page)
+		}
+		count++
+	}
+
+	log.Printf("mirrored %d documents and %d PDFs to '%s'", count, pdfs, m.Dir())
+
+	return nil
+}
+
+// getDocument fetches a document page, retrying while the reading room answers with Access Denied.
+func getDocument(page string) (*cia.Document, error) {
+	for retries := 0; ; retries++ {
+		doc, err := cia.GetDocument(page)
+		if !errors.Is(err, cia.ErrAccessDenied) || retries >= maxAccessDeniedRetries {
+			return doc, err
+		}
+		log.Printf("[err] access denied (%d), retrying...", retries+1)
+	}
+}
+
+// mirrorFile downloads an attachment so that the mirror recorder saves it, retrying while the reading room
+// answers with Access Denied, which the recorder does not save.
+func mirrorFile(url string) error {
+	for retries := 0; ; retries++ {
+		_, err := cia.GetFile(url)
+		if !errors.Is(err, cia.ErrAccessDenied) || retries >= maxAccessDeniedRetries {
+			return err
+		}
+		log.Printf("[err] access denied (%d), retrying...", retries+1)
+	}
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"sync/atomic"
+	"testing"
+
+	"ciascrape/pkg/archive"
+	"ciascrape/pkg/cia"
+	http2 "ciascrape/pkg/http"
+)
+
+const testCollectionPage = `<div class="views-row"><span class="field-content"><a href="/readingroom/document/doc-1">DOC 1</a></span></div>
+<div class="views-row"><span class="field-content"><a href="/readingroom/document/doc-2">DOC 2</a></span></div>`
+
+const testDocPage = `<h1 class="documentFirstHeading">%s</h1>
+<span class="file"><img src="/pdf.png" /> <a href="/readingroom/docs/%s.pdf" type="application/pdf">%s.pdf</a></span>`
+
+func testReadingRoom() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/readingroom/collection/test":
+			if r.URL.RawQuery != "" {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			_, _ = w.Write([]byte(testCollectionPage))
+		case "/readingroom/document/doc-1", "/readingroom/document/doc-2":
+			name := r.URL.Path[len("/readingroom/document/"):]
+			_, _ = fmt.Fprintf(w, testDocPage, name, name, name)
+		case "/readingroom/docs/doc-1.pdf", "/readingroom/docs/doc-2.pdf":
+			w.Header().Set("Content-Type", "application/pdf")
+			_, _ = w.Write([]byte("%PDF-1.4"))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+}
+
+func TestMirror_ReplaysOffline(t *testing.T) {
+	server := testReadingRoom()
+	cia.EndpointBase = server.URL + "/"
+	cia.Client.WithLimiter(http2.NewLimiter(1000, 1000))
+
+	cfg := NewConfig("test").WithMaxPages(1).WithMirrorDir(t.TempDir())
+	if err := mirror(cfg); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	server.Close()
+
+	rt, err := archive.NewReplayTransport(cfg.MirrorDir)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	cia.Client.WithTransport(rt)
+	defer cia.Client.WithTransport(nil)
+
+	_, pages, err := crawl(cfg)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	var titles []string
+	for page := range pages {
+		doc, err := getDocument(page)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if pdfs := doc.PDFs(); len(pdfs) != 1 || !archiveHas(t, cfg.MirrorDir, pdfs[0]) {
+			t.Errorf("expected the PDF of '%s' to be mirrored, got %v", page, pdfs)
+		}
+		titles = append(titles, doc.Title)
+	}
+	sort.Strings(titles)
+
+	if len(titles) != 2 || titles[0] != "doc-1" || titles[1] != "doc-2" {
+		t.Errorf("expected both documents to be replayed, got %v", titles)
+	}
+}
+
+func archiveHas(t *testing.T, dir, url string) bool {
+	t.Helper()
+	entries, err := archive.ReadManifest(dir)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	_, ok := entries[url]
+	return ok
+}
+
+func TestMirror_RetriesAccessDeniedPDF(t *testing.T) {
+	readingRoom := testReadingRoom()
+	defer readingRoom.Close()
+
+	var denied atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/readingroom/docs/doc-1.pdf" && denied.Add(1) == 1 {
+			_, _ = w.Write([]byte("<HTML><HEAD>\n<TITLE>Access Denied</TITLE>\n</HEAD></HTML>"))
+			return
+		}
+		readingRoom.Config.Handler.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	cia.EndpointBase = server.URL + "/"
+	cia.Client.WithLimiter(http2.NewLimiter(1000, 1000))
+
+	cfg := NewConfig("test").WithMaxPages(1).WithMirrorDir(t.TempDir())
+	if err := mirror(cfg); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if !archiveHas(t, cfg.MirrorDir, server.URL+"/readingroom/docs/doc-1.pdf") {
+		t.Error("expected the PDF to be mirrored after the Access Denied page")
+	}
+	if denied.Load() != 2 {
+		t.Errorf("expected the PDF to be fetched twice, got %d", denied.Load())
+	}
+}
@@ -11,10 +11,7 @@ while :; do
 		sleep 1
 		echo -n "."
 	done
-	echo -n "sending SIGUP..."
-	if ! pkill -SIGHUP -e cia_scrape >/dev/null; then
-		if ! pkill -SIGHUP -e "$(pwd | awk -F '/' '{print $NF}')" >/dev/null; then
-			echo -n -e "failed :(\n"
-		fi
-	else echo -n -e "done\n"; fi
+	# cia_scrape -rotate-fifo mullvad_trigger -rotate-fifo-ack mullvad_ack waits for this line
+	echo -n "acknowledging..."
+	echo "done" >mullvad_ack && echo -n -e "done\n"
 done
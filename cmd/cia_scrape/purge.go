@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+	"log"
+)
+
+// purge removes the Access Denied and maintenance pages uploaded while the reading room was throttling us
+// from the workspace and the AnythingLLM library, so they can be scraped again.
+func purge(cfg *Config) error {
+	if err := cfg.AnythingLLM.Validate(); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidConfig, err)
+	}
+
+	docs, err := cfg.AnythingLLM.ThrottledDocuments()
+	if err != nil {
+		return err
+	}
+	if len(docs) == 0 {
+		log.Printf("no throttled documents found")
+		return nil
+	}
+
+	locations := make([]string, 0, len(docs))
+	for _, doc := range docs {
+		log.Printf("throttled document: %s (%s)", doc.Location, doc.URL)
+		locations = append(locations, doc.Location)
+	}
+	if cfg.DryRun {
+		log.Printf("would remove %d throttled documents", len(docs))
+		return nil
+	}
+
+	if err = cfg.AnythingLLM.RemoveDocuments(locations...); err != nil {
+		log.Printf("[err] failed to remove throttled documents from workspace '%s': %v", cfg.AnythingLLM.Workspace, err)
+	}
+	if err = cfg.AnythingLLM.DeleteDocuments(locations...); err != nil {
+		return err
+	}
+
+	log.Printf("removed %d throttled documents", len(docs))
+
+	return nil
+}
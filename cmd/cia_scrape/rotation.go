@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"ciascrape/pkg/cia"
+	http2 "ciascrape/pkg/http"
+	"ciascrape/pkg/rotate"
+)
+
+// RotationConfig selects how the scraper rotates its IP address when the reading room throttles it.
+// At most one of Command, Webhook, FIFO and Proxies may be set.
+type RotationConfig struct {
+	Command string
+	Webhook string
+	FIFO    string
+	FIFOAck string
+	Proxies []string
+	Timeout time.Duration
+}
+
+// rotator builds the configured rotator, or returns nil if rotation is disabled.
+func (rc *RotationConfig) rotator() (rotate.Rotator, error) {
+	if rc == nil {
+		return nil, nil
+	}
+
+	var (
+		rotators []rotate.Rotator
+		err      error
+	)
+	if strings.TrimSpace(rc.Command) != "" {
+		rotators = append(rotators, rotate.NewCommand(rc.Command))
+	}
+	if strings.TrimSpace(rc.Webhook) != "" {
+		rotators = append(rotators, rotate.NewWebhook(rc.Webhook))
+	}
+	if strings.TrimSpace(rc.FIFO) != "" {
+		rotators = append(rotators, rotate.NewFIFO(rc.FIFO).WithAck(rc.FIFOAck))
+	}
+	if len(rc.Proxies) > 0 {
+		var proxies *rotate.ProxyList
+		if proxies, err = rotate.NewProxyList(func(u *url.URL) { cia.Client.WithProxy(u) }, rc.Proxies...); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidConfig, err)
+		}
+		rotators = append(rotators, proxies)
+	}
+
+	switch len(rotators) {
+	case 0:
+		return nil, nil
+	case 1:
+		return rotators[0], nil
+	default:
+		return nil, fmt.Errorf("%w: rotate command, webhook, FIFO and proxies are mutually exclusive", ErrInvalidConfig)
+	}
+}
+
+// proxyPool builds the pool all reading room traffic is spread across, or returns nil if no proxies are set.
+func (c *Config) proxyPool() (*http2.ProxyPool, error) {
+	if len(c.Proxies) == 0 {
+		return nil, nil
+	}
+	if c.Rotation != nil && len(c.Rotation.Proxies) > 0 {
+		return nil, fmt.Errorf("%w: proxies and rotate proxies are mutually exclusive", ErrInvalidConfig)
+	}
+	mode, err := http2.ParseProxyMode(c.ProxyMode)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidConfig, err)
+	}
+	pool, err := http2.NewProxyPool(c.Proxies...)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidConfig, err)
+	}
+	return pool.WithMode(mode).WithCooldown(c.ProxyCooldown), nil
+}
@@ -31,6 +31,11 @@ if ! ls mullvad_trigger >/dev/null; then
 	mkfifo mullvad_trigger || exit 1
 fi
 
+if ! ls mullvad_ack >/dev/null; then
+	echo "creating mullvad_ack fifo"
+	mkfifo mullvad_ack || exit 1
+fi
+
 ./mullvad_get_relays.sh &
 ./mullvad_switch.sh &
 if ! pgrep -f mullvad_get_relays.sh && pgrep -f mullvad_switch.sh; then
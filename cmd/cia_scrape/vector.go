@@ -0,0 +1,45 @@
+package main
+
+import (
+	"ciascrape/pkg/rag"
+	"ciascrape/pkg/vectordb"
+)
+
+// VectorConfig configures the qdrant and chroma backends, which chunk and embed documents themselves
+// and store them straight in a vector database.
+type VectorConfig struct {
+	Endpoint           string
+	APIKey             string
+	Collection         string
+	EmbeddingsEndpoint string
+	EmbeddingsModel    string
+	EmbeddingsKey      string
+	ChunkSize          int
+	ChunkOverlap       int
+}
+
+func NewVectorConfig(collection string) *VectorConfig {
+	return &VectorConfig{
+		Collection:         collection,
+		EmbeddingsEndpoint: vectordb.DefaultEmbeddingsEndpoint,
+		EmbeddingsModel:    vectordb.DefaultEmbeddingsModel,
+		ChunkSize:          vectordb.DefaultChunkSize,
+		ChunkOverlap:       vectordb.DefaultChunkOverlap,
+	}
+}
+
+// backend builds the backend for the vector database named store, or returns nil if there is no such store.
+func (vc *VectorConfig) backend(store string, extract rag.Extractor) *vectordb.Backend {
+	var s vectordb.Store
+	switch store {
+	case backendQdrant:
+		s = vectordb.NewQdrant(vc.Endpoint).WithAPIKey(vc.APIKey)
+	case backendChroma:
+		s = vectordb.NewChroma(vc.Endpoint).WithAPIKey(vc.APIKey)
+	default:
+		return nil
+	}
+	embedder := vectordb.NewEmbedder(vc.EmbeddingsEndpoint, vc.EmbeddingsModel).WithAPIKey(vc.EmbeddingsKey)
+	return vectordb.NewBackend(s, embedder, vc.Collection).WithChunking(vc.ChunkSize, vc.ChunkOverlap).
+		WithExtractor(extract)
+}
@@ -0,0 +1,64 @@
+// Package pdftest builds small PDFs for tests.
+package pdftest
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"strings"
+)
+
+// Build assembles a PDF from numbered objects, 1 being the catalog, with a valid cross-reference table.
+func Build(objects ...string) []byte {
+	return BuildTrailer("", objects...)
+}
+
+// BuildTrailer is Build with further trailer entries, e.g. /Info.
+func BuildTrailer(trailer string, objects ...string) []byte {
+	buf := bytes.NewBufferString("%PDF-1.4\n")
+	offsets := make([]int, len(objects))
+	for i, o := range objects {
+		offsets[i] = buf.Len()
+		_, _ = fmt.Fprintf(buf, "%d 0 obj\n%s\nendobj\n", i+1, o)
+	}
+	xref := buf.Len()
+	_, _ = fmt.Fprintf(buf, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, off := range offsets {
+		_, _ = fmt.Fprintf(buf, "%010d 00000 n \n", off)
+	}
+	_, _ = fmt.Fprintf(buf, "trailer\n<< /Size %d /Root 1 0 R %s>>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, trailer, xref)
+	return buf.Bytes()
+}
+
+// Stream returns a stream object with the entries in dict and data.
+func Stream(dict string, data []byte) string {
+	return fmt.Sprintf("<< %s /Length %d >>\nstream\n%s\nendstream", dict, len(data), data)
+}
+
+// Deflate compresses s for a stream with /Filter /FlateDecode.
+func Deflate(s string) []byte {
+	buf := &bytes.Buffer{}
+	w := zlib.NewWriter(buf)
+	_, _ = w.Write([]byte(s))
+	_ = w.Close()
+	return buf.Bytes()
+}
+
+// Scanned returns a PDF of pages that each hold a single 2x2 grayscale image and no text. The objects
+// of page n are 3n (page), 3n+1 (content) and 3n+2 (image).
+func Scanned(pages int) []byte {
+	img := Deflate("\x00\xff\xff\x00")
+	kids := make([]string, pages)
+	objects := []string{`<< /Type /Catalog /Pages 2 0 R >>`, ""}
+	for i := 0; i < pages; i++ {
+		page, content, image := len(objects)+1, len(objects)+2, len(objects)+3
+		kids[i] = fmt.Sprintf("%d 0 R", page)
+		objects = append(objects,
+			fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 612 792] /Contents %d 0 R /Resources << /XObject << /Im0 %d 0 R >> >> >>", content, image),
+			Stream("", []byte("q 612 0 0 792 0 0 cm /Im0 Do Q")),
+			Stream("/Type /XObject /Subtype /Image /Width 2 /Height 2 /ColorSpace /DeviceGray /BitsPerComponent 8 /Filter /FlateDecode", img),
+		)
+	}
+	objects[1] = fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), pages)
+	return Build(objects...)
+}
@@ -15,28 +15,41 @@ import (
 
 	"ciascrape/pkg/bufs"
 	"ciascrape/pkg/mu"
+	"ciascrape/pkg/ocr"
 )
 
 const (
-	DefaultEndpoint = "http://localhost:3001/api/"
-	auth            = "v1/auth"
+	DefaultEndpoint  = "http://localhost:3001/api/"
+	DefaultWorkspace = "cia-reading-room"
+	auth             = "v1/auth"
 )
 
 type Config struct {
 	Endpoint     string
 	APIKey       string
 	Workspace    string
-	mullvadFIFO  string
 	seen         Seen
 	forceEmbed   bool
 	forceProcess bool
+	localFetch   bool
+	embedJournal string
+	embedRetries int
+	ocr          *ocr.OCR
+	pageSplit    int
+	parents      map[string]string
+	queue        *embedQueue
+	queueErr     error
+	queueOnce    sync.Once
 	mu           sync.RWMutex
 }
 
 func NewConfig() *Config {
 	c := &Config{
-		Endpoint: DefaultEndpoint,
-		seen:     make(Seen),
+		Endpoint:     DefaultEndpoint,
+		Workspace:    DefaultWorkspace,
+		embedRetries: DefaultEmbedRetries,
+		seen:         make(Seen),
+		parents:      make(map[string]string),
 	}
 	return c
 }
@@ -46,9 +59,41 @@ func (c *Config) WithForceProcess(force bool) *Config {
 	return c
 }
 
-func (c *Config) WithMullvadFIFO(fifo string) *Config {
-	fifo = strings.TrimSpace(fifo)
-	c.mullvadFIFO = fifo
+// WithLocalFetch makes the scraper download pages and PDFs itself and upload their contents,
+// instead of asking AnythingLLM to fetch links from the reading room.
+func (c *Config) WithLocalFetch(local bool) *Config {
+	c.localFetch = local
+	return c
+}
+
+// WithEmbedJournal keeps the queue of documents to embed in the journal at path, so that documents
+// queued when the process exits are embedded on the next run. Documents that keep failing are moved
+// to a .dead.jsonl file next to it.
+func (c *Config) WithEmbedJournal(path string) *Config {
+	c.embedJournal = path
+	return c
+}
+
+// WithEmbedRetries sets how many times a document is tried before it is moved to the dead-letter file.
+func (c *Config) WithEmbedRetries(retries int) *Config {
+	if retries > 0 {
+		c.embedRetries = retries
+	}
+	return c
+}
+
+// WithOCR runs PDFs without a text layer through o when AnythingLLM can't process them.
+func (c *Config) WithOCR(o *ocr.OCR) *Config {
+	c.ocr = o
+	return c
+}
+
+// WithPageSplit uploads the text of PDFs as documents of up to pages pages each, cited by the page they
+// start on, instead of as one document. 0 keeps PDFs whole.
+func (c *Config) WithPageSplit(pages int) *Config {
+	if pages >= 0 {
+		c.pageSplit = pages
+	}
 	return c
 }
 
@@ -78,6 +123,11 @@ func (c *Config) hasSeenURL(s string) bool {
 	return ok
 }
 
+// HasSeen reports whether s is already among the documents of the AnythingLLM instance.
+func (c *Config) HasSeen(s string) bool {
+	return c.hasSeenURL(s)
+}
+
 func (c *Config) markSeenURL(s string) {
 	if c.forceProcess {
 		return
@@ -90,6 +140,16 @@ func (c *Config) markSeenURL(s string) {
 	c.mu.Unlock()
 }
 
+func (c *Config) unmarkSeenURL(s string) {
+	if strings.HasPrefix(s, "link://") {
+		s = s[7:]
+	}
+	c.mu.Lock()
+	delete(c.seen, "link://"+s)
+	delete(c.seen, s)
+	c.mu.Unlock()
+}
+
 func (c *Config) updateSeen() error {
 	docsFolder, err := c.GetDocuments()
 	if err != nil {
@@ -102,6 +162,10 @@ func (c *Config) updateSeen() error {
 					continue
 				}
 				c.markSeenURL(item.ChunkSource)
+				// the page ranges of a split PDF stand for the whole PDF
+				if i := strings.Index(item.ChunkSource, pageAnchor); i > 0 {
+					c.markSeenURL(item.ChunkSource[:i])
+				}
 				if c.forceEmbed {
 					log.Printf("[info] force re-embedding document: %s", item.ChunkSource)
 					if err := c.AddDocumentItem(&item); err != nil {
@@ -223,16 +287,28 @@ func (c *Config) post(endpoint string, body io.Reader) (*http.Response, error) {
 }
 
 func (c *Config) Upload(name string, file io.Reader) (*http.Response, error) {
-	return c.upload("v1/document/upload", name, file)
+	return c.upload("v1/document/upload", name, file, nil)
 }
 
-func (c *Config) upload(endpoint string, name string, file io.Reader) (*http.Response, error) {
+// upload posts file as a multipart form, along with the metadata AnythingLLM should give the document
+// instead of what it guesses from the file, if meta isn't nil.
+func (c *Config) upload(endpoint string, name string, file io.Reader, meta *TextMeta) (*http.Response, error) {
 
 	buf := bufs.GetBuffer()
 	defer bufs.PutBuffer(buf)
 
 	w := multipart.NewWriter(buf)
 
+	if meta != nil {
+		dat, err := json.Marshal(meta.uploadFields())
+		if err != nil {
+			return nil, err
+		}
+		if err = w.WriteField("metadata", string(dat)); err != nil {
+			return nil, err
+		}
+	}
+
 	fw, err := w.CreateFormFile("file", name)
 	if err != nil {
 		return nil, err
@@ -255,7 +331,7 @@ func (c *Config) upload(endpoint string, name string, file io.Reader) (*http.Res
 		req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(c.APIKey))
 	}
 
-	req.Header.Set("Content-Type", "multipart/form-data")
+	req.Header.Set("Content-Type", w.FormDataContentType())
 	req.Header.Set("Accept", "application/json")
 
 	mu.GetMutex("net").RLock()
@@ -282,5 +358,8 @@ func (c *Config) Validate() error {
 	if err := ar.Err(); err != nil {
 		return err
 	}
+	if _, err = c.EnsureWorkspace(); err != nil {
+		return err
+	}
 	return c.updateSeen()
 }
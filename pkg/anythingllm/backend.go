@@ -0,0 +1,100 @@
+package anythingllm
+
+import (
+	"context"
+
+	"ciascrape/pkg/cia"
+	"ciascrape/pkg/rag"
+)
+
+// Backend stores the scraped documents in an AnythingLLM workspace.
+type Backend struct {
+	c *Config
+}
+
+var _ rag.Backend = (*Backend)(nil)
+
+func NewBackend(c *Config) *Backend {
+	return &Backend{c: c}
+}
+
+func toRAG(doc *Document) *rag.Document {
+	if doc == nil {
+		return nil
+	}
+	return &rag.Document{ID: doc.ID, Location: doc.Location, URL: doc.URL, Title: doc.Title}
+}
+
+func (b *Backend) Name() string {
+	return "anythingllm"
+}
+
+func (b *Backend) Validate() error {
+	return b.c.Validate()
+}
+
+func (b *Backend) Seen(url string) bool {
+	return b.c.HasSeen(url)
+}
+
+func (b *Backend) UploadText(doc *cia.Document) (*rag.Document, error) {
+	uploaded, err := b.c.UploadDocument(doc)
+	return toRAG(uploaded), err
+}
+
+// UploadFile uploads a PDF, as page ranges stored as the parts of the first if page splitting is on.
+func (b *Backend) UploadFile(url, name string, data []byte) (*rag.Document, error) {
+	uploaded, err := b.c.UploadPDFPages(url, name, data)
+	if err != nil {
+		return nil, err
+	}
+	doc := toRAG(uploaded[0])
+	for _, part := range uploaded[1:] {
+		doc.Parts = append(doc.Parts, toRAG(part))
+	}
+	return doc, nil
+}
+
+// UploadLink has AnythingLLM fetch url, along with the PDFs linked from it.
+func (b *Backend) UploadLink(url string) (*rag.Document, error) {
+	uploaded, err := b.c.UploadLink(url)
+	return toRAG(uploaded), err
+}
+
+// withParts returns docs followed by their parts.
+func withParts(docs []*rag.Document) []*rag.Document {
+	all := make([]*rag.Document, 0, len(docs))
+	for _, doc := range docs {
+		if doc != nil {
+			all = append(all, doc)
+			all = append(all, withParts(doc.Parts)...)
+		}
+	}
+	return all
+}
+
+func (b *Backend) Attach(docs ...*rag.Document) error {
+	for _, doc := range withParts(docs) {
+		if err := b.c.AddDocument(&Document{ID: doc.ID, Location: doc.Location}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (b *Backend) Delete(docs ...*rag.Document) error {
+	docs = withParts(docs)
+	locations := make([]string, 0, len(docs))
+	for _, doc := range docs {
+		locations = append(locations, doc.Location)
+	}
+	return b.c.DeleteDocuments(locations...)
+}
+
+func (b *Backend) Flush(ctx context.Context) error {
+	return b.c.Flush(ctx)
+}
+
+func (b *Backend) Close() error {
+	return b.c.Close()
+}
@@ -0,0 +1,335 @@
+package anythingllm
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"ciascrape/internal/pdftest"
+	"ciascrape/pkg/cia"
+	http2 "ciascrape/pkg/http"
+	"ciascrape/pkg/ocr"
+	"ciascrape/pkg/rag"
+)
+
+func TestBackend_UploadFile(t *testing.T) {
+	var uploaded []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/document/upload" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		f, header, err := r.FormFile("file")
+		if err != nil {
+			t.Errorf("expected a multipart upload, got %v", err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		data, _ := io.ReadAll(f)
+		uploaded = append(uploaded, header.Filename+":"+string(data))
+		_, _ = w.Write([]byte(`{"success": true, "error": null, "documents": [{"id": "1", "title": "doc-1.pdf", "location": "custom-documents/doc-1.pdf-1.json"}]}`))
+	}))
+	defer server.Close()
+
+	var backend rag.Backend = NewBackend(NewConfig().WithEndpoint(server.URL))
+	url := "https://www.cia.gov/readingroom/docs/doc-1.pdf"
+
+	doc, err := backend.UploadFile(url, "doc-1.pdf", []byte("%PDF-1.4"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if doc.Location != "custom-documents/doc-1.pdf-1.json" || len(uploaded) != 1 || uploaded[0] != "doc-1.pdf:%PDF-1.4" {
+		t.Errorf("unexpected upload %v: %+v", uploaded, doc)
+	}
+	if !backend.Seen(url) {
+		t.Error("expected the PDF to be seen after uploading it")
+	}
+	if _, err = backend.UploadFile(url, "doc-1.pdf", []byte("%PDF-1.4")); !errors.Is(err, rag.ErrDuplicate) {
+		t.Errorf("expected %v, got %v", rag.ErrDuplicate, err)
+	}
+}
+
+// textPDF returns a single page PDF with a text layer.
+func textPDF(text string) []byte {
+	return pdftest.Build(
+		`<< /Type /Catalog /Pages 2 0 R >>`,
+		`<< /Type /Pages /Kids [3 0 R] /Count 1 >>`,
+		`<< /Type /Page /Parent 2 0 R /MediaBox [0 0 612 792] /Contents 4 0 R >>`,
+		pdftest.Stream("", []byte(fmt.Sprintf("BT /F1 12 Tf 72 720 Td (%s) Tj ET", text))),
+	)
+}
+
+func TestUploadPDF_TextFallback(t *testing.T) {
+	var uploaded []RawText
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/document/upload":
+			w.WriteHeader(http.StatusInternalServerError)
+			_, _ = w.Write([]byte(`{"success": false, "error": "No text content found in doc-1.pdf"}`))
+		case "/v1/document/raw-text":
+			rt := RawText{}
+			_ = json.NewDecoder(r.Body).Decode(&rt)
+			uploaded = append(uploaded, rt)
+			_, _ = w.Write([]byte(`{"success":true,"documents":[{"id":"1","location":"custom-documents/raw-doc-1.json"}]}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	c := NewConfig().WithEndpoint(server.URL)
+	url := "https://www.cia.gov/readingroom/docs/doc-1.pdf"
+	doc, err := c.UploadPDF(url, "doc-1.pdf", textPDF("MEMORANDUM FOR THE DIRECTOR"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if doc.Location != "custom-documents/raw-doc-1.json" || len(uploaded) != 1 {
+		t.Fatalf("expected the text to be uploaded as raw text, got %+v", doc)
+	}
+	if uploaded[0].TextContent != "MEMORANDUM FOR THE DIRECTOR" || uploaded[0].Metadata.Url != url {
+		t.Errorf("unexpected upload: %+v", uploaded[0])
+	}
+
+	// scans without a text layer or keywords can't be uploaded
+	if _, err = c.UploadPDF(url+"-scan", "scan.pdf", []byte("%PDF-1.4")); err == nil {
+		t.Error("expected an error for a PDF without text")
+	}
+}
+
+func TestUploadPDF_Metadata(t *testing.T) {
+	var (
+		metadata []map[string]string
+		uploaded []RawText
+		fail     bool
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/document/upload":
+			m := make(map[string]string)
+			if err := json.Unmarshal([]byte(r.FormValue("metadata")), &m); err != nil {
+				t.Errorf("expected the metadata form field to be JSON, got %v", err)
+			}
+			metadata = append(metadata, m)
+			if fail {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			_, _ = w.Write([]byte(`{"success": true, "documents": [{"id": "1", "location": "custom-documents/memo.pdf-1.json"}]}`))
+		case "/v1/document/raw-text":
+			rt := RawText{}
+			_ = json.NewDecoder(r.Body).Decode(&rt)
+			uploaded = append(uploaded, rt)
+			_, _ = w.Write([]byte(`{"success":true,"documents":[{"id":"2","location":"custom-documents/raw-memo.json"}]}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	data := pdftest.BuildTrailer("/Info 5 0 R",
+		`<< /Type /Catalog /Pages 2 0 R >>`,
+		`<< /Type /Pages /Kids [3 0 R] /Count 1 >>`,
+		`<< /Type /Page /Parent 2 0 R /MediaBox [0 0 612 792] /Contents 4 0 R >>`,
+		pdftest.Stream("", []byte("BT /F1 12 Tf 72 720 Td (MEMORANDUM) Tj ET")),
+		`<< /Author (Directorate of Intelligence) /Subject (Soviet Union) /Producer (Adobe Acrobat 9.0)
+		/CreationDate (D:19751104120000Z) >>`,
+	)
+	c := NewConfig().WithEndpoint(server.URL)
+	url := "https://www.cia.gov/readingroom/docs/memo.pdf"
+
+	if _, err := c.UploadPDF(url, "memo.pdf", data); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"title":       "memo.pdf",
+		"docAuthor":   "Directorate of Intelligence",
+		"description": "Soviet Union, 1 pages, produced by Adobe Acrobat 9.0",
+		"docSource":   rag.ReadingRoomSource,
+		"chunkSource": "link://" + url,
+		"published":   "November 4, 1975",
+	}
+	if len(metadata) != 1 || fmt.Sprint(metadata[0]) != fmt.Sprint(want) {
+		t.Errorf("expected the file upload to carry %v, got %v", want, metadata)
+	}
+
+	// the raw text fallback gets the same metadata, and every property in etc
+	fail = true
+	if _, err := c.UploadPDF(url+"?2", "memo.pdf", data); err != nil {
+		t.Fatal(err)
+	}
+	if len(uploaded) != 1 {
+		t.Fatalf("expected the text to be uploaded as raw text, got %+v", uploaded)
+	}
+	meta := uploaded[0].Metadata
+	if meta.DocAuthor != want["docAuthor"] || meta.Published != want["published"] || meta.Description != want["description"] {
+		t.Errorf("unexpected metadata: %+v", meta)
+	}
+	etc := make(map[string]string)
+	if err := json.Unmarshal([]byte(meta.Etc), &etc); err != nil || etc["PDF Created"] != "1975-11-04T12:00:00Z" || etc["PDF Pages"] != "1" || etc["PDF Producer"] != "Adobe Acrobat 9.0" {
+		t.Errorf("unexpected etc: %s", meta.Etc)
+	}
+}
+
+func TestUploadPDF_OCRFallback(t *testing.T) {
+	var uploaded []RawText
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/document/upload":
+			w.WriteHeader(http.StatusInternalServerError)
+		case "/v1/document/raw-text":
+			rt := RawText{}
+			_ = json.NewDecoder(r.Body).Decode(&rt)
+			uploaded = append(uploaded, rt)
+			_, _ = w.Write([]byte(`{"success":true,"documents":[{"id":"1","location":"custom-documents/raw-scan.json"}]}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	// a stand-in for tesseract, answering with TSV for the image it is given
+	command := `test -s "$1" && printf 'level\tpage_num\tblock_num\tpar_num\tline_num\tword_num\tleft\ttop\twidth\theight\tconf\ttext\n5\t1\t1\t1\t1\t1\t0\t0\t1\t1\t91\tSTARGATE\n'`
+	c := NewConfig().WithEndpoint(server.URL).WithOCR(ocr.NewOCR(command))
+	url := "https://www.cia.gov/readingroom/docs/scan.pdf"
+	if _, err := c.UploadPDF(url, "scan.pdf", pdftest.Scanned(1)); err != nil {
+		t.Fatal(err)
+	}
+	if len(uploaded) != 1 || uploaded[0].TextContent != "STARGATE" {
+		t.Errorf("expected the OCR text to be uploaded, got %+v", uploaded)
+	}
+}
+
+// pagesPDF returns a PDF with a page per text, pages with an empty text having no text layer.
+func pagesPDF(texts ...string) []byte {
+	kids := make([]string, len(texts))
+	objects := []string{`<< /Type /Catalog /Pages 2 0 R >>`, ""}
+	for i, text := range texts {
+		page := 3 + 2*i
+		kids[i] = fmt.Sprintf("%d 0 R", page)
+		objects = append(objects,
+			fmt.Sprintf(`<< /Type /Page /Parent 2 0 R /MediaBox [0 0 612 792] /Contents %d 0 R >>`, page+1),
+			pdftest.Stream("", []byte(fmt.Sprintf("BT /F1 12 Tf 72 720 Td (%s) Tj ET", text))),
+		)
+		if text == "" {
+			objects[len(objects)-1] = pdftest.Stream("", nil)
+		}
+	}
+	objects[1] = fmt.Sprintf(`<< /Type /Pages /Kids [%s] /Count %d >>`, strings.Join(kids, " "), len(texts))
+	return pdftest.Build(objects...)
+}
+
+func TestBackend_PageSplit(t *testing.T) {
+	var (
+		uploaded []RawText
+		removed  []string
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/document/raw-text":
+			rt := RawText{}
+			_ = json.NewDecoder(r.Body).Decode(&rt)
+			uploaded = append(uploaded, rt)
+			_, _ = fmt.Fprintf(w, `{"success":true,"documents":[{"id":"%d","location":"custom-documents/raw-%d.json"}]}`, len(uploaded), len(uploaded))
+		case "/v1/system/remove-documents":
+			rd := RemoveDocument{}
+			_ = json.NewDecoder(r.Body).Decode(&rd)
+			removed = append(removed, rd.Names...)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	backend := NewBackend(NewConfig().WithEndpoint(server.URL).WithPageSplit(2))
+	page := testDocument()
+	pdf := "https://www.cia.gov/readingroom/docs/CIA-RDP96-00788R001200410003-2.pdf"
+	page.Attachments = []string{pdf}
+	if _, err := backend.UploadText(page); err != nil {
+		t.Fatal(err)
+	}
+	uploaded = nil
+
+	doc, err := backend.UploadFile(pdf, "CIA-RDP96-00788R001200410003-2.pdf", pagesPDF("MEMORANDUM", "", "TASK FORCE", "STARGATE", "ANNEX"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(uploaded) != 3 || doc.Location != "custom-documents/raw-1.json" || len(doc.Parts) != 2 {
+		t.Fatalf("expected 3 page ranges, got %+v and %+v", uploaded, doc)
+	}
+	for i, want := range []struct{ url, title, text string }{
+		{pdf + "#page=1", "CIA-RDP96-00788R001200410003-2.pdf (page 1)", "MEMORANDUM"},
+		{pdf + "#page=3", "CIA-RDP96-00788R001200410003-2.pdf (pages 3-4)", "[page 3]\nTASK FORCE\n\n[page 4]\nSTARGATE"},
+		{pdf + "#page=5", "CIA-RDP96-00788R001200410003-2.pdf (page 5)", "ANNEX"},
+	} {
+		meta := uploaded[i].Metadata
+		if meta.Url != want.url || meta.ChunkSource != "link://"+want.url || meta.Title != want.title || uploaded[i].TextContent != want.text {
+			t.Errorf("unexpected page range %d: %+v", i, uploaded[i])
+		}
+		if meta.ParentUrl != page.URL || meta.PdfUrl != pdf {
+			t.Errorf("expected page range %d to cite %s and %s, got %+v", i, page.URL, pdf, meta)
+		}
+	}
+	if link := (ChatSource{ChunkSource: uploaded[1].Metadata.ChunkSource}).Link(); link != pdf+"#page=3" {
+		t.Errorf("expected citations to keep the page, got %s", link)
+	}
+	if !backend.Seen(pdf) {
+		t.Error("expected the PDF to be seen after uploading its pages")
+	}
+
+	if err = backend.Delete(doc); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(removed, " ") != "custom-documents/raw-1.json custom-documents/raw-2.json custom-documents/raw-3.json" {
+		t.Errorf("expected every page range to be removed, got %v", removed)
+	}
+}
+
+func TestSeekPDF(t *testing.T) {
+	var (
+		denied   atomic.Int32
+		requests []string
+		mu       sync.Mutex
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests = append(requests, r.Method+" "+r.URL.Path)
+		mu.Unlock()
+		switch {
+		case denied.Add(1) == 1:
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+		case r.URL.Path == "/readingroom/docs/DOC-1.pdf":
+			w.Header().Set("Content-Type", "application/pdf")
+			_, _ = w.Write([]byte("%PDF-1.4"))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+	cia.Client.WithLimiter(http2.NewLimiter(1000, 1000))
+
+	link := server.URL + "/readingroom/docs/doc-1.pdf"
+	data, err := seekPDF("seek", link, &cia.PDFLocation{URL: server.URL + "/readingroom/docs/DOC-1.pdf"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "%PDF-1.4" || len(requests) != 2 || requests[0] != "GET /readingroom/docs/DOC-1.pdf" || requests[1] != requests[0] {
+		t.Errorf("expected the resolved PDF to be fetched again after the denial without probing, got %q after %v", data, requests)
+	}
+
+	// a PDF gone from where it was resolved to is looked for again
+	requests = nil
+	if data, err = seekPDF("seek", link, &cia.PDFLocation{URL: link}); err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "%PDF-1.4" || requests[0] != "GET /readingroom/docs/doc-1.pdf" || requests[len(requests)-1] != "GET /readingroom/docs/DOC-1.pdf" {
+		t.Errorf("expected the PDF to be resolved again, got %q after %v", data, requests)
+	}
+}
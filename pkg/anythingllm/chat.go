@@ -0,0 +1,205 @@
+package anythingllm
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"ciascrape/pkg/mu"
+
+	http2 "ciascrape/pkg/http"
+)
+
+type ChatRequest struct {
+	Message   string `json:"message"`
+	Mode      string `json:"mode"`
+	SessionID string `json:"sessionId,omitempty"`
+}
+
+// ChatSource is a chunk of an embedded document the answer of a chat was based on.
+type ChatSource struct {
+	ID          string  `json:"id"`
+	URL         string  `json:"url"`
+	Title       string  `json:"title"`
+	DocAuthor   string  `json:"docAuthor"`
+	Description string  `json:"description"`
+	DocSource   string  `json:"docSource"`
+	ChunkSource string  `json:"chunkSource"`
+	Published   string  `json:"published"`
+	Text        string  `json:"text"`
+	Score       float64 `json:"score"`
+}
+
+// Link returns the reading room URL the source was scraped from, as stored in its URL or chunk source,
+// or "" if the document does not carry one.
+func (s ChatSource) Link() string {
+	for _, candidate := range []string{s.URL, strings.TrimPrefix(s.ChunkSource, "link://")} {
+		if u, err := url.Parse(candidate); err == nil && (u.Scheme == "http" || u.Scheme == "https") {
+			return candidate
+		}
+	}
+	return ""
+}
+
+type ChatResponse struct {
+	ID           string       `json:"id"`
+	Type         string       `json:"type"`
+	TextResponse string       `json:"textResponse"`
+	Sources      []ChatSource `json:"sources"`
+	Close        bool         `json:"close"`
+	Error        interface{}  `json:"error"`
+}
+
+var ErrChat = errors.New("chat failed")
+
+// Err returns the error AnythingLLM reported, which is null or false when there is none.
+func (r *ChatResponse) Err() error {
+	switch e := r.Error.(type) {
+	case nil:
+		return nil
+	case bool:
+		if !e {
+			return nil
+		}
+	case string:
+		if e == "" {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %v", ErrChat, r.Error)
+}
+
+// Links returns the distinct URLs of the documents cited by the response, in order of appearance.
+func (r *ChatResponse) Links() []string {
+	seen := make(map[string]bool)
+	var links []string
+	for _, source := range r.Sources {
+		link := source.Link()
+		if link == "" || seen[link] {
+			continue
+		}
+		seen[link] = true
+		links = append(links, link)
+	}
+	return links
+}
+
+func (c *Config) chatRequest(endpoint, mode, message string) (*http.Request, error) {
+	if strings.TrimSpace(message) == "" {
+		return nil, fmt.Errorf("%w: empty message", ErrChat)
+	}
+	if mode != ChatModeChat && mode != ChatModeQuery {
+		return nil, fmt.Errorf("%w: '%s'", ErrInvalidChatMode, mode)
+	}
+	dat, err := json.Marshal(&ChatRequest{Message: message, Mode: mode})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(http.MethodPost, c.Endpoint+"v1/workspace/"+url.PathEscape(c.Workspace)+"/"+endpoint, bytes.NewReader(dat))
+	if err != nil {
+		return nil, err
+	}
+	if c.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(c.APIKey))
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return req, nil
+}
+
+func (c *Config) chat(mode, message string) (*ChatResponse, error) {
+	req, err := c.chatRequest("chat", mode, message)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	mu.GetMutex("net").RLock()
+	res, err := http2.DefaultClient.Do(req)
+	mu.GetMutex("net").RUnlock()
+	if err != nil {
+		return nil, err
+	}
+	cr := &ChatResponse{}
+	if err = readJSON(res, cr); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrChat, err)
+	}
+	return cr, cr.Err()
+}
+
+// Chat asks the workspace a question in chat mode, where the model may answer from its own knowledge too.
+func (c *Config) Chat(message string) (*ChatResponse, error) {
+	return c.chat(ChatModeChat, message)
+}
+
+// Query asks the workspace a question in query mode, where only the embedded documents are used.
+func (c *Config) Query(message string) (*ChatResponse, error) {
+	return c.chat(ChatModeQuery, message)
+}
+
+// StreamChat asks the workspace a question in the given mode, handing each piece of the answer to fn as
+// it is generated. The returned response holds the whole answer and its sources.
+func (c *Config) StreamChat(mode, message string, fn func(text string)) (*ChatResponse, error) {
+	req, err := c.chatRequest("stream-chat", mode, message)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	mu.GetMutex("net").RLock()
+	res, err := http2.DefaultClient.Do(req)
+	mu.GetMutex("net").RUnlock()
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = res.Body.Close()
+	}()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%w: bad status code: %s", ErrChat, res.Status)
+	}
+
+	full := &ChatResponse{}
+	text := &strings.Builder{}
+	scanner := bufio.NewScanner(res.Body)
+	scanner.Buffer(make([]byte, 0, 64*1024), 4*1024*1024)
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data:")
+		if !ok || strings.TrimSpace(data) == "" {
+			continue
+		}
+		chunk := &ChatResponse{}
+		if err = json.Unmarshal([]byte(data), chunk); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrUnmarshal, err)
+		}
+		if err = chunk.Err(); err != nil {
+			return nil, err
+		}
+		if full.ID == "" {
+			full.ID = chunk.ID
+		}
+		if chunk.Type == "abort" {
+			return nil, fmt.Errorf("%w: aborted", ErrChat)
+		}
+		if chunk.TextResponse != "" {
+			text.WriteString(chunk.TextResponse)
+			if fn != nil {
+				fn(chunk.TextResponse)
+			}
+		}
+		full.Sources = append(full.Sources, chunk.Sources...)
+		if chunk.Close {
+			break
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrChat, err)
+	}
+
+	full.Type = "textResponse"
+	full.TextResponse = text.String()
+	full.Close = true
+	return full, nil
+}
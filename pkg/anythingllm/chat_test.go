@@ -0,0 +1,107 @@
+package anythingllm
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func newChatServer(t *testing.T, handler http.HandlerFunc) *Config {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	return NewConfig().WithEndpoint(server.URL + "/").WithAPIKey("testKey").WithWorkspace("stargate")
+}
+
+var testSources = []ChatSource{
+	{Title: "(TAB A) TASK FORCE", URL: "https://www.cia.gov/readingroom/document/cia-rdp96-00788r001200410003-2"},
+	{Title: "raw text", URL: "file:///docs/raw.json", ChunkSource: "link://https://www.cia.gov/readingroom/document/cia-rdp96-00788r001200410003-2"},
+	{Title: "CIA-RDP96-00788R001200410003-2.pdf", URL: "file:///docs/CIA-RDP96-00788R001200410003-2.pdf", ChunkSource: "link://https://www.cia.gov/readingroom/docs/CIA-RDP96-00788R001200410003-2.pdf"},
+	{Title: "CIA-RDP96-00788R001200410004-1.pdf", URL: "file:///docs/CIA-RDP96-00788R001200410004-1.pdf", ChunkSource: "localfile://CIA-RDP96-00788R001200410004-1.pdf"},
+	{Title: "unknown"},
+}
+
+func TestQuery(t *testing.T) {
+	c := newChatServer(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/workspace/stargate/chat" || r.Header.Get("Authorization") != "Bearer testKey" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		req := &ChatRequest{}
+		_ = json.NewDecoder(r.Body).Decode(req)
+		_ = json.NewEncoder(w).Encode(&ChatResponse{
+			ID: "1", Type: "textResponse", Close: true,
+			TextResponse: req.Mode + ": " + req.Message,
+			Sources:      testSources,
+		})
+	})
+
+	res, err := c.Query("what is stargate?")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.TextResponse != "query: what is stargate?" {
+		t.Errorf("unexpected answer %q", res.TextResponse)
+	}
+	links := res.Links()
+	expected := []string{
+		"https://www.cia.gov/readingroom/document/cia-rdp96-00788r001200410003-2",
+		"https://www.cia.gov/readingroom/docs/CIA-RDP96-00788R001200410003-2.pdf",
+	}
+	if strings.Join(links, " ") != strings.Join(expected, " ") {
+		t.Errorf("expected links %v, got %v", expected, links)
+	}
+
+	if res, err = c.Chat("hello"); err != nil || res.TextResponse != "chat: hello" {
+		t.Errorf("unexpected chat response %+v: %v", res, err)
+	}
+}
+
+func TestQuery_Error(t *testing.T) {
+	c := newChatServer(t, func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"id": "1", "type": "abort", "textResponse": null, "sources": [], "close": true, "error": "No LLM provider"}`))
+	})
+	if _, err := c.Query("what is stargate?"); !errors.Is(err, ErrChat) || !strings.Contains(err.Error(), "No LLM provider") {
+		t.Errorf("expected %v, got %v", ErrChat, err)
+	}
+}
+
+func TestStreamChat(t *testing.T) {
+	c := newChatServer(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/workspace/stargate/stream-chat" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		for i, text := range []string{"remote ", "viewing"} {
+			_, _ = fmt.Fprintf(w, "data: {\"id\": \"1\", \"type\": \"textResponseChunk\", \"textResponse\": %q, \"close\": false, \"error\": false}\n\n", text)
+			if i == 0 {
+				w.(http.Flusher).Flush()
+			}
+		}
+		sources, _ := json.Marshal(testSources[:1])
+		_, _ = fmt.Fprintf(w, "data: {\"id\": \"1\", \"type\": \"textResponseChunk\", \"textResponse\": \"\", \"sources\": %s, \"close\": true, \"error\": false}\n\n", sources)
+	})
+
+	var streamed []string
+	res, err := c.StreamChat(ChatModeQuery, "what is stargate?", func(text string) {
+		streamed = append(streamed, text)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(streamed) != 2 || res.TextResponse != "remote viewing" {
+		t.Errorf("unexpected answer %q streamed as %q", res.TextResponse, streamed)
+	}
+	if len(res.Links()) != 1 {
+		t.Errorf("expected 1 link, got %v", res.Links())
+	}
+
+	if _, err = c.StreamChat("gossip", "what is stargate?", nil); !errors.Is(err, ErrInvalidChatMode) {
+		t.Errorf("expected %v, got %v", ErrInvalidChatMode, err)
+	}
+}
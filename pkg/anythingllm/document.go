@@ -2,17 +2,24 @@ package anythingllm
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
+	neturl "net/url"
+	"strconv"
 	"strings"
+	"time"
 
 	spew2 "github.com/davecgh/go-spew/spew"
 
 	"ciascrape/pkg/bufs"
+	"ciascrape/pkg/cia"
+	"ciascrape/pkg/pdftext"
+	"ciascrape/pkg/rag"
 )
 
 type UploadLink struct {
@@ -40,27 +47,109 @@ type UploadLinkResponse struct {
 	Documents []Document  `json:"documents"`
 }
 
-var ErrAccessDenied = errors.New("access denied")
+var ErrAccessDenied = rag.ErrAccessDenied
 
 type RemoveDocument struct {
 	Names []string `json:"names"`
 }
 
+// DeleteDocument removes the document at location (e.g. custom-documents/url-....json) from the library,
+// which also removes it from every workspace it was embedded in.
 func (c *Config) DeleteDocument(location string) error {
-	/*	rd := &RemoveDocument{Names: []string{location}}
-		dat, _ := json.Marshal(rd)
-		res, err := c.delete("v1/system/remove-documents", bytes.NewReader(dat))
-		if err != nil {
-			return err
+	return c.DeleteDocuments(location)
+}
+
+func (c *Config) DeleteDocuments(locations ...string) error {
+	rd := &RemoveDocument{}
+	for _, location := range locations {
+		if strings.TrimSpace(location) != "" {
+			rd.Names = append(rd.Names, location)
 		}
-		if res.StatusCode != http.StatusOK {
-			_ = res.Body.Close()
-			return fmt.Errorf("failed to remove document: %s", http.StatusText(res.StatusCode))
-		}*/
+	}
+	if len(rd.Names) == 0 {
+		return fmt.Errorf("document location is required")
+	}
+	dat, err := json.Marshal(rd)
+	if err != nil {
+		return err
+	}
+	res, err := c.delete("v1/system/remove-documents", bytes.NewReader(dat))
+	if err != nil {
+		return err
+	}
+	_ = res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to remove documents: %s", http.StatusText(res.StatusCode))
+	}
 	return nil
 }
 
-var ErrDuplicate = errors.New("already seen link")
+// GetDocument returns a document of the library, including its content, by its file name.
+func (c *Config) GetDocument(name string) (*Document, error) {
+	res, err := c.get("v1/document/" + neturl.PathEscape(name))
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode == http.StatusNotFound {
+		_ = res.Body.Close()
+		return nil, fmt.Errorf("%w: %s", ErrNoDocuments, name)
+	}
+	dr := struct {
+		Document *Document `json:"document"`
+	}{}
+	if err = readJSON(res, &dr); err != nil {
+		return nil, fmt.Errorf("failed to get document: %w", err)
+	}
+	if dr.Document == nil {
+		return nil, fmt.Errorf("%w: %s", ErrNoDocuments, name)
+	}
+	return dr.Document, nil
+}
+
+// purgeMaxWords is the word count above which a library document can't be a throttle or maintenance page,
+// so its content isn't fetched to check.
+const purgeMaxWords = 500
+
+// ThrottledDocument is a document of the library whose content is a throttle or maintenance page.
+type ThrottledDocument struct {
+	Location string
+	URL      string
+}
+
+// ThrottledDocuments finds the documents of the library that were uploaded while the reading room was
+// throttling us, i.e. whose title or content is an Access Denied or maintenance page.
+func (c *Config) ThrottledDocuments() ([]ThrottledDocument, error) {
+	folders, err := c.GetDocuments()
+	if err != nil {
+		return nil, err
+	}
+	var found []ThrottledDocument
+	for folder, items := range folders {
+		for _, item := range items {
+			if item.Type != "file" {
+				continue
+			}
+			throttled := cia.IsAccessDenied(item.Title)
+			if !throttled && item.WordCount < purgeMaxWords {
+				doc, err := c.GetDocument(item.Name)
+				if err != nil {
+					log.Printf("[err] failed to get document '%s': %v", item.Name, err)
+					continue
+				}
+				throttled = cia.IsAccessDenied(doc.PageContent)
+			}
+			if throttled {
+				found = append(found, ThrottledDocument{
+					Location: folder + "/" + item.Name,
+					URL:      strings.TrimPrefix(item.ChunkSource, "link://"),
+				})
+			}
+		}
+	}
+	return found, nil
+}
+
+var ErrDuplicate = rag.ErrDuplicate
 
 type RawText struct {
 	TextContent string   `json:"textContent"`
@@ -76,6 +165,10 @@ type TextMeta struct {
 	ChunkSource string `json:"chunkSource"`
 	Published   string `json:"published"`
 	Etc         string `json:"etc"`
+	// ParentUrl and PdfUrl are set on the page ranges of a split PDF: the reading room page the PDF is
+	// attached to and the PDF itself, Url being the PDF with a #page=N anchor.
+	ParentUrl string `json:"parentUrl,omitempty"`
+	PdfUrl    string `json:"pdfUrl,omitempty"`
 }
 
 type RawTextResp struct {
@@ -84,6 +177,24 @@ type RawTextResp struct {
 	Documents []Document  `json:"documents"`
 }
 
+// uploadFields returns the metadata set, with the keys the upload endpoint takes metadata by.
+func (m TextMeta) uploadFields() map[string]string {
+	fields := make(map[string]string)
+	for k, v := range map[string]string{
+		"title":       m.Title,
+		"docAuthor":   m.DocAuthor,
+		"description": m.Description,
+		"docSource":   m.DocSource,
+		"chunkSource": m.ChunkSource,
+		"published":   m.Published,
+	} {
+		if v != "" {
+			fields[k] = v
+		}
+	}
+	return fields
+}
+
 func NewRawText(url, name, text string) *RawText {
 	return &RawText{
 		TextContent: text,
@@ -119,11 +230,15 @@ func processRawTextResp(dat []byte) []byte {
 }
 
 func (c *Config) UploadRaw(url, s string) ([]byte, error) {
-	// v1/document/raw-text
+	return c.uploadRaw(NewRawText(url, url, s))
+}
+
+// uploadRaw uploads rt to v1/document/raw-text, returning the response.
+func (c *Config) uploadRaw(rt *RawText) ([]byte, error) {
+	url := rt.Metadata.Url
 	if c.hasSeenURL(url) {
 		return nil, ErrDuplicate
 	}
-	rt := NewRawText(url, url, s)
 	dat, err := json.Marshal(rt)
 	if err != nil {
 		return nil, err
@@ -144,7 +259,7 @@ func (c *Config) UploadRaw(url, s string) ([]byte, error) {
 		return nil, fmt.Errorf("failed to upload raw text, nil response: %s", err)
 	}
 
-	log.Printf("uploaded raw text (status: %d): %s", url, res.StatusCode)
+	log.Printf("uploaded raw text (status: %d): %s", res.StatusCode, url)
 
 	if res.StatusCode == http.StatusOK && res.Body != nil {
 		buf := bufs.GetBuffer()
@@ -169,6 +284,168 @@ func (c *Config) UploadRaw(url, s string) ([]byte, error) {
 	return processRawTextResp(data), err
 }
 
+const readingRoomAuthor = "Central Intelligence Agency"
+
+// NewDocumentRawText turns a document we fetched from the reading room ourselves into a raw-text upload
+// with its CREST metadata filled in.
+func NewDocumentRawText(doc *cia.Document) *RawText {
+	rt := NewRawText(doc.URL, doc.Title, doc.Text())
+	rt.Metadata.DocAuthor = readingRoomAuthor
+	rt.Metadata.DocSource = rag.ReadingRoomSource
+	rt.Metadata.ChunkSource = "link://" + doc.URL
+
+	for _, date := range []string{doc.PublicationDate, doc.ReleaseDate, doc.CreationDate} {
+		if date != "" {
+			rt.Metadata.Published = date
+			break
+		}
+	}
+
+	var description []string
+	for _, part := range [][2]string{
+		{"", doc.DocumentType},
+		{"document ", doc.DocumentNumber},
+		{"collection ", doc.Collection},
+		{"released ", doc.ReleaseDate},
+		{"release decision ", doc.ReleaseDecision},
+		{"classification ", doc.OriginalClassification},
+	} {
+		if part[1] != "" {
+			description = append(description, part[0]+part[1])
+		}
+	}
+	if doc.PageCount > 0 {
+		description = append(description, fmt.Sprintf("%d pages", doc.PageCount))
+	}
+	rt.Metadata.Description = strings.Join(description, ", ")
+
+	if len(doc.Fields) > 0 {
+		if etc, err := json.Marshal(doc.Fields); err == nil {
+			rt.Metadata.Etc = string(etc)
+		}
+	}
+
+	return rt
+}
+
+// pdfDateLayout is how the reading room writes dates, which the dates of PDFs are written like.
+const pdfDateLayout = "January 2, 2006"
+
+// withPDFInfo merges the properties of a PDF, info, into the metadata of rt: the author and creation date
+// unless it has them, the subject, page count and producer into the description and all of them into Etc.
+func (rt *RawText) withPDFInfo(info *pdftext.Info) *RawText {
+	if info == nil {
+		return rt
+	}
+	m := &rt.Metadata
+	if m.DocAuthor == "" {
+		m.DocAuthor = info.Author
+	}
+	if m.Published == "" && !info.Created.IsZero() {
+		m.Published = info.Created.Format(pdfDateLayout)
+	}
+
+	var description []string
+	if m.Description != "" {
+		description = append(description, m.Description)
+	}
+	if info.Subject != "" {
+		description = append(description, info.Subject)
+	}
+	if info.PageCount > 0 {
+		description = append(description, fmt.Sprintf("%d pages", info.PageCount))
+	}
+	if info.Producer != "" {
+		description = append(description, "produced by "+info.Producer)
+	}
+	m.Description = strings.Join(description, ", ")
+
+	etc := make(map[string]string)
+	if m.Etc != "" && json.Unmarshal([]byte(m.Etc), &etc) != nil {
+		etc = map[string]string{"etc": m.Etc}
+	}
+	props := map[string]string{
+		"PDF Title":    info.Title,
+		"PDF Author":   info.Author,
+		"PDF Subject":  info.Subject,
+		"PDF Keywords": info.Keywords,
+		"PDF Creator":  info.Creator,
+		"PDF Producer": info.Producer,
+	}
+	if !info.Created.IsZero() {
+		props["PDF Created"] = info.Created.Format(time.RFC3339)
+	}
+	if !info.Modified.IsZero() {
+		props["PDF Modified"] = info.Modified.Format(time.RFC3339)
+	}
+	if info.PageCount > 0 {
+		props["PDF Pages"] = strconv.Itoa(info.PageCount)
+	}
+	for k, v := range props {
+		if v != "" {
+			etc[k] = v
+		}
+	}
+	if len(etc) > 0 {
+		if dat, err := json.Marshal(etc); err == nil {
+			m.Etc = string(dat)
+		}
+	}
+	return rt
+}
+
+// UploadDocument uploads a document we fetched from the reading room ourselves as a raw-text document.
+func (c *Config) UploadDocument(doc *cia.Document) (*Document, error) {
+	if c.hasSeenURL(doc.URL) {
+		return nil, ErrDuplicate
+	}
+	if rag.IsAccessDenied(doc) {
+		return nil, ErrAccessDenied
+	}
+
+	uploaded, err := c.uploadRawText(NewDocumentRawText(doc))
+	if err != nil {
+		return nil, err
+	}
+
+	c.markSeenURL(doc.URL)
+	c.mu.Lock()
+	for _, pdf := range doc.PDFs() {
+		c.parents[pdf] = doc.URL
+	}
+	c.mu.Unlock()
+
+	return uploaded, nil
+}
+
+func (c *Config) uploadRawText(rt *RawText) (*Document, error) {
+	dat, err := json.Marshal(rt)
+	if err != nil {
+		return nil, err
+	}
+	res, err := c.post("v1/document/raw-text", bytes.NewReader(dat))
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode != http.StatusOK {
+		_ = res.Body.Close()
+		return nil, fmt.Errorf("failed to upload raw text: %s", http.StatusText(res.StatusCode))
+	}
+	rtr := &RawTextResp{}
+	data, err := io.ReadAll(res.Body)
+	_ = res.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+	if err = json.Unmarshal(data, rtr); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+	if len(rtr.Documents) == 0 {
+		return nil, errors.New("no documents uploaded")
+	}
+	return &rtr.Documents[0], nil
+}
+
 func (c *Config) UploadLink(s string) (*Document, error) {
 
 	if c.hasSeenURL(s) {
@@ -177,6 +454,11 @@ func (c *Config) UploadLink(s string) (*Document, error) {
 
 	c.markSeenURL(s)
 
+	// AnythingLLM fetches the link from the reading room itself, so it is paced like our own requests
+	if err := cia.Client.Limiter().Wait(context.Background()); err != nil {
+		return nil, err
+	}
+
 	l := &UploadLink{Link: s}
 	dat, _ := json.Marshal(l)
 	strings.NewReader(s)
@@ -203,14 +485,16 @@ func (c *Config) UploadLink(s string) (*Document, error) {
 
 	if strings.HasPrefix(up.Documents[0].PageContent, "Access Denied") ||
 		strings.Contains(up.Documents[0].PageContent, "the link you are trying to access is undergoing scheduled maintenance") {
-		if strings.TrimSpace(c.mullvadFIFO) != "" {
-			if err = WriteToFIFO(c.mullvadFIFO); err != nil {
-				log.Printf("[err][mullvad-fifo] failed to signal FIFO at '%s'", c.mullvadFIFO)
-			}
+		// let the link be retried once the throttling is over
+		c.unmarkSeenURL(s)
+		if err = cia.Client.Throttled(context.Background(), nil); err != nil {
+			log.Printf("[err] failed to rotate address: %v", err)
 		}
 		return &up.Documents[0], ErrAccessDenied
 	}
 
+	cia.Client.Limiter().Increase()
+
 	if strings.Contains(up.Documents[0].PageContent, ".pdf") || strings.Contains(up.Documents[0].PageContent, ".PDF") {
 		if err := c.GetPDFLinks(s); err != nil {
 			log.Printf(err.Error())
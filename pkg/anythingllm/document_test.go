@@ -0,0 +1,156 @@
+package anythingllm
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"ciascrape/pkg/cia"
+)
+
+func testDocument() *cia.Document {
+	return &cia.Document{
+		URL:             "https://www.cia.gov/readingroom/document/cia-rdp96-00788r001200410003-2",
+		Title:           "(TAB A) TASK FORCE",
+		DocumentType:    "CREST",
+		Collection:      "STARGATE",
+		DocumentNumber:  "CIA-RDP96-00788R001200410003-2",
+		ReleaseDecision: "RIFPUB",
+		PageCount:       2,
+		PublicationDate: "November 8, 1995",
+		Body:            "TASK FORCE",
+		Fields:          map[string]string{"Collection": "STARGATE"},
+	}
+}
+
+func TestNewDocumentRawText(t *testing.T) {
+	rt := NewDocumentRawText(testDocument())
+	meta := rt.Metadata
+	if meta.Url != testDocument().URL || meta.ChunkSource != "link://"+testDocument().URL {
+		t.Errorf("unexpected url or chunk source: %+v", meta)
+	}
+	if meta.Published != "November 8, 1995" || meta.DocAuthor == "" || meta.DocSource == "" {
+		t.Errorf("unexpected metadata: %+v", meta)
+	}
+	expected := "CREST, document CIA-RDP96-00788R001200410003-2, collection STARGATE, release decision RIFPUB, 2 pages"
+	if meta.Description != expected {
+		t.Errorf("expected description %q, got %q", expected, meta.Description)
+	}
+	if meta.Etc != `{"Collection":"STARGATE"}` {
+		t.Errorf("unexpected etc: %s", meta.Etc)
+	}
+}
+
+func TestUploadDocument(t *testing.T) {
+	var uploaded []RawText
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/document/raw-text" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		rt := RawText{}
+		_ = json.NewDecoder(r.Body).Decode(&rt)
+		uploaded = append(uploaded, rt)
+		_, _ = w.Write([]byte(`{"success":true,"documents":[{"id":"1","location":"custom-documents/raw-task-force.json"}]}`))
+	}))
+	defer server.Close()
+
+	c := NewConfig().WithEndpoint(server.URL + "/api")
+
+	denied := testDocument()
+	denied.URL += "-denied"
+	denied.Title = "Access Denied"
+	if _, err := c.UploadDocument(denied); !errors.Is(err, ErrAccessDenied) {
+		t.Errorf("expected %v, got %v", ErrAccessDenied, err)
+	}
+
+	doc, err := c.UploadDocument(testDocument())
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if doc.Location != "custom-documents/raw-task-force.json" {
+		t.Errorf("unexpected document: %+v", doc)
+	}
+	if _, err = c.UploadDocument(testDocument()); !errors.Is(err, ErrDuplicate) {
+		t.Errorf("expected %v, got %v", ErrDuplicate, err)
+	}
+
+	if len(uploaded) != 1 {
+		t.Fatalf("expected exactly one upload, got %d", len(uploaded))
+	}
+	if uploaded[0].Metadata.Title != "(TAB A) TASK FORCE" || uploaded[0].TextContent == "" {
+		t.Errorf("unexpected upload: %+v", uploaded[0])
+	}
+}
+
+// fakeLibrary serves a document library with one real document and two throttle pages.
+func fakeLibrary(t *testing.T, removed *[]string) *Config {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v1/documents":
+			_, _ = w.Write([]byte(`{"localFiles": {"name": "documents", "type": "folder", "items": [
+				{"name": "custom-documents", "type": "folder", "items": [
+					{"name": "url-denied-1.json", "type": "file", "title": "Access Denied", "chunkSource": "link://https://www.cia.gov/readingroom/document/a"},
+					{"name": "url-maintenance-2.json", "type": "file", "title": "www.cia.gov", "wordCount": 12, "chunkSource": "link://https://www.cia.gov/readingroom/document/b"},
+					{"name": "url-real-3.json", "type": "file", "title": "TASK FORCE", "wordCount": 40, "chunkSource": "link://https://www.cia.gov/readingroom/document/c"},
+					{"name": "url-long-4.json", "type": "file", "title": "LONG", "wordCount": 5000, "chunkSource": "link://https://www.cia.gov/readingroom/document/d"}
+				]}
+			]}}`))
+		case "/api/v1/document/url-maintenance-2.json":
+			_, _ = w.Write([]byte(`{"document": {"pageContent": "Sorry, the link you are trying to access is undergoing scheduled maintenance"}}`))
+		case "/api/v1/document/url-real-3.json":
+			_, _ = w.Write([]byte(`{"document": {"pageContent": "TASK FORCE"}}`))
+		case "/api/v1/system/remove-documents":
+			if r.Method != http.MethodDelete {
+				w.WriteHeader(http.StatusMethodNotAllowed)
+				return
+			}
+			rd := &RemoveDocument{}
+			_ = json.NewDecoder(r.Body).Decode(rd)
+			*removed = append(*removed, rd.Names...)
+			_, _ = w.Write([]byte(`{"success": true, "message": "Documents removed successfully"}`))
+		default:
+			t.Errorf("unexpected request: %s %s", r.Method, r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return NewConfig().WithEndpoint(server.URL + "/api")
+}
+
+func TestThrottledDocuments(t *testing.T) {
+	var removed []string
+	c := fakeLibrary(t, &removed)
+
+	docs, err := c.ThrottledDocuments()
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := make(map[string]string)
+	for _, doc := range docs {
+		found[doc.Location] = doc.URL
+	}
+	if len(found) != 2 ||
+		found["custom-documents/url-denied-1.json"] != "https://www.cia.gov/readingroom/document/a" ||
+		found["custom-documents/url-maintenance-2.json"] != "https://www.cia.gov/readingroom/document/b" {
+		t.Errorf("unexpected throttled documents: %v", docs)
+	}
+}
+
+func TestDeleteDocuments(t *testing.T) {
+	var removed []string
+	c := fakeLibrary(t, &removed)
+
+	if err := c.DeleteDocument(""); err == nil {
+		t.Error("expected an error for an empty location")
+	}
+	if err := c.DeleteDocuments("custom-documents/a.json", "", "custom-documents/b.json"); err != nil {
+		t.Fatal(err)
+	}
+	if len(removed) != 2 || removed[0] != "custom-documents/a.json" || removed[1] != "custom-documents/b.json" {
+		t.Errorf("unexpected removed documents: %v", removed)
+	}
+}
@@ -0,0 +1,176 @@
+package anythingllm
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"ciascrape/pkg/ocr"
+	"ciascrape/pkg/pdftext"
+	"ciascrape/pkg/rag"
+)
+
+// pageAnchor is the fragment PDF viewers open a PDF at a given page with.
+const pageAnchor = "#page="
+
+// pageRange is the text of consecutive pages of a PDF, First to Last.
+type pageRange struct {
+	First int
+	Last  int
+	Text  string
+}
+
+func (r pageRange) String() string {
+	if r.First == r.Last {
+		return fmt.Sprintf("page %d", r.First)
+	}
+	return fmt.Sprintf("pages %d-%d", r.First, r.Last)
+}
+
+// splitPages groups the pages with text into ranges spanning up to size pages. In ranges of several pages,
+// the text of each page is marked with its number.
+func splitPages(pages []pdftext.Page, size int) []pageRange {
+	var (
+		ranges  []pageRange
+		current []pdftext.Page
+	)
+	flush := func() {
+		if len(current) == 0 {
+			return
+		}
+		r := pageRange{First: current[0].Number, Last: current[len(current)-1].Number, Text: current[0].Text}
+		if len(current) > 1 {
+			texts := make([]string, 0, len(current))
+			for _, p := range current {
+				texts = append(texts, fmt.Sprintf("[page %d]\n%s", p.Number, p.Text))
+			}
+			r.Text = strings.Join(texts, "\n\n")
+		}
+		ranges = append(ranges, r)
+		current = nil
+	}
+	for _, p := range pages {
+		p.Text = strings.TrimSpace(p.Text)
+		if p.Text == "" {
+			continue
+		}
+		if len(current) > 0 && p.Number-current[0].Number >= size {
+			flush()
+		}
+		current = append(current, p)
+	}
+	flush()
+	return ranges
+}
+
+// newPageRawText turns the pages r of the PDF at pdfURL, attached to the reading room page at parentURL,
+// into a raw-text upload whose URL points at the first of them. info are the properties of the PDF.
+func newPageRawText(parentURL, pdfURL, name string, r pageRange, info *pdftext.Info) *RawText {
+	url := fmt.Sprintf("%s%s%d", pdfURL, pageAnchor, r.First)
+	rt := NewRawText(url, fmt.Sprintf("%s (%s)", name, r), r.Text)
+	rt.Metadata.Description = fmt.Sprintf("%s of %s", r, name)
+	rt.withPDFInfo(info)
+	if rt.Metadata.DocAuthor == "" {
+		rt.Metadata.DocAuthor = readingRoomAuthor
+	}
+	rt.Metadata.DocSource = rag.ReadingRoomSource
+	rt.Metadata.ChunkSource = "link://" + url
+	rt.Metadata.ParentUrl = parentURL
+	rt.Metadata.PdfUrl = pdfURL
+	return rt
+}
+
+// pdfPages returns the text of every page of the PDF in data, read by OCR for the pages without a text
+// layer if OCR is set up.
+func (c *Config) pdfPages(url string, data []byte) []pdftext.Page {
+	pages, err := pdftext.Extract(data)
+	if err != nil {
+		log.Printf("error extracting text from PDF '%s': %v", url, err)
+		return nil
+	}
+	if c.ocr == nil {
+		return pages
+	}
+
+	missing := 0
+	for _, p := range pages {
+		if strings.TrimSpace(p.Text) == "" {
+			missing++
+		}
+	}
+	if missing == 0 {
+		return pages
+	}
+
+	log.Printf("running OCR on '%s' for %d pages without text...", url, missing)
+	recognized, err := c.ocr.Recognize(context.Background(), data)
+	if err != nil {
+		log.Printf("error running OCR on PDF '%s': %v", url, err)
+		return pages
+	}
+	byNumber := make(map[int]string, len(recognized))
+	for _, p := range recognized {
+		byNumber[p.Number] = c.ocr.TextOf([]ocr.Page{p})
+	}
+	for i, p := range pages {
+		if strings.TrimSpace(p.Text) == "" {
+			pages[i].Text = byNumber[p.Number]
+		}
+	}
+	return pages
+}
+
+// UploadPDFPages uploads the text of the PDF downloaded from url as documents of the page ranges set by
+// WithPageSplit, or uploads it whole with UploadPDF if page splitting is off or it has no text to split.
+func (c *Config) UploadPDFPages(url, name string, data []byte) ([]*Document, error) {
+	if c.hasSeenURL(url) {
+		return nil, ErrDuplicate
+	}
+
+	info := readPDFInfo(url, data)
+	var ranges []pageRange
+	if c.pageSplit > 0 {
+		ranges = splitPages(c.pdfPages(url, data), c.pageSplit)
+	}
+	if len(ranges) == 0 {
+		doc, err := c.uploadPDF(url, name, data, info)
+		if err != nil {
+			return nil, err
+		}
+		return []*Document{doc}, nil
+	}
+
+	c.mu.RLock()
+	parent := c.parents[url]
+	c.mu.RUnlock()
+
+	docs := make([]*Document, 0, len(ranges))
+	for _, r := range ranges {
+		doc, err := c.uploadRawText(newPageRawText(parent, url, name, r, info))
+		if err != nil {
+			c.deleteUploaded(docs)
+			return nil, fmt.Errorf("failed to upload %s of PDF '%s': %w", r, url, err)
+		}
+		docs = append(docs, doc)
+	}
+	log.Printf("uploaded PDF '%s' as %d page ranges", url, len(docs))
+
+	c.markSeenURL(url)
+
+	return docs, nil
+}
+
+// deleteUploaded removes the documents uploaded for a PDF that could only be uploaded in part.
+func (c *Config) deleteUploaded(docs []*Document) {
+	locations := make([]string, 0, len(docs))
+	for _, doc := range docs {
+		locations = append(locations, doc.Location)
+	}
+	if len(locations) == 0 {
+		return
+	}
+	if err := c.DeleteDocuments(locations...); err != nil {
+		log.Printf("[err] failed to remove partly uploaded PDF: %v", err)
+	}
+}
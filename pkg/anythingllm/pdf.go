@@ -12,7 +12,6 @@ import (
 	"strings"
 	"time"
 
-	spew2 "github.com/davecgh/go-spew/spew"
 	"github.com/l0nax/go-spew/spew"
 	"github.com/pdfcpu/pdfcpu/pkg/api"
 	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
@@ -20,7 +19,11 @@ import (
 
 	"ciascrape/pkg/bufs"
 	seekablebuffer "ciascrape/pkg/bufs/3rd_party"
+	"ciascrape/pkg/cia"
 	"ciascrape/pkg/mu"
+	"ciascrape/pkg/ocr"
+	"ciascrape/pkg/pdftext"
+	"ciascrape/pkg/rag"
 )
 
 var (
@@ -28,8 +31,14 @@ var (
 	pdfGoRoutines = semaphore.NewWeighted(500)
 
 	ErrNoDocuments = errors.New("no documents found")
+
+	// errLocalFetch makes GetPDFLinks upload PDF data right away instead of trying upload-link first.
+	errLocalFetch = errors.New("fetching PDFs locally")
 )
 
+// maxAccessDeniedRetries is how many times a PDF is looked for again after the reading room denied access.
+const maxAccessDeniedRetries = 10
+
 const pdfRegexPattern = `(?m)"application/pdf" src=".*" \/> <a href="(.*\.pdf)" type="application/pdf.*</a>`
 
 var PDFConfig = model.NewDefaultConfiguration()
@@ -43,14 +52,10 @@ func sliceEmpty(s []string) bool {
 	return s == nil || len(s) == 0
 }
 
-func getPDFData(url string) []byte {
-	var (
-		err error
-		dat []byte
-	)
-	url, dat, err = seekPDF(url)
+func getPDFData(collection, link string, loc *cia.PDFLocation) []byte {
+	dat, err := seekPDF(collection, link, loc)
 	if err != nil {
-		log.Printf("error getting PDF data for '%s': %v", url, err)
+		log.Printf("error getting PDF data for '%s': %v", loc.URL, err)
 		return nil
 	}
 	return dat
@@ -67,37 +72,31 @@ func (c *Config) GetPDFLinks(url string) error {
 
 	log.Printf("getting PDFs from page %s", url)
 
-	handleFailedPDF := func(pdfUrl, pdfName string, buf *bytes.Buffer) (resData []byte) {
+	uploadPDFData := func(collection, link string, loc *cia.PDFLocation, pdfName string, buf *bytes.Buffer) (resData []byte) {
 		var err error
-		log.Printf("error uploading PDF link '%s': %v\nretrying as upload...", pdfUrl, err)
-		dat := getPDFData(pdfUrl)
+		dat := getPDFData(collection, link, loc)
+		pdfUrl := loc.URL
 		docDat := c.altUploadPDF(pdfUrl, pdfName, buf, dat)
 		if docDat != nil && len(docDat) > 0 {
 			log.Printf("retrying as upload successful: \n%s", spew.Sdump(docDat))
 			return
 		}
-		log.Printf("retrying by extracting keywords: '%s'", pdfUrl)
-		keyWords := extractKeyWords(dat)
-		if sliceEmpty(keyWords) {
-			log.Printf("error extracting keywords from PDF '%s': got nil result", pdfUrl)
+		log.Printf("retrying by extracting text: '%s'", pdfUrl)
+		text := c.extractText(pdfUrl, dat)
+		if text == "" {
+			log.Printf("error extracting text from PDF '%s': got nil result", pdfUrl)
 			return
 		}
-		if keyWords != nil && len(keyWords) > 0 {
-			keyw := strings.Join(keyWords, " ")
-			hr := strings.Repeat("-", 15)
-			log.Printf("got keywords for '%s': \n%s\n%s\n%s\nuploading...", pdfUrl, hr, keyw, hr)
-
-			if resData, err = c.UploadRaw(pdfUrl, keyw); err != nil {
-				log.Printf("error uploading extracted PDF data '%s': %v", pdfUrl, err)
-				return
-			}
+		if resData, err = c.uploadRaw(newPDFRawText(pdfUrl, pdfUrl, text, readPDFInfo(pdfUrl, dat))); err != nil {
+			log.Printf("error uploading extracted PDF data '%s': %v", pdfUrl, err)
+			return
 		}
 		return
 	}
 
 	go func() {
 		mu.GetMutex("net").RLock()
-		res, err := http.Get(url)
+		res, err := cia.Client.Get(url)
 		mu.GetMutex("net").RUnlock()
 
 		if err != nil {
@@ -125,6 +124,12 @@ func (c *Config) GetPDFLinks(url string) error {
 			return
 		}
 
+		// the resolver remembers per collection where its PDFs are kept
+		var collection string
+		if doc, err := cia.ParseDocumentData(res.Request.URL.String(), data); err == nil {
+			collection = doc.Collection
+		}
+
 		for _, match := range matches {
 			if len(match) < 2 {
 				continue
@@ -133,17 +138,31 @@ func (c *Config) GetPDFLinks(url string) error {
 				continue
 			}
 			log.Printf("found PDF: %s", match[1])
-			pdfUrl := string(match[1])
+			link := string(match[1])
 
-			if strings.Contains(pdfUrl, "document") {
-				pdfUrl = cleanPDFURL(pdfUrl)
+			loc, err := resolvePDF(collection, link)
+			switch {
+			case errors.Is(err, cia.ErrNoPDF):
+				log.Printf("(PDF CHECK) %v", err)
+				continue
+			case err != nil:
+				log.Printf("[err] skipping PDF '%s': %v", link, err)
+				continue
 			}
+			pdfUrl := loc.URL
 
-			var resData []byte
+			var (
+				resData []byte
+				doc     *Document
+			)
 
-			doc, err := c.UploadLink(pdfUrl)
+			if c.localFetch {
+				err = errLocalFetch
+			} else if doc, err = c.UploadLink(pdfUrl); err != nil {
+				log.Printf("error uploading PDF link '%s': %v\nretrying as upload...", pdfUrl, err)
+			}
 			if err != nil {
-				resData = handleFailedPDF(pdfUrl, string(match[0]), buf)
+				resData = uploadPDFData(collection, link, loc, string(match[0]), buf)
 				rtr := &RawTextResp{}
 				if err := json.Unmarshal(resData, rtr); err == nil && len(rtr.Documents[0].PageContent) > 0 {
 					doc = &rtr.Documents[0]
@@ -163,23 +182,17 @@ func (c *Config) GetPDFLinks(url string) error {
 	return nil
 }
 
-func (c *Config) altUploadPDF(url string, pdfName string, buf *bytes.Buffer, dats ...[]byte) []byte {
+func (c *Config) altUploadPDF(url string, pdfName string, buf *bytes.Buffer, dat []byte) []byte {
 	var err error
 
-	var dat []byte
-	if len(dats) == 1 {
-		dat = dats[0]
-	} else {
-		dat = getPDFData(url)
-	}
-
 	if dat == nil || len(dat) == 0 {
 		return nil
 	}
 
 	var res *http.Response
 
-	res, err = c.upload("v1/document/upload", pdfName, bytes.NewReader(dat))
+	meta := newPDFRawText(url, pdfName, "", readPDFInfo(url, dat)).Metadata
+	res, err = c.upload("v1/document/upload", pdfName, bytes.NewReader(dat), &meta)
 
 	if err != nil || res == nil {
 		if err == nil {
@@ -211,6 +224,92 @@ func (c *Config) altUploadPDF(url string, pdfName string, buf *bytes.Buffer, dat
 	return resDat
 }
 
+// UploadPDF uploads the PDF downloaded from url as a file, falling back to its text layer, its OCR text
+// or its keywords as raw text if AnythingLLM can't process it. Either way the document gets the author,
+// dates and page count of the PDF.
+func (c *Config) UploadPDF(url, name string, data []byte) (*Document, error) {
+	return c.uploadPDF(url, name, data, readPDFInfo(url, data))
+}
+
+func (c *Config) uploadPDF(url, name string, data []byte, info *pdftext.Info) (*Document, error) {
+	if c.hasSeenURL(url) {
+		return nil, ErrDuplicate
+	}
+
+	meta := newPDFRawText(url, name, "", info).Metadata
+	doc, err := c.uploadFile(name, data, &meta)
+	if err != nil {
+		log.Printf("error uploading PDF '%s': %v\nretrying by extracting text...", url, err)
+		text := c.extractText(url, data)
+		if text == "" {
+			return nil, fmt.Errorf("failed to upload PDF '%s': %w", url, err)
+		}
+		if doc, err = c.uploadRawText(newPDFRawText(url, name, text, info)); err != nil {
+			return nil, err
+		}
+	}
+
+	c.markSeenURL(url)
+
+	return doc, nil
+}
+
+func (c *Config) uploadFile(name string, data []byte, meta *TextMeta) (*Document, error) {
+	res, err := c.upload("v1/document/upload", name, bytes.NewReader(data), meta)
+	if err != nil {
+		if res != nil {
+			_ = res.Body.Close()
+		}
+		return nil, err
+	}
+	up := &UploadLinkResponse{}
+	if err = readJSON(res, up); err != nil {
+		return nil, err
+	}
+	if len(up.Documents) == 0 {
+		return nil, fmt.Errorf("no documents uploaded: %v", up.Error)
+	}
+	return &up.Documents[0], nil
+}
+
+// readPDFInfo returns the properties of the PDF in data downloaded from url, or nil if it can't be read.
+func readPDFInfo(url string, data []byte) *pdftext.Info {
+	info, err := pdftext.ReadInfo(data)
+	if err != nil {
+		log.Printf("error reading properties of PDF '%s': %v", url, err)
+		return nil
+	}
+	return info
+}
+
+// newPDFRawText turns text read from the PDF downloaded from url into a raw-text upload with the
+// properties of the PDF, info, merged into its metadata.
+func newPDFRawText(url, name, text string, info *pdftext.Info) *RawText {
+	rt := NewRawText(url, name, text).withPDFInfo(info)
+	rt.Metadata.DocSource = rag.ReadingRoomSource
+	rt.Metadata.ChunkSource = "link://" + url
+	return rt
+}
+
+// extractText returns the text layer of the PDF in data, or the text OCR reads from its page images if it
+// has none and OCR is set up, or else its keywords, or "".
+func (c *Config) extractText(url string, data []byte) string {
+	text, err := ocr.TextOrOCR(url, data, c.ocr)
+	if err == nil {
+		hr := strings.Repeat("-", 15)
+		log.Printf("got %d characters of text for '%s': \n%s\n%.200s\n%s", len(text), url, hr, text, hr)
+		return text
+	}
+	log.Printf("error extracting text from PDF '%s': %v", url, err)
+
+	log.Printf("falling back to keywords for '%s'...", url)
+	keyWords := extractKeyWords(data)
+	if sliceEmpty(keyWords) {
+		return ""
+	}
+	return strings.Join(keyWords, " ")
+}
+
 func extractKeyWords(data []byte) []string {
 	sb := &seekablebuffer.Buffer{}
 	var n int
@@ -224,7 +323,11 @@ func extractKeyWords(data []byte) []string {
 		log.Printf("0 byte write result when writing PDF data written to buffer")
 		return []string{}
 	}
-	keyWords, err := api.Keywords(sb, PDFConfig)
+	var keyWords []string
+	err = pdftext.Guard(func() (err error) {
+		keyWords, err = api.Keywords(sb, PDFConfig)
+		return err
+	})
 	if err != nil {
 		log.Printf("error extracting keywords from PDFs: %v", err)
 		return []string{}
@@ -236,83 +339,39 @@ func extractKeyWords(data []byte) []string {
 	return keyWords
 }
 
-func seekPDF(url string) (string, []byte, error) {
-	buf := bufs.GetBuffer()
-	defer bufs.PutBuffer(buf)
-
-	processRes := func(res *http.Response) ([]byte, error) {
-		if res == nil || res.StatusCode != http.StatusOK || res.Body == nil {
-			return nil, fmt.Errorf("invalid PDF response:\n%s", spew2.Sdump(res))
+// resolvePDF finds where the reading room keeps the PDF linked as link from a document of collection,
+// retrying while it answers with Access Denied.
+func resolvePDF(collection, link string) (*cia.PDFLocation, error) {
+	for retries := 0; ; retries++ {
+		loc, err := cia.ResolvePDF(collection, link)
+		if !errors.Is(err, cia.ErrAccessDenied) || retries >= maxAccessDeniedRetries {
+			return loc, err
 		}
-		var n int64
-		var err error
-		if n, err = buf.ReadFrom(res.Body); err != nil || n == 0 {
-			if n == 0 && err == nil {
-				err = fmt.Errorf("empty PDF response body")
-			}
-			return nil, fmt.Errorf("error reading PDF response body: %w", err)
-		}
-		defer func() {
-			if res != nil && res.Body != nil {
-				_ = res.Body.Close()
-			}
-		}()
-		data := make([]byte, n)
-		n2 := copy(data, buf.Bytes()[:n])
-		if int64(n2) != n {
-			log.Printf("error copying PDF response body: %d != %d", n2, n)
-			if n2 == 0 {
-				return nil, fmt.Errorf("error copying PDF response body: %d != %d", n2, n)
-			}
-		}
-		bufs.PutBuffer(buf)
-		return data, nil
-	}
-
-	var (
-		res *http.Response
-		dat []byte
-		err error
-	)
-
-	if !strings.HasSuffix(url, ".pdf") {
-		url = url + ".pdf"
+		log.Printf("[err] access denied resolving PDF '%s' (%d), retrying...", link, retries+1)
 	}
+}
 
-	if res, err = http.DefaultClient.Get(url); err == nil {
-		if dat, err = processRes(res); err == nil {
-			return url, dat, err
-		}
+// seekPDF downloads the PDF linked as link from a document of collection from loc, where it was resolved to,
+// retrying while the reading room answers with Access Denied. Only if loc is gone is link resolved again.
+func seekPDF(collection, link string, loc *cia.PDFLocation) ([]byte, error) {
+	data, err := getFile(loc.URL)
+	if !errors.Is(err, cia.ErrPageNotFound) {
+		return data, err
 	}
-
-	url = cleanPDFURL(url)
-
-	if res, err = http.DefaultClient.Get(url); err == nil {
-		if dat, err = processRes(res); err == nil {
-			return cleanPDFURL(url), dat, err
-		}
+	log.Printf("[info] PDF '%s' is gone from '%s', resolving it again...", link, loc.URL)
+	if loc, err = resolvePDF(collection, link); err != nil {
+		return nil, err
 	}
-
-	return url, nil, err
+	return getFile(loc.URL)
 }
 
-func cleanPDFURL(url string) string {
-	file := strings.Split(url, "/")[len(strings.Split(url, "/"))-1]
-	url = strings.TrimSuffix(url, file)
-	file = strings.TrimSuffix(file, ".pdf")
-	file = strings.TrimSuffix(file, ".PDF")
-	file = strings.ToUpper(file)
-	file = file + ".pdf"
-	url = url + file
-	url = strings.ReplaceAll(url, "//", "/")
-	url = strings.ReplaceAll(url, "https:/", "https://")
-	//goland:noinspection HttpUrlsUsage
-	url = strings.ReplaceAll(url, "http:/", "http://")
-
-	pdfUrl := strings.Replace(url, "readingroom/document", "readingroom/docs", 1)
-
-	if !strings.HasSuffix(pdfUrl, ".pdf") {
-		pdfUrl = pdfUrl + ".pdf"
+// getFile downloads url, retrying while the reading room answers with Access Denied.
+func getFile(url string) ([]byte, error) {
+	for retries := 0; ; retries++ {
+		data, err := cia.GetFile(url)
+		if !errors.Is(err, cia.ErrAccessDenied) || retries >= maxAccessDeniedRetries {
+			return data, err
+		}
+		log.Printf("[err] access denied fetching PDF '%s' (%d), retrying...", url, retries+1)
 	}
-	return pdfUrl
 }
@@ -0,0 +1,440 @@
+package anythingllm
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultEmbedRetries = 5
+
+	embedFlushInterval = 30 * time.Second
+	embedBatchSize     = 1000
+	embedBackoff       = 30 * time.Second
+	embedMaxBackoff    = 30 * time.Minute
+)
+
+var ErrQueueClosed = errors.New("embed queue closed")
+
+// errRejected marks a batch AnythingLLM refused because of the documents it holds, as opposed to one that
+// failed because the server is down or erroring. Only rejected batches are split to find the bad documents.
+var errRejected = errors.New("documents rejected")
+
+const (
+	journalAdd  = "add"
+	journalDone = "done"
+	journalDead = "dead"
+)
+
+// journalEntry is a line of the embed queue journal or dead-letter file. An "add" entry carries the
+// whole state of a queued document and replaces any earlier one for the same location.
+type journalEntry struct {
+	Op       string    `json:"op"`
+	Location string    `json:"location"`
+	Attempts int       `json:"attempts,omitempty"`
+	NextTry  time.Time `json:"next_try"`
+	Error    string    `json:"error,omitempty"`
+	Time     time.Time `json:"time"`
+}
+
+type queuedDocument struct {
+	location string
+	attempts int
+	nextTry  time.Time
+	lastErr  string
+}
+
+// embedQueue batches the documents to embed into a workspace. Every change is appended to a journal so that
+// documents still queued when the process exits are embedded on the next run. Failed batches are split until the
+// failing documents are found, those are retried with exponential backoff, and documents that keep failing are
+// moved to a dead-letter file.
+type embedQueue struct {
+	send        func(locations []string) error
+	journalPath string
+	deadPath    string
+	journal     *os.File
+	maxAttempts int
+	backoff     time.Duration
+	maxBackoff  time.Duration
+	interval    time.Duration
+	batchSize   int
+	pending     []*queuedDocument
+	index       map[string]*queuedDocument
+	closed      bool
+	mu          sync.Mutex
+	// sending serializes batches, so a document is never sent twice at once
+	sending sync.Mutex
+	kick    chan struct{}
+	stop    chan struct{}
+	wg      sync.WaitGroup
+}
+
+// newEmbedQueue loads the documents left in the journal at journalPath, if any. An empty path keeps the queue in memory.
+func newEmbedQueue(send func(locations []string) error, journalPath string) (*embedQueue, error) {
+	q := &embedQueue{
+		send:        send,
+		journalPath: journalPath,
+		maxAttempts: DefaultEmbedRetries,
+		backoff:     embedBackoff,
+		maxBackoff:  embedMaxBackoff,
+		interval:    embedFlushInterval,
+		batchSize:   embedBatchSize,
+		index:       make(map[string]*queuedDocument),
+		kick:        make(chan struct{}, 1),
+		stop:        make(chan struct{}),
+	}
+	if journalPath == "" {
+		return q, nil
+	}
+	q.deadPath = strings.TrimSuffix(journalPath, ".jsonl") + ".dead.jsonl"
+
+	if err := q.load(); err != nil {
+		return nil, err
+	}
+	if len(q.pending) > 0 {
+		log.Printf("[queue] %d documents left in '%s' from an earlier run", len(q.pending), journalPath)
+	}
+	return q, q.compact()
+}
+
+func (q *embedQueue) load() error {
+	f, err := os.Open(q.journalPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to open embed journal: %w", err)
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		entry := journalEntry{}
+		if err = json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			// most likely the last line of a journal cut short by a crash
+			log.Printf("[err][queue] skipping bad line %d of '%s': %v", line, q.journalPath, err)
+			continue
+		}
+		switch entry.Op {
+		case journalAdd:
+			doc, ok := q.index[entry.Location]
+			if !ok {
+				doc = &queuedDocument{location: entry.Location}
+				q.index[entry.Location] = doc
+				q.pending = append(q.pending, doc)
+			}
+			doc.attempts, doc.nextTry, doc.lastErr = entry.Attempts, entry.NextTry, entry.Error
+		case journalDone, journalDead:
+			q.remove(entry.Location)
+		}
+	}
+	return scanner.Err()
+}
+
+// compact rewrites the journal to hold only the documents still queued, or removes it if there are none.
+func (q *embedQueue) compact() error {
+	if q.journalPath == "" {
+		return nil
+	}
+	if q.journal != nil {
+		_ = q.journal.Close()
+		q.journal = nil
+	}
+	if len(q.pending) == 0 {
+		if err := os.Remove(q.journalPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		return nil
+	}
+
+	tmp := q.journalPath + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return fmt.Errorf("failed to compact embed journal: %w", err)
+	}
+	w := bufio.NewWriter(f)
+	for _, doc := range q.pending {
+		writeJournalEntry(w, q.entry(journalAdd, doc))
+	}
+	if err = w.Flush(); err == nil {
+		err = f.Sync()
+	}
+	_ = f.Close()
+	if err != nil {
+		return fmt.Errorf("failed to compact embed journal: %w", err)
+	}
+	return os.Rename(tmp, q.journalPath)
+}
+
+func (q *embedQueue) entry(op string, doc *queuedDocument) journalEntry {
+	return journalEntry{
+		Op:       op,
+		Location: doc.location,
+		Attempts: doc.attempts,
+		NextTry:  doc.nextTry,
+		Error:    doc.lastErr,
+		Time:     time.Now().UTC(),
+	}
+}
+
+func writeJournalEntry(w io.Writer, entry journalEntry) {
+	dat, _ := json.Marshal(entry)
+	_, _ = w.Write(append(dat, '\n'))
+}
+
+// record appends entries to the journal. Callers must hold q.mu.
+func (q *embedQueue) record(entries ...journalEntry) {
+	if q.journalPath == "" || len(entries) == 0 {
+		return
+	}
+	if q.journal == nil {
+		f, err := os.OpenFile(q.journalPath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+		if err != nil {
+			log.Printf("[err][queue] failed to open embed journal: %v", err)
+			return
+		}
+		q.journal = f
+	}
+	w := bufio.NewWriter(q.journal)
+	for _, entry := range entries {
+		writeJournalEntry(w, entry)
+	}
+	if err := w.Flush(); err != nil {
+		log.Printf("[err][queue] failed to write embed journal: %v", err)
+	}
+}
+
+func (q *embedQueue) deadLetter(docs []*queuedDocument) {
+	for _, doc := range docs {
+		log.Printf("[err][queue] giving up on '%s' after %d attempts: %s", doc.location, doc.attempts, doc.lastErr)
+	}
+	if q.deadPath == "" {
+		return
+	}
+	f, err := os.OpenFile(q.deadPath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		log.Printf("[err][queue] failed to open dead-letter file: %v", err)
+		return
+	}
+	for _, doc := range docs {
+		writeJournalEntry(f, q.entry(journalDead, doc))
+	}
+	_ = f.Close()
+}
+
+// remove drops location from the queue. Callers must hold q.mu.
+func (q *embedQueue) remove(location string) {
+	if _, ok := q.index[location]; !ok {
+		return
+	}
+	delete(q.index, location)
+	for i, doc := range q.pending {
+		if doc.location == location {
+			q.pending = append(q.pending[:i], q.pending[i+1:]...)
+			break
+		}
+	}
+}
+
+func (q *embedQueue) start() {
+	q.wg.Add(1)
+	go q.run()
+}
+
+func (q *embedQueue) run() {
+	defer q.wg.Done()
+	ticker := time.NewTicker(q.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-q.stop:
+			return
+		case <-ticker.C:
+		case <-q.kick:
+		}
+		if err := q.flushDue(time.Now()); err != nil {
+			log.Printf("[err] failed to add documents: %s", err)
+		}
+	}
+}
+
+func (q *embedQueue) add(location string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return ErrQueueClosed
+	}
+	if _, ok := q.index[location]; ok {
+		return nil
+	}
+	doc := &queuedDocument{location: location}
+	q.index[location] = doc
+	q.pending = append(q.pending, doc)
+	q.record(q.entry(journalAdd, doc))
+
+	if len(q.pending) >= q.batchSize {
+		select {
+		case q.kick <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
+
+// due returns up to a batch of the documents whose next try is not after now.
+func (q *embedQueue) due(now time.Time) []*queuedDocument {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	var batch []*queuedDocument
+	for _, doc := range q.pending {
+		if len(batch) >= q.batchSize {
+			break
+		}
+		if !doc.nextTry.After(now) {
+			batch = append(batch, doc)
+		}
+	}
+	return batch
+}
+
+// flushDue sends every document that is due, batch by batch, and returns the error of the last failed batch.
+func (q *embedQueue) flushDue(now time.Time) error {
+	q.sending.Lock()
+	defer q.sending.Unlock()
+
+	var lastErr error
+	for {
+		batch := q.due(now)
+		if len(batch) == 0 {
+			return lastErr
+		}
+		if err := q.sendBatch(batch, now); err != nil {
+			lastErr = err
+		}
+	}
+}
+
+func (q *embedQueue) sendBatch(batch []*queuedDocument, now time.Time) error {
+	for _, doc := range batch {
+		log.Printf("[queue] flushing doc to workspace: %s", doc.location)
+	}
+	return q.trySend(batch, now)
+}
+
+// trySend sends batch and settles the attempt for its documents. A rejected batch of more than one document
+// is split in halves and sent again, so an attempt only counts against the documents that fail on their own
+// rather than against every document sharing a batch with them. Any other failure is settled for the whole
+// batch at once, so its backoff keeps a struggling server from being hit again right away.
+func (q *embedQueue) trySend(batch []*queuedDocument, now time.Time) error {
+	locations := make([]string, 0, len(batch))
+	for _, doc := range batch {
+		locations = append(locations, doc.location)
+	}
+	err := q.send(locations)
+	if errors.Is(err, errRejected) && len(batch) > 1 {
+		log.Printf("[err][queue] batch of %d documents failed, retrying it split: %v", len(batch), err)
+		mid := len(batch) / 2
+		errFirst := q.trySend(batch[:mid], now)
+		if errLast := q.trySend(batch[mid:], now); errLast != nil {
+			return errLast
+		}
+		return errFirst
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	entries := make([]journalEntry, 0, len(batch))
+	var dead []*queuedDocument
+	for _, doc := range batch {
+		if err == nil {
+			q.remove(doc.location)
+			entries = append(entries, q.entry(journalDone, doc))
+			continue
+		}
+		doc.attempts++
+		doc.lastErr = err.Error()
+		if doc.attempts >= q.maxAttempts {
+			q.remove(doc.location)
+			dead = append(dead, doc)
+			entries = append(entries, q.entry(journalDead, doc))
+			continue
+		}
+		doc.nextTry = now.Add(q.backoffFor(doc.attempts))
+		entries = append(entries, q.entry(journalAdd, doc))
+	}
+	q.record(entries...)
+	q.deadLetter(dead)
+
+	return err
+}
+
+func (q *embedQueue) backoffFor(attempts int) time.Duration {
+	backoff := q.backoff
+	for i := 1; i < attempts && backoff < q.maxBackoff; i++ {
+		backoff *= 2
+	}
+	return min(backoff, q.maxBackoff)
+}
+
+// flush sends everything queued, waiting out the backoff of failed documents, until the queue is empty or ctx is done.
+func (q *embedQueue) flush(ctx context.Context) error {
+	for {
+		if err := q.flushDue(time.Now()); err != nil {
+			log.Printf("[err] failed to add documents: %s", err)
+		}
+
+		q.mu.Lock()
+		left := len(q.pending)
+		var next time.Time
+		for _, doc := range q.pending {
+			if next.IsZero() || doc.nextTry.Before(next) {
+				next = doc.nextTry
+			}
+		}
+		q.mu.Unlock()
+
+		if left == 0 {
+			return nil
+		}
+
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return fmt.Errorf("%d documents left in the embed queue: %w", left, ctx.Err())
+		}
+	}
+}
+
+// close stops the queue and compacts its journal. Documents still queued are kept for the next run.
+func (q *embedQueue) close() error {
+	q.mu.Lock()
+	if q.closed {
+		q.mu.Unlock()
+		return nil
+	}
+	q.closed = true
+	close(q.stop)
+	q.mu.Unlock()
+
+	q.wg.Wait()
+
+	q.sending.Lock()
+	defer q.sending.Unlock()
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.compact()
+}
@@ -0,0 +1,262 @@
+package anythingllm
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeEmbedder fails the first failures calls and records the locations of the others.
+type fakeEmbedder struct {
+	failures int
+	calls    int
+	embedded []string
+	mu       sync.Mutex
+}
+
+func (f *fakeEmbedder) send(locations []string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls++
+	if f.calls <= f.failures {
+		return errors.New("bad status code: 500 Internal Server Error")
+	}
+	f.embedded = append(f.embedded, locations...)
+	return nil
+}
+
+func readJournal(t *testing.T, path string) []journalEntry {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+	var entries []journalEntry
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		entry := journalEntry{}
+		if err = json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			t.Fatal(err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+func TestEmbedQueue_RetriesWithBackoff(t *testing.T) {
+	embedder := &fakeEmbedder{failures: 2}
+	q, err := newEmbedQueue(embedder.send, filepath.Join(t.TempDir(), "embed.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	q.backoff, q.maxBackoff = 10*time.Millisecond, 20*time.Millisecond
+
+	for _, location := range []string{"custom-documents/a.json", "custom-documents/b.json", "custom-documents/a.json"} {
+		if err = q.add(location); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err = q.flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if embedder.calls != 3 || len(embedder.embedded) != 2 {
+		t.Errorf("expected 2 documents embedded on the third call, got %v after %d calls", embedder.embedded, embedder.calls)
+	}
+	if err = q.close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = os.Stat(q.journalPath); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected the journal of an empty queue to be removed, got %v", err)
+	}
+	if err = q.add("custom-documents/c.json"); !errors.Is(err, ErrQueueClosed) {
+		t.Errorf("expected %v, got %v", ErrQueueClosed, err)
+	}
+}
+
+func TestEmbedQueue_DeadLetter(t *testing.T) {
+	embedder := &fakeEmbedder{failures: 100}
+	q, err := newEmbedQueue(embedder.send, filepath.Join(t.TempDir(), "embed.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	q.backoff, q.maxBackoff, q.maxAttempts = time.Millisecond, time.Millisecond, 3
+
+	if err = q.add("custom-documents/a.json"); err != nil {
+		t.Fatal(err)
+	}
+	if err = q.flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if embedder.calls != 3 {
+		t.Errorf("expected 3 attempts, got %d", embedder.calls)
+	}
+
+	dead := readJournal(t, q.deadPath)
+	if len(dead) != 1 || dead[0].Location != "custom-documents/a.json" || dead[0].Attempts != 3 || dead[0].Error == "" {
+		t.Errorf("unexpected dead letters: %+v", dead)
+	}
+	_ = q.close()
+}
+
+func TestEmbedQueue_SplitsFailedBatch(t *testing.T) {
+	var calls int
+	var embedded []string
+	send := func(locations []string) error {
+		calls++
+		for _, location := range locations {
+			if location == "custom-documents/bad.json" {
+				return fmt.Errorf("%w: bad status code: 422 Unprocessable Entity", errRejected)
+			}
+		}
+		embedded = append(embedded, locations...)
+		return nil
+	}
+	q, err := newEmbedQueue(send, filepath.Join(t.TempDir(), "embed.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	q.backoff, q.maxBackoff, q.maxAttempts = time.Millisecond, time.Millisecond, 1
+
+	locations := []string{"custom-documents/a.json", "custom-documents/b.json", "custom-documents/bad.json", "custom-documents/c.json"}
+	for _, location := range locations {
+		if err = q.add(location); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = q.flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(embedded) != 3 {
+		t.Errorf("expected the 3 good documents to be embedded, got %v after %d calls", embedded, calls)
+	}
+	dead := readJournal(t, q.deadPath)
+	if len(dead) != 1 || dead[0].Location != "custom-documents/bad.json" {
+		t.Errorf("expected only the bad document to be dead-lettered, got %+v", dead)
+	}
+	_ = q.close()
+}
+
+func TestEmbedQueue_KeepsBatchOnServerError(t *testing.T) {
+	embedder := &fakeEmbedder{failures: 100}
+	q, err := newEmbedQueue(embedder.send, filepath.Join(t.TempDir(), "embed.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	q.backoff = time.Hour
+
+	for _, location := range []string{"custom-documents/a.json", "custom-documents/b.json", "custom-documents/c.json", "custom-documents/d.json"} {
+		if err = q.add(location); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = q.flushDue(time.Now()); err == nil {
+		t.Fatal("expected the failed batch to be reported")
+	}
+	if embedder.calls != 1 {
+		t.Errorf("expected a single request while the server fails, got %d", embedder.calls)
+	}
+	for _, doc := range q.pending {
+		if doc.attempts != 1 {
+			t.Errorf("expected the whole batch to back off after one attempt, got %+v", doc)
+		}
+	}
+	_ = q.close()
+}
+
+func TestEmbedQueue_SurvivesRestart(t *testing.T) {
+	journal := filepath.Join(t.TempDir(), "embed.jsonl")
+	embedder := &fakeEmbedder{failures: 1}
+	q, err := newEmbedQueue(embedder.send, journal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q.backoff = time.Hour
+
+	for _, location := range []string{"custom-documents/a.json", "custom-documents/b.json"} {
+		if err = q.add(location); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err = q.flush(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected %v, got %v", context.DeadlineExceeded, err)
+	}
+	if err = q.close(); err != nil {
+		t.Fatal(err)
+	}
+
+	entries := readJournal(t, journal)
+	if len(entries) != 2 || entries[0].Attempts != 1 || entries[0].NextTry.IsZero() {
+		t.Fatalf("expected the journal to be compacted to the 2 failed documents, got %+v", entries)
+	}
+
+	// a cut short last line must not keep the queue from loading
+	f, err := os.OpenFile(journal, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = f.WriteString(`{"op":"done","location":"custom-doc`)
+	_ = f.Close()
+
+	q, err = newEmbedQueue(embedder.send, journal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(q.pending) != 2 || q.pending[0].attempts != 1 {
+		t.Fatalf("expected 2 documents to be loaded from the journal, got %d", len(q.pending))
+	}
+	q.pending[0].nextTry, q.pending[1].nextTry = time.Time{}, time.Time{}
+	if err = q.flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(embedder.embedded) != 2 {
+		t.Errorf("expected the 2 documents to be embedded after the restart, got %v", embedder.embedded)
+	}
+	_ = q.close()
+}
+
+func TestConfig_Flush(t *testing.T) {
+	var adds []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ue := &UpdateEmbeddings{}
+		_ = json.NewDecoder(r.Body).Decode(ue)
+		adds = append(adds, ue.Adds...)
+		_, _ = w.Write([]byte(`{"workspace": {"slug": "stargate"}}`))
+	}))
+	defer server.Close()
+
+	c := NewConfig().WithEndpoint(server.URL).WithWorkspace("stargate").
+		WithEmbedJournal(filepath.Join(t.TempDir(), "embed.jsonl"))
+	if err := c.AddDocument(&Document{ID: "1", Location: "custom-documents/url-a.json"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if len(adds) != 1 || adds[0] != "custom-documents/url-a-1.json" {
+		t.Errorf("unexpected embeds: %v", adds)
+	}
+	if err := c.AddDocument(&Document{ID: "2", Location: "custom-documents/url-b.json"}); !errors.Is(err, ErrQueueClosed) {
+		t.Errorf("expected %v, got %v", ErrQueueClosed, err)
+	}
+}
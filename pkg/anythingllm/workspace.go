@@ -2,11 +2,15 @@ package anythingllm
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log"
+	"net/http"
+	"net/url"
 	"strings"
-	"sync"
 	"time"
 )
 
@@ -48,14 +52,217 @@ type WorkspaceResponse struct {
 	Workspaces []Workspace `json:"workspace"`
 }
 
+type WorkspacesResponse struct {
+	Workspaces []Workspace `json:"workspaces"`
+}
+
+// WorkspaceSettings are the settings of a workspace that can be set on creation or updated.
+// Unset fields are left alone by UpdateWorkspace.
+type WorkspaceSettings struct {
+	Name                string   `json:"name,omitempty"`
+	OpenAiPrompt        *string  `json:"openAiPrompt,omitempty"`
+	OpenAiTemp          *float64 `json:"openAiTemp,omitempty"`
+	TopN                *int     `json:"topN,omitempty"`
+	SimilarityThreshold *float64 `json:"similarityThreshold,omitempty"`
+	ChatMode            string   `json:"chatMode,omitempty"`
+}
+
+const (
+	ChatModeChat  = "chat"
+	ChatModeQuery = "query"
+)
+
+var (
+	ErrWorkspaceNotFound = errors.New("workspace not found")
+	ErrInvalidChatMode   = errors.New("invalid chat mode")
+)
+
+func NewWorkspaceSettings() *WorkspaceSettings {
+	return &WorkspaceSettings{}
+}
+
+func (ws *WorkspaceSettings) WithName(name string) *WorkspaceSettings {
+	ws.Name = name
+	return ws
+}
+
+func (ws *WorkspaceSettings) WithPrompt(prompt string) *WorkspaceSettings {
+	ws.OpenAiPrompt = &prompt
+	return ws
+}
+
+func (ws *WorkspaceSettings) WithTemperature(temp float64) *WorkspaceSettings {
+	ws.OpenAiTemp = &temp
+	return ws
+}
+
+func (ws *WorkspaceSettings) WithTopN(topN int) *WorkspaceSettings {
+	ws.TopN = &topN
+	return ws
+}
+
+func (ws *WorkspaceSettings) WithSimilarityThreshold(threshold float64) *WorkspaceSettings {
+	ws.SimilarityThreshold = &threshold
+	return ws
+}
+
+// WithChatMode sets the chat mode, ChatModeChat or ChatModeQuery.
+func (ws *WorkspaceSettings) WithChatMode(mode string) *WorkspaceSettings {
+	ws.ChatMode = mode
+	return ws
+}
+
+func (ws *WorkspaceSettings) validate() error {
+	if ws.ChatMode != "" && ws.ChatMode != ChatModeChat && ws.ChatMode != ChatModeQuery {
+		return fmt.Errorf("%w: '%s'", ErrInvalidChatMode, ws.ChatMode)
+	}
+	return nil
+}
+
+// readJSON unmarshals the body of a 200 response into v and closes it.
+func readJSON(res *http.Response, v interface{}) error {
+	defer func() {
+		_ = res.Body.Close()
+	}()
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("bad status code: %s", res.Status)
+	}
+	data, err := io.ReadAll(res.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read response: %w", err)
+	}
+	if err = json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("%w: %v", ErrUnmarshal, err)
+	}
+	return nil
+}
+
+func (c *Config) ListWorkspaces() ([]Workspace, error) {
+	res, err := c.get("v1/workspaces")
+	if err != nil {
+		return nil, err
+	}
+	wr := &WorkspacesResponse{}
+	if err = readJSON(res, wr); err != nil {
+		return nil, fmt.Errorf("failed to list workspaces: %w", err)
+	}
+	return wr.Workspaces, nil
+}
+
+func (c *Config) GetWorkspace(slug string) (*Workspace, error) {
+	res, err := c.get("v1/workspace/" + url.PathEscape(slug))
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode == http.StatusNotFound {
+		_ = res.Body.Close()
+		return nil, fmt.Errorf("%w: %s", ErrWorkspaceNotFound, slug)
+	}
+
+	// depending on the AnythingLLM version the workspace comes alone or wrapped in a list
+	raw := struct {
+		Workspace json.RawMessage `json:"workspace"`
+	}{}
+	if err = readJSON(res, &raw); err != nil {
+		return nil, fmt.Errorf("failed to get workspace: %w", err)
+	}
+
+	var workspaces []Workspace
+	if err = json.Unmarshal(raw.Workspace, &workspaces); err != nil {
+		ws := Workspace{}
+		if err = json.Unmarshal(raw.Workspace, &ws); err == nil && ws.Slug != "" {
+			workspaces = append(workspaces, ws)
+		}
+	}
+	if len(workspaces) == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrWorkspaceNotFound, slug)
+	}
+
+	return &workspaces[0], nil
+}
+
+func (c *Config) CreateWorkspace(settings *WorkspaceSettings) (*Workspace, error) {
+	if settings == nil || strings.TrimSpace(settings.Name) == "" {
+		return nil, errors.New("workspace name is required")
+	}
+	if err := settings.validate(); err != nil {
+		return nil, err
+	}
+	return c.postWorkspace("v1/workspace/new", settings, "create")
+}
+
+func (c *Config) UpdateWorkspace(slug string, settings *WorkspaceSettings) (*Workspace, error) {
+	if err := settings.validate(); err != nil {
+		return nil, err
+	}
+	return c.postWorkspace("v1/workspace/"+url.PathEscape(slug)+"/update", settings, "update")
+}
+
+func (c *Config) postWorkspace(endpoint string, settings *WorkspaceSettings, action string) (*Workspace, error) {
+	dat, err := json.Marshal(settings)
+	if err != nil {
+		return nil, err
+	}
+	res, err := c.post(endpoint, bytes.NewReader(dat))
+	if err != nil {
+		return nil, err
+	}
+	wr := struct {
+		Workspace *Workspace `json:"workspace"`
+		Message   string     `json:"message"`
+	}{}
+	if err = readJSON(res, &wr); err != nil {
+		return nil, fmt.Errorf("failed to %s workspace: %w", action, err)
+	}
+	if wr.Workspace == nil {
+		return nil, fmt.Errorf("failed to %s workspace: %s", action, wr.Message)
+	}
+	return wr.Workspace, nil
+}
+
+func (c *Config) DeleteWorkspace(slug string) error {
+	res, err := c.delete("v1/workspace/"+url.PathEscape(slug), nil)
+	if err != nil {
+		return err
+	}
+	_ = res.Body.Close()
+	switch res.StatusCode {
+	case http.StatusOK:
+		return nil
+	case http.StatusNotFound:
+		return fmt.Errorf("%w: %s", ErrWorkspaceNotFound, slug)
+	default:
+		return fmt.Errorf("failed to delete workspace: %s", res.Status)
+	}
+}
+
+// EnsureWorkspace returns the configured workspace, creating it if it does not exist yet.
+func (c *Config) EnsureWorkspace() (*Workspace, error) {
+	if strings.TrimSpace(c.Workspace) == "" {
+		return nil, errors.New("missing workspace")
+	}
+	ws, err := c.GetWorkspace(c.Workspace)
+	if !errors.Is(err, ErrWorkspaceNotFound) {
+		return ws, err
+	}
+
+	log.Printf("creating workspace '%s'", c.Workspace)
+	if ws, err = c.CreateWorkspace(NewWorkspaceSettings().WithName(c.Workspace)); err != nil {
+		return nil, err
+	}
+	if ws.Slug != c.Workspace {
+		log.Printf("[warn] workspace '%s' was created with slug '%s'", c.Workspace, ws.Slug)
+		c.Workspace = ws.Slug
+	}
+	return ws, nil
+}
+
 type UpdateEmbeddings struct {
 	Adds    []string `json:"adds,omitempty"`
 	Deletes []string `json:"deletes,omitempty"`
 }
 
 func (c *Config) AddDocumentItem(doc *Item) error {
-	startQueueOnce.Do(c.docQueueFlush)
-
 	name := doc.Name
 	if strings.Contains(name, ".html") {
 		name = strings.ReplaceAll(name, ".html", "")
@@ -82,60 +289,8 @@ func (c *Config) AddDocumentItem(doc *Item) error {
 	return c.AddDocument(doc2)
 }
 
-// FIXME: make not global
-var (
-	docQueue       = make(chan *Document, 1000)
-	docQueueTicker = time.NewTicker(30 * time.Second)
-	docQueueChan   = make(chan bool)
-)
-
-func (c *Config) docQueueFlush() {
-	go func() {
-		for {
-			select {
-			case <-docQueueTicker.C:
-				select {
-				case docQueueChan <- true:
-				default:
-				}
-			}
-		}
-	}()
-	go func() {
-		for {
-			select {
-			case <-docQueueChan:
-				docs := make([]*Document, 0)
-			flush:
-				for {
-					select {
-					case doc := <-docQueue:
-						log.Printf("[queue] flushing doc to workspace: %s", doc.Location)
-						docs = append(docs, doc)
-					default:
-						break flush
-					}
-				}
-				if err := c.AddDocuments(docs); err != nil {
-					log.Printf("[err] failed to add documents: %s", err)
-					/*			for _, doc := range docs {
-								select {
-								case docQueue <- doc:
-								default:
-									panic("docQueue full, too many errors?")
-								}
-							}*/
-				}
-			}
-		}
-	}()
-}
-
-var startQueueOnce = &sync.Once{}
-
+// AddDocument queues doc to be embedded into the workspace with the next batch.
 func (c *Config) AddDocument(doc *Document) error {
-	startQueueOnce.Do(c.docQueueFlush)
-
 	if doc.Location == "" {
 		return fmt.Errorf("document location is required")
 	}
@@ -149,12 +304,35 @@ func (c *Config) AddDocument(doc *Document) error {
 
 	doc.Location = name
 
-	select {
-	case docQueue <- doc:
-	default:
-		docQueueChan <- true
-		time.Sleep(250 * time.Millisecond)
-		docQueue <- doc
+	q, err := c.embedQueue()
+	if err != nil {
+		return err
+	}
+	return q.add(doc.Location)
+}
+
+// RemoveDocuments un-embeds the documents at locations from the workspace, leaving them in the library.
+func (c *Config) RemoveDocuments(locations ...string) error {
+	ue := &UpdateEmbeddings{}
+	for _, location := range locations {
+		if strings.TrimSpace(location) != "" {
+			ue.Deletes = append(ue.Deletes, location)
+		}
+	}
+	if len(ue.Deletes) == 0 {
+		return fmt.Errorf("document location is required")
+	}
+	dat, err := json.Marshal(ue)
+	if err != nil {
+		return err
+	}
+	res, err := c.post("v1/workspace/"+url.PathEscape(c.Workspace)+"/update-embeddings", bytes.NewReader(dat))
+	if err != nil {
+		return err
+	}
+	_ = res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("error removing documents, bad status code: %s", res.Status)
 	}
 	return nil
 }
@@ -166,23 +344,66 @@ func (c *Config) AddDocuments(doc []*Document) error {
 			docStrings = append(docStrings, d.Location)
 		}
 	}
+	return c.addEmbeddings(docStrings)
+}
+
+func (c *Config) addEmbeddings(locations []string) error {
 	ue := &UpdateEmbeddings{
-		Adds: docStrings,
+		Adds: locations,
 	}
 	dat, err := json.Marshal(ue)
 	if err != nil {
 		return err
 	}
-	/*
-		if c.Workspace == "" {
-			c.Workspace = "cia-reading-room"
-		}*/
 
 	endpoint := "v1/workspace/" + c.Workspace + "/update-embeddings"
-	// log.Printf("adding document via '%s': %s", c.Endpoint+endpoint, string(dat))
 	res, err := c.post(endpoint, bytes.NewBuffer(dat))
-	if err == nil && res.StatusCode != 200 {
-		err = fmt.Errorf("error adding document, bad status code: %s", res.Status)
+	if err != nil {
+		return err
+	}
+	_ = res.Body.Close()
+	switch {
+	case res.StatusCode == http.StatusOK:
+		return nil
+	case res.StatusCode >= 400 && res.StatusCode < 500 &&
+		res.StatusCode != http.StatusRequestTimeout && res.StatusCode != http.StatusTooManyRequests:
+		return fmt.Errorf("%w: error adding document, bad status code: %s", errRejected, res.Status)
+	default:
+		return fmt.Errorf("error adding document, bad status code: %s", res.Status)
+	}
+}
+
+// embedQueue returns the queue of documents to embed, loading what an earlier run left in the journal.
+func (c *Config) embedQueue() (*embedQueue, error) {
+	c.queueOnce.Do(func() {
+		q, err := newEmbedQueue(c.addEmbeddings, c.embedJournal)
+		if err != nil {
+			c.queueErr = fmt.Errorf("failed to open embed queue: %w", err)
+			return
+		}
+		q.maxAttempts = c.embedRetries
+		q.start()
+		c.queue = q
+	})
+	return c.queue, c.queueErr
+}
+
+// Flush embeds every queued document, retrying failed batches until the queue is empty or ctx is done.
+func (c *Config) Flush(ctx context.Context) error {
+	q, err := c.embedQueue()
+	if err != nil {
+		return err
+	}
+	return q.flush(ctx)
+}
+
+// Close stops the embed queue. Documents that could not be embedded yet stay in the journal for the next run.
+func (c *Config) Close() error {
+	c.queueOnce.Do(func() {
+		c.queueErr = ErrQueueClosed
+	})
+	if c.queue == nil {
+		return nil
 	}
-	return err
+	return c.queue.close()
 }
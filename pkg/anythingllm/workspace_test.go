@@ -0,0 +1,169 @@
+package anythingllm
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeWorkspaces is a minimal AnythingLLM workspace API.
+type fakeWorkspaces struct {
+	workspaces map[string]*Workspace
+	updates    []map[string]interface{}
+	mu         sync.Mutex
+}
+
+func (f *fakeWorkspaces) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	path := strings.TrimPrefix(r.URL.Path, "/v1/")
+	switch {
+	case path == "workspaces" && r.Method == http.MethodGet:
+		list := make([]Workspace, 0, len(f.workspaces))
+		for _, ws := range f.workspaces {
+			list = append(list, *ws)
+		}
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"workspaces": list})
+	case path == "workspace/new" && r.Method == http.MethodPost:
+		settings := &WorkspaceSettings{}
+		_ = json.NewDecoder(r.Body).Decode(settings)
+		ws := &Workspace{Id: len(f.workspaces) + 1, Name: settings.Name, Slug: strings.ToLower(strings.ReplaceAll(settings.Name, " ", "-"))}
+		f.workspaces[ws.Slug] = ws
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"workspace": ws, "message": "Workspace created"})
+	case strings.HasSuffix(path, "/update") && r.Method == http.MethodPost:
+		ws, ok := f.workspaces[strings.TrimSuffix(strings.TrimPrefix(path, "workspace/"), "/update")]
+		if !ok {
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{"workspace": nil, "message": "Workspace not found"})
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		update := make(map[string]interface{})
+		_ = json.Unmarshal(body, &update)
+		f.updates = append(f.updates, update)
+		_ = json.Unmarshal(body, ws)
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"workspace": ws})
+	case strings.HasPrefix(path, "workspace/"):
+		slug := strings.TrimPrefix(path, "workspace/")
+		ws, ok := f.workspaces[slug]
+		switch {
+		case r.Method == http.MethodDelete && ok:
+			delete(f.workspaces, slug)
+		case r.Method == http.MethodDelete:
+			w.WriteHeader(http.StatusNotFound)
+		case ok:
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{"workspace": []*Workspace{ws}})
+		default:
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{"workspace": []*Workspace{}})
+		}
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func newFakeWorkspaces(t *testing.T) (*fakeWorkspaces, *Config) {
+	t.Helper()
+	f := &fakeWorkspaces{workspaces: map[string]*Workspace{
+		"existing": {Id: 1, Name: "existing", Slug: "existing", TopN: 4},
+	}}
+	server := httptest.NewServer(f)
+	t.Cleanup(server.Close)
+	return f, NewConfig().WithEndpoint(server.URL).WithAPIKey("testKey")
+}
+
+func TestWorkspaces_CRUD(t *testing.T) {
+	f, c := newFakeWorkspaces(t)
+
+	ws, err := c.GetWorkspace("existing")
+	if err != nil || ws.TopN != 4 {
+		t.Fatalf("unexpected workspace %+v: %v", ws, err)
+	}
+	if _, err = c.GetWorkspace("missing"); !errors.Is(err, ErrWorkspaceNotFound) {
+		t.Errorf("expected %v, got %v", ErrWorkspaceNotFound, err)
+	}
+
+	created, err := c.CreateWorkspace(NewWorkspaceSettings().WithName("Mind Control"))
+	if err != nil || created.Slug != "mind-control" {
+		t.Fatalf("unexpected workspace %+v: %v", created, err)
+	}
+
+	list, err := c.ListWorkspaces()
+	if err != nil || len(list) != 2 {
+		t.Fatalf("expected 2 workspaces, got %d: %v", len(list), err)
+	}
+
+	updated, err := c.UpdateWorkspace("mind-control", NewWorkspaceSettings().
+		WithPrompt("cite your sources").WithTemperature(0).WithTopN(8).WithChatMode(ChatModeQuery))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated.TopN != 8 || updated.ChatMode != ChatModeQuery || updated.OpenAiPrompt != "cite your sources" {
+		t.Errorf("settings were not updated: %+v", updated)
+	}
+	// a zero temperature must still be sent, unset settings must not be
+	if temp, ok := f.updates[0]["openAiTemp"]; !ok || temp != 0.0 {
+		t.Errorf("expected openAiTemp 0 to be sent, got %v", f.updates[0])
+	}
+	if _, ok := f.updates[0]["similarityThreshold"]; ok {
+		t.Errorf("unset similarityThreshold was sent: %v", f.updates[0])
+	}
+
+	if _, err = c.UpdateWorkspace("mind-control", NewWorkspaceSettings().WithChatMode("gossip")); !errors.Is(err, ErrInvalidChatMode) {
+		t.Errorf("expected %v, got %v", ErrInvalidChatMode, err)
+	}
+
+	if err = c.DeleteWorkspace("mind-control"); err != nil {
+		t.Fatal(err)
+	}
+	if err = c.DeleteWorkspace("mind-control"); !errors.Is(err, ErrWorkspaceNotFound) {
+		t.Errorf("expected %v, got %v", ErrWorkspaceNotFound, err)
+	}
+}
+
+func TestEnsureWorkspace(t *testing.T) {
+	f, c := newFakeWorkspaces(t)
+
+	if _, err := c.WithWorkspace("existing").EnsureWorkspace(); err != nil {
+		t.Fatal(err)
+	}
+	if len(f.workspaces) != 1 {
+		t.Fatalf("existing workspace should not be created again")
+	}
+
+	ws, err := c.WithWorkspace(DefaultWorkspace).EnsureWorkspace()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ws.Slug != DefaultWorkspace || f.workspaces[DefaultWorkspace] == nil {
+		t.Errorf("workspace was not created: %+v", ws)
+	}
+}
+
+func TestRemoveDocuments(t *testing.T) {
+	var ue UpdateEmbeddings
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/workspace/stargate/update-embeddings" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_ = json.NewDecoder(r.Body).Decode(&ue)
+		_, _ = w.Write([]byte(`{"workspace": {"slug": "stargate"}}`))
+	}))
+	defer server.Close()
+
+	c := NewConfig().WithEndpoint(server.URL).WithWorkspace("stargate")
+	if err := c.RemoveDocuments("custom-documents/a.json"); err != nil {
+		t.Fatal(err)
+	}
+	if len(ue.Adds) != 0 || len(ue.Deletes) != 1 || ue.Deletes[0] != "custom-documents/a.json" {
+		t.Errorf("unexpected update: %+v", ue)
+	}
+	if err := c.WithWorkspace("missing").RemoveDocuments("custom-documents/a.json"); err == nil {
+		t.Error("expected an error for a missing workspace")
+	}
+}
@@ -0,0 +1,213 @@
+package archive
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"ciascrape/pkg/cia"
+)
+
+const ManifestName = "manifest.jsonl"
+
+var unsafePathRegex = regexp.MustCompile(`[^a-zA-Z0-9._-]+`)
+
+// ManifestEntry describes one file of a Mirror.
+type ManifestEntry struct {
+	URL         string    `json:"url"`
+	Path        string    `json:"path"`
+	Status      int       `json:"status"`
+	ContentType string    `json:"content_type,omitempty"`
+	Size        int64     `json:"size"`
+	SHA256      string    `json:"sha256"`
+	FetchedAt   time.Time `json:"fetched_at"`
+}
+
+// Mirror saves every successful GET response it records into a directory tree laid out by host and path,
+// and appends an entry for each file to a JSONL manifest at the root of the tree.
+type Mirror struct {
+	dir      string
+	manifest *os.File
+	entries  map[string]*ManifestEntry
+	mu       sync.Mutex
+}
+
+// NewMirror opens (or creates) the mirror rooted at dir. Entries of an existing manifest are kept.
+func NewMirror(dir string) (*Mirror, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create mirror directory: %w", err)
+	}
+
+	entries, err := ReadManifest(dir)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	f, err := os.OpenFile(filepath.Join(dir, ManifestName), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open manifest: %w", err)
+	}
+
+	return &Mirror{
+		dir:      dir,
+		manifest: f,
+		entries:  entries,
+	}, nil
+}
+
+// ReadManifest loads the manifest of the mirror at dir, keyed by URL. Later entries win.
+func ReadManifest(dir string) (map[string]*ManifestEntry, error) {
+	entries := make(map[string]*ManifestEntry)
+
+	f, err := os.Open(filepath.Join(dir, ManifestName))
+	if err != nil {
+		return entries, err
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		entry := &ManifestEntry{}
+		if err = json.Unmarshal(scanner.Bytes(), entry); err != nil {
+			// a torn final line from a crash is not fatal
+			continue
+		}
+		entries[entry.URL] = entry
+	}
+
+	return entries, scanner.Err()
+}
+
+// MirrorPath maps a URL to its deterministic location inside a mirror, e.g.
+// https://www.cia.gov/readingroom/collection/stargate?page=2 -> www.cia.gov/readingroom/collection/stargate@page-2.html
+func MirrorPath(u *url.URL) string {
+	p := path.Clean("/" + u.Path)
+	if p == "/" || strings.HasSuffix(u.Path, "/") {
+		p = path.Join(p, "index")
+	}
+
+	segments := strings.Split(p, "/")
+	for i, segment := range segments {
+		segments[i] = unsafePathRegex.ReplaceAllString(segment, "-")
+	}
+	p = strings.Join(segments, "/")
+
+	ext := path.Ext(p)
+	if ext == "" {
+		ext = ".html"
+	}
+	p = strings.TrimSuffix(p, path.Ext(p))
+
+	if u.RawQuery != "" {
+		p += "@" + strings.Trim(unsafePathRegex.ReplaceAllString(u.RawQuery, "-"), "-")
+	}
+
+	return filepath.Join(unsafePathRegex.ReplaceAllString(u.Host, "-"), filepath.FromSlash(p+ext))
+}
+
+func (m *Mirror) Dir() string {
+	return m.dir
+}
+
+// Has reports whether rawURL has already been saved to the mirror.
+func (m *Mirror) Has(rawURL string) bool {
+	m.mu.Lock()
+	_, ok := m.entries[rawURL]
+	m.mu.Unlock()
+	return ok
+}
+
+func (m *Mirror) Record(req *http.Request, res *http.Response, body []byte) error {
+	if req.Method != http.MethodGet || res.StatusCode != http.StatusOK {
+		return nil
+	}
+
+	contentType := res.Header.Get("Content-Type")
+	if strings.HasPrefix(contentType, "text/html") && cia.IsAccessDenied(string(body)) {
+		return nil
+	}
+
+	rel := MirrorPath(req.URL)
+	sum := sha256.Sum256(body)
+
+	entry := &ManifestEntry{
+		URL:         req.URL.String(),
+		Path:        filepath.ToSlash(rel),
+		Status:      res.StatusCode,
+		ContentType: contentType,
+		Size:        int64(len(body)),
+		SHA256:      hex.EncodeToString(sum[:]),
+		FetchedAt:   time.Now().UTC(),
+	}
+
+	if err := writeFileAtomic(filepath.Join(m.dir, rel), body); err != nil {
+		return err
+	}
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, err = m.manifest.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to append to manifest: %w", err)
+	}
+	m.entries[entry.URL] = entry
+
+	return nil
+}
+
+func (m *Mirror) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.manifest.Sync(); err != nil {
+		_ = m.manifest.Close()
+		return err
+	}
+	return m.manifest.Close()
+}
+
+func writeFileAtomic(name string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		return fmt.Errorf("failed to create mirror directory: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(name), filepath.Base(name)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create mirror file: %w", err)
+	}
+
+	if _, err = tmp.Write(data); err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), name)
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+		return fmt.Errorf("failed to write mirror file: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,110 @@
+package archive
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	http2 "ciascrape/pkg/http"
+)
+
+func TestMirrorPath(t *testing.T) {
+	cases := map[string]string{
+		"https://www.cia.gov/":                                           "www.cia.gov/index.html",
+		"https://www.cia.gov/readingroom/collection/stargate":            "www.cia.gov/readingroom/collection/stargate.html",
+		"https://www.cia.gov/readingroom/collection/stargate?page=2":     "www.cia.gov/readingroom/collection/stargate@page-2.html",
+		"https://www.cia.gov/readingroom/docs/CIA-RDP96-00788R001.pdf":   "www.cia.gov/readingroom/docs/CIA-RDP96-00788R001.pdf",
+		"https://www.cia.gov/readingroom/search/site/remote%20viewing":   "www.cia.gov/readingroom/search/site/remote-viewing.html",
+		"http://127.0.0.1:8080/readingroom/document/../../../etc/passwd": "127.0.0.1-8080/etc/passwd.html",
+	}
+	for raw, expected := range cases {
+		u, err := url.Parse(raw)
+		if err != nil {
+			t.Fatalf("failed to parse '%s': %v", raw, err)
+		}
+		if result := filepath.ToSlash(MirrorPath(u)); result != expected {
+			t.Errorf("%s: expected %s, got %s", raw, expected, result)
+		}
+	}
+}
+
+func TestMirror_RecordsThroughClient(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/readingroom/document/doc-1":
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			_, _ = w.Write([]byte("<h1>doc 1</h1>"))
+		case "/readingroom/docs/DOC-1.pdf":
+			w.Header().Set("Content-Type", "application/pdf")
+			_, _ = w.Write([]byte("%PDF-1.4"))
+		case "/readingroom/document/denied":
+			w.Header().Set("Content-Type", "text/html")
+			_, _ = w.Write([]byte("<html><head><title>Access Denied</title></head></html>"))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	m, err := NewMirror(dir)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	client := http2.NewClient().WithRecorder(m)
+	for _, p := range []string{"/readingroom/document/doc-1", "/readingroom/docs/DOC-1.pdf", "/readingroom/document/denied", "/missing"} {
+		res, err := client.Get(server.URL + p)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		_ = res.Body.Close()
+	}
+	res, err := client.Head(server.URL + "/readingroom/docs/DOC-1.pdf")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	_ = res.Body.Close()
+
+	if err = m.Close(); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if !m.Has(server.URL+"/readingroom/document/doc-1") || !m.Has(server.URL+"/readingroom/docs/DOC-1.pdf") {
+		t.Errorf("expected document and PDF to be mirrored")
+	}
+	if m.Has(server.URL+"/readingroom/document/denied") || m.Has(server.URL+"/missing") {
+		t.Errorf("expected access denied and missing pages to be skipped")
+	}
+
+	entries, err := ReadManifest(dir)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 manifest entries, got %d", len(entries))
+	}
+
+	entry := entries[server.URL+"/readingroom/docs/DOC-1.pdf"]
+	data, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(entry.Path)))
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if string(data) != "%PDF-1.4" || entry.Size != 8 || entry.ContentType != "application/pdf" {
+		t.Errorf("unexpected mirrored PDF: %q %+v", data, entry)
+	}
+
+	reopened, err := NewMirror(dir)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer func() {
+		_ = reopened.Close()
+	}()
+	if !reopened.Has(server.URL + "/readingroom/document/doc-1") {
+		t.Errorf("expected reopened mirror to load the manifest")
+	}
+}
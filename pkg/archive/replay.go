@@ -0,0 +1,217 @@
+package archive
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+var ErrNoArchive = errors.New("no mirror or WARC files found")
+
+// notArchived answers requests for URLs missing from the archive the same way the reading room
+// answers requests for pages that do not exist, so crawls end where the archived crawl ended.
+func notArchived(req *http.Request) *http.Response {
+	return &http.Response{
+		Status:        "404 Not Found",
+		StatusCode:    http.StatusNotFound,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": {"text/plain; charset=utf-8"}},
+		Body:          http.NoBody,
+		ContentLength: 0,
+		Request:       req,
+	}
+}
+
+// NewReplayTransport returns a transport serving reading room requests from path instead of the live site.
+// path may be a mirror directory, a WARC file or a directory of WARC files.
+func NewReplayTransport(path string) (http.RoundTripper, error) {
+	if _, err := os.Stat(filepath.Join(path, ManifestName)); err == nil {
+		return NewMirrorTransport(path)
+	}
+	return NewWARCTransport(path)
+}
+
+// MirrorTransport is an http.RoundTripper that answers GET and HEAD requests from a Mirror.
+type MirrorTransport struct {
+	dir     string
+	entries map[string]*ManifestEntry
+}
+
+func NewMirrorTransport(dir string) (*MirrorTransport, error) {
+	entries, err := ReadManifest(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %s", ErrNoArchive, dir)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &MirrorTransport{dir: dir, entries: entries}, nil
+}
+
+func (t *MirrorTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	entry, ok := t.entries[req.URL.String()]
+	if !ok || (req.Method != http.MethodGet && req.Method != http.MethodHead) {
+		return notArchived(req), nil
+	}
+
+	res := &http.Response{
+		Status:        strconv.Itoa(entry.Status) + " " + http.StatusText(entry.Status),
+		StatusCode:    entry.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{},
+		Body:          http.NoBody,
+		ContentLength: entry.Size,
+		Request:       req,
+	}
+	if entry.ContentType != "" {
+		res.Header.Set("Content-Type", entry.ContentType)
+	}
+	res.Header.Set("Content-Length", strconv.FormatInt(entry.Size, 10))
+
+	if req.Method == http.MethodGet {
+		f, err := os.Open(filepath.Join(t.dir, filepath.FromSlash(entry.Path)))
+		if err != nil {
+			return nil, fmt.Errorf("failed to open mirrored file for '%s': %w", entry.URL, err)
+		}
+		res.Body = f
+	}
+
+	return res, nil
+}
+
+type warcLocation struct {
+	file   string
+	offset int64
+	length int64
+}
+
+// WARCTransport is an http.RoundTripper that answers requests from the response records of WARC files.
+// A HEAD request is answered with the headers of an archived GET when no HEAD was archived.
+type WARCTransport struct {
+	responses map[string]warcLocation
+}
+
+func warcKey(method, target string) string {
+	return method + " " + target
+}
+
+// NewWARCTransport indexes the WARC file at path, or every *.warc file in the directory at path.
+// Later captures of a URL take precedence over earlier ones.
+func NewWARCTransport(path string) (*WARCTransport, error) {
+	files := []string{path}
+	if info, err := os.Stat(path); err != nil {
+		return nil, err
+	} else if info.IsDir() {
+		if files, err = filepath.Glob(filepath.Join(path, "*.warc")); err != nil {
+			return nil, err
+		}
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrNoArchive, path)
+	}
+
+	t := &WARCTransport{responses: make(map[string]warcLocation)}
+	for _, file := range files {
+		if err := t.index(file); err != nil {
+			return nil, fmt.Errorf("failed to index '%s': %w", file, err)
+		}
+	}
+	return t, nil
+}
+
+func (t *WARCTransport) index(file string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	type pending struct {
+		target string
+		loc    warcLocation
+	}
+	responses := make(map[string]pending)
+	methods := make(map[string]string)
+	var order []string
+
+	wr := NewWARCReader(f)
+	for {
+		record, err := wr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		switch record.Type() {
+		case "response":
+			id := record.Get("WARC-Record-ID")
+			responses[id] = pending{
+				target: record.Get("WARC-Target-URI"),
+				loc:    warcLocation{file: file, offset: record.Offset, length: record.Length},
+			}
+			order = append(order, id)
+		case "request":
+			block, err := record.Block()
+			if err != nil {
+				return err
+			}
+			method, _, _ := strings.Cut(string(block), " ")
+			methods[record.Get("WARC-Concurrent-To")] = method
+		}
+	}
+
+	for _, id := range order {
+		method, ok := methods[id]
+		if !ok {
+			// WARCs from other tools may lack request records, GET is by far the most likely
+			method = http.MethodGet
+		}
+		t.responses[warcKey(method, responses[id].target)] = responses[id].loc
+	}
+
+	return nil
+}
+
+func (t *WARCTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	loc, ok := t.responses[warcKey(req.Method, req.URL.String())]
+	if !ok && req.Method == http.MethodHead {
+		loc, ok = t.responses[warcKey(http.MethodGet, req.URL.String())]
+	}
+	if !ok {
+		return notArchived(req), nil
+	}
+
+	f, err := os.Open(loc.file)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	block := make([]byte, loc.length)
+	if _, err = f.ReadAt(block, loc.offset); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrMalformedWARC, err)
+	}
+
+	res, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(block)), req)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrMalformedWARC, err)
+	}
+	return res, nil
+}
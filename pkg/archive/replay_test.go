@@ -0,0 +1,108 @@
+package archive
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	http2 "ciascrape/pkg/http"
+)
+
+func testReadingRoom() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/readingroom/document/doc-1":
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			_, _ = w.Write([]byte("<h1>doc 1</h1>"))
+		case "/readingroom/docs/DOC-1.pdf":
+			w.Header().Set("Content-Type", "application/pdf")
+			_, _ = w.Write([]byte("%PDF-1.4"))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+}
+
+// archiveReadingRoom records a few exchanges with a fake reading room to both a mirror and a WARC file.
+func archiveReadingRoom(t *testing.T) (base, mirrorDir, warcDir string) {
+	t.Helper()
+	server := testReadingRoom()
+	defer server.Close()
+
+	mirrorDir, warcDir = t.TempDir(), t.TempDir()
+	m, err := NewMirror(mirrorDir)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	w, err := NewWARCWriter(warcDir)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	client := http2.NewClient().WithRecorder(m).WithRecorder(w)
+	for _, p := range []string{"/readingroom/document/doc-1", "/readingroom/docs/DOC-1.pdf"} {
+		res, err := client.Get(server.URL + p)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		_ = res.Body.Close()
+	}
+
+	if err = m.Close(); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if err = w.Close(); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	return server.URL, mirrorDir, warcDir
+}
+
+func TestReplayTransport(t *testing.T) {
+	base, mirrorDir, warcDir := archiveReadingRoom(t)
+
+	for name, dir := range map[string]string{"mirror": mirrorDir, "warc": warcDir} {
+		rt, err := NewReplayTransport(dir)
+		if err != nil {
+			t.Fatalf("%s: expected no error, got %v", name, err)
+		}
+		client := http2.NewClient().WithTransport(rt)
+
+		res, err := client.Get(base + "/readingroom/docs/DOC-1.pdf")
+		if err != nil {
+			t.Fatalf("%s: expected no error, got %v", name, err)
+		}
+		body, _ := io.ReadAll(res.Body)
+		_ = res.Body.Close()
+		if res.StatusCode != http.StatusOK || string(body) != "%PDF-1.4" {
+			t.Errorf("%s: expected archived PDF, got %d %q", name, res.StatusCode, body)
+		}
+		if ct := res.Header.Get("Content-Type"); ct != "application/pdf" {
+			t.Errorf("%s: expected application/pdf, got %s", name, ct)
+		}
+
+		res, err = client.Head(base + "/readingroom/document/doc-1")
+		if err != nil {
+			t.Fatalf("%s: expected no error, got %v", name, err)
+		}
+		_ = res.Body.Close()
+		if res.StatusCode != http.StatusOK {
+			t.Errorf("%s: expected HEAD of an archived page to succeed, got %d", name, res.StatusCode)
+		}
+
+		res, err = client.Get(base + "/readingroom/document/doc-2")
+		if err != nil {
+			t.Fatalf("%s: expected no error, got %v", name, err)
+		}
+		_ = res.Body.Close()
+		if res.StatusCode != http.StatusNotFound {
+			t.Errorf("%s: expected 404 for a page missing from the archive, got %d", name, res.StatusCode)
+		}
+	}
+}
+
+func TestNewReplayTransport_Empty(t *testing.T) {
+	if _, err := NewReplayTransport(t.TempDir()); err == nil {
+		t.Errorf("expected error for a directory without an archive, got nil")
+	}
+}
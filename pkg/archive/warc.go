@@ -0,0 +1,340 @@
+package archive
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	WARCVersion        = "WARC/1.1"
+	DefaultWARCMaxSize = 1 << 30
+	DefaultWARCPrefix  = "cia_scrape"
+
+	warcDateFormat = "2006-01-02T15:04:05Z"
+	warcConformsTo = "http://iipc.github.io/warc-specifications/specifications/warc-format/warc-1.1/"
+)
+
+// WARCWriter writes every exchange it records as a request and a response record to WARC 1.1 files
+// in a directory, starting a new file once the current one has grown past the configured size.
+// Bodies are written as the client received them, i.e. after any transfer or content decoding,
+// and the matching headers are left out by net/http.
+type WARCWriter struct {
+	dir     string
+	prefix  string
+	maxSize int64
+	file    *os.File
+	size    int64
+	serial  int
+	files   []string
+	mu      sync.Mutex
+}
+
+// NewWARCWriter prepares a writer for dir. The first file is only created once something is recorded.
+func NewWARCWriter(dir string) (*WARCWriter, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create WARC directory: %w", err)
+	}
+	return &WARCWriter{
+		dir:     dir,
+		prefix:  DefaultWARCPrefix,
+		maxSize: DefaultWARCMaxSize,
+	}, nil
+}
+
+// WithMaxSize sets the size in bytes after which a new WARC file is started.
+func (w *WARCWriter) WithMaxSize(size int64) *WARCWriter {
+	if size > 0 {
+		w.maxSize = size
+	}
+	return w
+}
+
+// WithPrefix sets the prefix of the WARC file names.
+func (w *WARCWriter) WithPrefix(prefix string) *WARCWriter {
+	if prefix != "" {
+		w.prefix = prefix
+	}
+	return w
+}
+
+// Files returns the paths of the WARC files written so far.
+func (w *WARCWriter) Files() []string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return append([]string(nil), w.files...)
+}
+
+func newRecordID() string {
+	var u [16]byte
+	_, _ = rand.Read(u[:])
+	u[6] = u[6]&0x0f | 0x40
+	u[8] = u[8]&0x3f | 0x80
+	return fmt.Sprintf("<urn:uuid:%x-%x-%x-%x-%x>", u[0:4], u[4:6], u[6:8], u[8:10], u[10:])
+}
+
+func sha1Digest(data []byte) string {
+	sum := sha1.Sum(data)
+	return "sha1:" + base32.StdEncoding.EncodeToString(sum[:])
+}
+
+type warcHeader struct {
+	name, value string
+}
+
+func writeWARCRecord(buf *bytes.Buffer, headers []warcHeader, block []byte) {
+	buf.WriteString(WARCVersion + "\r\n")
+	for _, h := range headers {
+		buf.WriteString(h.name + ": " + h.value + "\r\n")
+	}
+	_, _ = fmt.Fprintf(buf, "WARC-Block-Digest: %s\r\n", sha1Digest(block))
+	_, _ = fmt.Fprintf(buf, "Content-Length: %d\r\n\r\n", len(block))
+	buf.Write(block)
+	buf.WriteString("\r\n\r\n")
+}
+
+func httpRequestBlock(req *http.Request) []byte {
+	buf := &bytes.Buffer{}
+	_, _ = fmt.Fprintf(buf, "%s %s HTTP/1.1\r\n", req.Method, req.URL.RequestURI())
+	_, _ = fmt.Fprintf(buf, "Host: %s\r\n", req.URL.Host)
+	_ = req.Header.Write(buf)
+	buf.WriteString("\r\n")
+	return buf.Bytes()
+}
+
+func httpResponseBlock(res *http.Response, body []byte) []byte {
+	major, minor := res.ProtoMajor, res.ProtoMinor
+	if major == 0 {
+		major, minor = 1, 1
+	}
+	buf := &bytes.Buffer{}
+	_, _ = fmt.Fprintf(buf, "HTTP/%d.%d %s\r\n", major, minor, res.Status)
+	_ = res.Header.Write(buf)
+	buf.WriteString("\r\n")
+	buf.Write(body)
+	return buf.Bytes()
+}
+
+func (w *WARCWriter) Record(req *http.Request, res *http.Response, body []byte) error {
+	date := time.Now().UTC().Format(warcDateFormat)
+	target := req.URL.String()
+	responseID := newRecordID()
+
+	buf := &bytes.Buffer{}
+	writeWARCRecord(buf, []warcHeader{
+		{"WARC-Type", "response"},
+		{"WARC-Record-ID", responseID},
+		{"WARC-Date", date},
+		{"WARC-Target-URI", target},
+		{"WARC-Payload-Digest", sha1Digest(body)},
+		{"Content-Type", "application/http; msgtype=response"},
+	}, httpResponseBlock(res, body))
+	writeWARCRecord(buf, []warcHeader{
+		{"WARC-Type", "request"},
+		{"WARC-Record-ID", newRecordID()},
+		{"WARC-Date", date},
+		{"WARC-Target-URI", target},
+		{"WARC-Concurrent-To", responseID},
+		{"Content-Type", "application/http; msgtype=request"},
+	}, httpRequestBlock(req))
+
+	return w.write(buf.Bytes())
+}
+
+func (w *WARCWriter) write(data []byte) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.file == nil || w.size >= w.maxSize {
+		if err := w.rotate(); err != nil {
+			return err
+		}
+	}
+
+	n, err := w.file.Write(data)
+	w.size += int64(n)
+	if err != nil {
+		return fmt.Errorf("failed to write WARC record: %w", err)
+	}
+	return nil
+}
+
+// rotate closes the current file and starts a new one with a warcinfo record.
+func (w *WARCWriter) rotate() error {
+	if err := w.closeFile(); err != nil {
+		return err
+	}
+
+	var (
+		f    *os.File
+		name string
+		err  error
+	)
+	for {
+		w.serial++
+		name = fmt.Sprintf("%s-%s-%05d.warc", w.prefix, time.Now().UTC().Format("20060102150405"), w.serial)
+		f, err = os.OpenFile(filepath.Join(w.dir, name), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+		if !errors.Is(err, os.ErrExist) {
+			break
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("failed to create WARC file: %w", err)
+	}
+
+	buf := &bytes.Buffer{}
+	writeWARCRecord(buf, []warcHeader{
+		{"WARC-Type", "warcinfo"},
+		{"WARC-Record-ID", newRecordID()},
+		{"WARC-Date", time.Now().UTC().Format(warcDateFormat)},
+		{"WARC-Filename", name},
+		{"Content-Type", "application/warc-fields"},
+	}, []byte("software: cia_scrape\r\nformat: WARC File Format 1.1\r\nconformsTo: "+warcConformsTo+"\r\n"))
+
+	n, err := f.Write(buf.Bytes())
+	if err != nil {
+		_ = f.Close()
+		return fmt.Errorf("failed to write warcinfo record: %w", err)
+	}
+
+	w.file = f
+	w.size = int64(n)
+	w.files = append(w.files, f.Name())
+
+	return nil
+}
+
+func (w *WARCWriter) closeFile() error {
+	if w.file == nil {
+		return nil
+	}
+	f := w.file
+	w.file = nil
+	if err := f.Sync(); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func (w *WARCWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.closeFile()
+}
+
+// WARCRecord is a record read by a WARCReader. Its block is read lazily through Block.
+type WARCRecord struct {
+	header map[string]string
+	// Offset is the position of the block within the WARC file.
+	Offset int64
+	Length int64
+	reader *WARCReader
+}
+
+// Get returns the value of the named header field. Field names are case-insensitive.
+func (r *WARCRecord) Get(name string) string {
+	return r.header[strings.ToLower(name)]
+}
+
+func (r *WARCRecord) Type() string {
+	return r.Get("WARC-Type")
+}
+
+// Block reads the block of the record. It must be called before the next call to WARCReader.Next.
+func (r *WARCRecord) Block() ([]byte, error) {
+	if r.reader.record != r || r.reader.unread != r.Length {
+		return nil, ErrRecordConsumed
+	}
+	block := make([]byte, r.Length)
+	n, err := io.ReadFull(r.reader.r, block)
+	r.reader.offset += int64(n)
+	r.reader.unread -= int64(n)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrMalformedWARC, err)
+	}
+	return block, nil
+}
+
+// WARCReader reads the records of an uncompressed WARC file one after the other.
+type WARCReader struct {
+	r      *bufio.Reader
+	offset int64
+	unread int64
+	record *WARCRecord
+}
+
+var (
+	ErrMalformedWARC  = errors.New("malformed WARC record")
+	ErrRecordConsumed = errors.New("WARC record block already consumed")
+)
+
+func NewWARCReader(r io.Reader) *WARCReader {
+	return &WARCReader{r: bufio.NewReader(r)}
+}
+
+func (wr *WARCReader) readLine() (string, error) {
+	line, err := wr.r.ReadString('\n')
+	wr.offset += int64(len(line))
+	return strings.TrimRight(line, "\r\n"), err
+}
+
+// Next skips whatever is left of the current record and returns the header of the next one, or io.EOF.
+func (wr *WARCReader) Next() (*WARCRecord, error) {
+	if wr.record != nil {
+		// the rest of the block plus the two CRLFs ending the record
+		n, err := wr.r.Discard(int(wr.unread) + 4)
+		wr.offset += int64(n)
+		wr.record = nil
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrMalformedWARC, err)
+		}
+	}
+
+	line, err := wr.readLine()
+	for err == nil && line == "" {
+		line, err = wr.readLine()
+	}
+	if err == io.EOF && line == "" {
+		return nil, io.EOF
+	}
+	if !strings.HasPrefix(line, "WARC/") {
+		return nil, fmt.Errorf("%w: unexpected version line %q", ErrMalformedWARC, line)
+	}
+
+	record := &WARCRecord{header: make(map[string]string), reader: wr}
+	for {
+		if line, err = wr.readLine(); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrMalformedWARC, err)
+		}
+		if line == "" {
+			break
+		}
+		name, value, ok := strings.Cut(line, ":")
+		if !ok {
+			return nil, fmt.Errorf("%w: bad header line %q", ErrMalformedWARC, line)
+		}
+		record.header[strings.ToLower(strings.TrimSpace(name))] = strings.TrimSpace(value)
+	}
+
+	if record.Length, err = strconv.ParseInt(record.Get("Content-Length"), 10, 64); err != nil || record.Length < 0 {
+		return nil, fmt.Errorf("%w: bad Content-Length %q", ErrMalformedWARC, record.Get("Content-Length"))
+	}
+	record.Offset = wr.offset
+	wr.unread = record.Length
+	wr.record = record
+
+	return record, nil
+}
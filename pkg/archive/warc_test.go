@@ -0,0 +1,154 @@
+package archive
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	http2 "ciascrape/pkg/http"
+)
+
+type testWARCRecord struct {
+	*WARCRecord
+	block []byte
+}
+
+func readTestWARC(t *testing.T, name string) []testWARCRecord {
+	t.Helper()
+	f, err := os.Open(name)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+	var records []testWARCRecord
+	wr := NewWARCReader(f)
+	for {
+		record, err := wr.Next()
+		if err == io.EOF {
+			return records
+		}
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		block, err := record.Block()
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		records = append(records, testWARCRecord{WARCRecord: record, block: block})
+	}
+}
+
+func TestWARCWriter_RecordsExchanges(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/pdf")
+		_, _ = w.Write([]byte("%PDF-1.4"))
+	}))
+	defer server.Close()
+
+	w, err := NewWARCWriter(t.TempDir())
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	client := http2.NewClient().WithRecorder(w)
+
+	res, err := client.Get(server.URL + "/readingroom/docs/DOC-1.pdf?x=1")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if body, _ := io.ReadAll(res.Body); string(body) != "%PDF-1.4" {
+		t.Errorf("expected caller to still read the body, got %q", body)
+	}
+	_ = res.Body.Close()
+	res, err = client.Head(server.URL + "/readingroom/docs/DOC-1.pdf")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	_ = res.Body.Close()
+
+	if err = w.Close(); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	files := w.Files()
+	if len(files) != 1 {
+		t.Fatalf("expected 1 WARC file, got %d", len(files))
+	}
+	records := readTestWARC(t, files[0])
+	if len(records) != 5 {
+		t.Fatalf("expected warcinfo and 2 request/response pairs, got %d records", len(records))
+	}
+
+	types := []string{"warcinfo", "response", "request", "response", "request"}
+	for i, record := range records {
+		if record.Get("WARC-Type") != types[i] {
+			t.Errorf("record %d: expected %s, got %s", i, types[i], record.Get("WARC-Type"))
+		}
+		if record.Get("WARC-Block-Digest") != sha1Digest(record.block) {
+			t.Errorf("record %d: block digest mismatch", i)
+		}
+		if record.Get("WARC-Date") == "" || record.Get("WARC-Record-ID") == "" {
+			t.Errorf("record %d: missing WARC-Date or WARC-Record-ID", i)
+		}
+	}
+
+	response, request := records[1], records[2]
+	if target := server.URL + "/readingroom/docs/DOC-1.pdf?x=1"; response.Get("WARC-Target-URI") != target {
+		t.Errorf("expected target %s, got %s", target, response.Get("WARC-Target-URI"))
+	}
+	if request.Get("WARC-Concurrent-To") != response.Get("WARC-Record-ID") {
+		t.Errorf("expected request to refer to its response")
+	}
+	if response.Get("WARC-Payload-Digest") != sha1Digest([]byte("%PDF-1.4")) {
+		t.Errorf("payload digest mismatch: %s", response.Get("WARC-Payload-Digest"))
+	}
+	if !bytes.HasPrefix(response.block, []byte("HTTP/1.1 200 OK\r\n")) || !bytes.HasSuffix(response.block, []byte("\r\n\r\n%PDF-1.4")) {
+		t.Errorf("unexpected response block: %q", response.block)
+	}
+	if !bytes.HasPrefix(request.block, []byte("GET /readingroom/docs/DOC-1.pdf?x=1 HTTP/1.1\r\n")) {
+		t.Errorf("unexpected request block: %q", request.block)
+	}
+	if !bytes.HasPrefix(records[4].block, []byte("HEAD /readingroom/docs/DOC-1.pdf HTTP/1.1\r\n")) {
+		t.Errorf("expected HEAD probe to be recorded, got %q", records[4].block)
+	}
+}
+
+func TestWARCWriter_Rotates(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(bytes.Repeat([]byte("a"), 1024))
+	}))
+	defer server.Close()
+
+	w, err := NewWARCWriter(t.TempDir())
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	w.WithMaxSize(1024).WithPrefix("test")
+	client := http2.NewClient().WithRecorder(w)
+
+	for i := 0; i < 3; i++ {
+		res, err := client.Get(server.URL)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		_ = res.Body.Close()
+	}
+	if err = w.Close(); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	files := w.Files()
+	if len(files) != 3 {
+		t.Fatalf("expected 3 WARC files, got %d", len(files))
+	}
+	for _, name := range files {
+		records := readTestWARC(t, name)
+		if len(records) != 3 || records[0].Get("WARC-Type") != "warcinfo" {
+			t.Errorf("%s: expected warcinfo and one exchange, got %d records", name, len(records))
+		}
+	}
+}
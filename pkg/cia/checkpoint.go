@@ -0,0 +1,198 @@
+package cia
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const checkpointSaveInterval = 2 * time.Second
+
+var ErrCheckpointMismatch = errors.New("checkpoint belongs to a different collection")
+
+// Checkpoint records crawl progress for a Collection so that an interrupted run can be resumed.
+// A nil *Checkpoint is valid and records nothing.
+type Checkpoint struct {
+	Collection string           `json:"collection"`
+	Discovered map[int]bool     `json:"discovered"`
+	Parsed     map[int][]string `json:"parsed"`
+	Emitted    map[string]bool  `json:"emitted"`
+	UpdatedAt  time.Time        `json:"updated_at"`
+
+	path     string
+	lastSave time.Time
+	dirty    bool
+	mu       sync.Mutex
+}
+
+func NewCheckpoint(path, collection string) *Checkpoint {
+	return &Checkpoint{
+		Collection: collection,
+		Discovered: make(map[int]bool),
+		Parsed:     make(map[int][]string),
+		Emitted:    make(map[string]bool),
+		path:       path,
+	}
+}
+
+// LoadCheckpoint reads the checkpoint at path, returning a fresh one if the file does not exist yet.
+func LoadCheckpoint(path, collection string) (*Checkpoint, error) {
+	cp := NewCheckpoint(path, collection)
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return cp, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read checkpoint: %w", err)
+	}
+
+	if err = json.Unmarshal(data, cp); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal checkpoint '%s': %w", path, err)
+	}
+
+	if cp.Collection != collection {
+		return nil, fmt.Errorf("%w: '%s' != '%s'", ErrCheckpointMismatch, cp.Collection, collection)
+	}
+
+	if cp.Discovered == nil {
+		cp.Discovered = make(map[int]bool)
+	}
+	if cp.Parsed == nil {
+		cp.Parsed = make(map[int][]string)
+	}
+	if cp.Emitted == nil {
+		cp.Emitted = make(map[string]bool)
+	}
+
+	return cp, nil
+}
+
+func (cp *Checkpoint) Path() string {
+	if cp == nil {
+		return ""
+	}
+	return cp.path
+}
+
+func (cp *Checkpoint) markDiscovered(page int) {
+	if cp == nil {
+		return
+	}
+	cp.mu.Lock()
+	cp.Discovered[page] = true
+	cp.touch()
+	cp.mu.Unlock()
+}
+
+func (cp *Checkpoint) markParsed(page int, links []string) {
+	if cp == nil {
+		return
+	}
+	cp.mu.Lock()
+	cp.Discovered[page] = true
+	cp.Parsed[page] = links
+	cp.touch()
+	cp.mu.Unlock()
+}
+
+func (cp *Checkpoint) MarkEmitted(link string) {
+	if cp == nil {
+		return
+	}
+	cp.mu.Lock()
+	cp.Emitted[link] = true
+	cp.touch()
+	cp.mu.Unlock()
+}
+
+func (cp *Checkpoint) parsed(page int) ([]string, bool) {
+	if cp == nil {
+		return nil, false
+	}
+	cp.mu.Lock()
+	links, ok := cp.Parsed[page]
+	cp.mu.Unlock()
+	return links, ok
+}
+
+func (cp *Checkpoint) emitted(link string) bool {
+	if cp == nil {
+		return false
+	}
+	cp.mu.Lock()
+	ok := cp.Emitted[link]
+	cp.mu.Unlock()
+	return ok
+}
+
+// touch marks the checkpoint dirty and saves it if the last save is old enough.
+// The caller must hold cp.mu.
+func (cp *Checkpoint) touch() {
+	cp.dirty = true
+	if time.Since(cp.lastSave) < checkpointSaveInterval {
+		return
+	}
+	// on failure the checkpoint stays dirty, so the next touch or an explicit Save will try again
+	_ = cp.save()
+}
+
+// Save writes the checkpoint to disk if it has changed since the last save.
+func (cp *Checkpoint) Save() error {
+	if cp == nil {
+		return nil
+	}
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	if !cp.dirty {
+		return nil
+	}
+	return cp.save()
+}
+
+// save atomically replaces the checkpoint file so a crash mid-write never leaves a truncated checkpoint.
+// The caller must hold cp.mu.
+func (cp *Checkpoint) save() error {
+	cp.UpdatedAt = time.Now().UTC()
+
+	data, err := json.Marshal(cp)
+	if err != nil {
+		return err
+	}
+
+	dir := filepath.Dir(cp.path)
+	tmp, err := os.CreateTemp(dir, filepath.Base(cp.path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create checkpoint temp file: %w", err)
+	}
+
+	if _, err = tmp.Write(data); err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+		return fmt.Errorf("failed to write checkpoint: %w", err)
+	}
+
+	if err = os.Rename(tmp.Name(), cp.path); err != nil {
+		_ = os.Remove(tmp.Name())
+		return fmt.Errorf("failed to replace checkpoint: %w", err)
+	}
+
+	if d, err := os.Open(dir); err == nil {
+		_ = d.Sync()
+		_ = d.Close()
+	}
+
+	cp.lastSave = time.Now()
+	cp.dirty = false
+
+	return nil
+}
@@ -0,0 +1,104 @@
+package cia
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+)
+
+func TestCheckpoint_SaveAndLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.checkpoint.json")
+
+	cp := NewCheckpoint(path, "test")
+	cp.markDiscovered(3)
+	cp.markParsed(1, []string{"a", "b"})
+	cp.MarkEmitted("a")
+	if err := cp.Save(); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	entries, _ := os.ReadDir(filepath.Dir(path))
+	if len(entries) != 1 {
+		t.Errorf("expected only the checkpoint file to remain, got %d entries", len(entries))
+	}
+
+	loaded, err := LoadCheckpoint(path, "test")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if !loaded.Discovered[3] || !loaded.Discovered[1] {
+		t.Errorf("expected pages 1 and 3 to be discovered, got %v", loaded.Discovered)
+	}
+	if links, ok := loaded.parsed(1); !ok || len(links) != 2 {
+		t.Errorf("expected page 1 to be parsed with 2 links, got %v", links)
+	}
+	if !loaded.emitted("a") || loaded.emitted("b") {
+		t.Errorf("expected only 'a' to be emitted, got %v", loaded.Emitted)
+	}
+
+	if _, err = LoadCheckpoint(path, "other"); !errors.Is(err, ErrCheckpointMismatch) {
+		t.Errorf("expected error %v, got %v", ErrCheckpointMismatch, err)
+	}
+}
+
+func TestLoadCheckpoint_Missing(t *testing.T) {
+	cp, err := LoadCheckpoint(filepath.Join(t.TempDir(), "missing.json"), "test")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(cp.Parsed) != 0 {
+		t.Errorf("expected empty checkpoint, got %v", cp.Parsed)
+	}
+}
+
+func TestGetPages_Resume(t *testing.T) {
+	var heads = &atomic.Int64{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("page") != "" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if r.Method == http.MethodHead {
+			heads.Add(1)
+			return
+		}
+		_, _ = w.Write([]byte(`<h4 class="field-content"><a href="/readingroom/document/c">C</a></h4>`))
+	}))
+	defer server.Close()
+
+	EndpointBase = server.URL + "/"
+
+	path := filepath.Join(t.TempDir(), "test.checkpoint.json")
+	cp := NewCheckpoint(path, "test")
+	cp.markParsed(0, []string{"a", "b"})
+	cp.MarkEmitted("a")
+
+	collection := NewCollection("test").WithCheckpoint(cp)
+	if err := collection.GetPages(); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if heads.Load() != 1 {
+		t.Errorf("expected only the unparsed page to be probed, got %d probes", heads.Load())
+	}
+
+	var resumed []string
+	for link := range collection.Pages[0] {
+		resumed = append(resumed, link)
+	}
+	if len(resumed) != 1 || resumed[0] != "b" {
+		t.Errorf("expected only 'b' to be resumed from page 0, got %v", resumed)
+	}
+
+	loaded, err := LoadCheckpoint(path, "test")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if links, ok := loaded.parsed(1); !ok || len(links) != 1 || links[0] != EndpointBase+"readingroom/document/c" {
+		t.Errorf("expected page 1 to be recorded as parsed, got %v", links)
+	}
+}
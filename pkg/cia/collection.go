@@ -14,12 +14,18 @@ import (
 	"golang.org/x/sync/semaphore"
 
 	"ciascrape/pkg/bufs"
+	http2 "ciascrape/pkg/http"
 	"ciascrape/pkg/mu"
 )
 
 var (
 	EndpointBase    = "https://www.cia.gov/"
 	maxPagesDefault = 1000
+
+	// Client carries all reading room traffic so that it shares a single rate limiter.
+	Client = http2.NewClient().WithLimiter(
+		http2.NewLimiter(http2.DefaultRPS, http2.DefaultBurst).WithJitter(http2.DefaultJitter),
+	)
 )
 
 func EndpointCollection() string {
@@ -49,6 +55,7 @@ type Collection struct {
 	done         *atomic.Bool
 	maxDocuments int
 	startPage    int
+	checkpoint   *Checkpoint
 	mu           sync.RWMutex
 }
 
@@ -80,6 +87,42 @@ func (c *Collection) WithStartPage(startPage int) *Collection {
 	return c
 }
 
+// WithCheckpoint records crawl progress to cp. Pages already parsed in cp are not fetched again,
+// and documents already marked as emitted are not drained again.
+func (c *Collection) WithCheckpoint(cp *Checkpoint) *Collection {
+	c.checkpoint = cp
+	return c
+}
+
+// MarkEmitted records that link has been fully handled by the consumer of Drain.
+func (c *Collection) MarkEmitted(link string) {
+	c.checkpoint.MarkEmitted(link)
+}
+
+func (c *Collection) SaveCheckpoint() error {
+	return c.checkpoint.Save()
+}
+
+// resumePage replays the documents of a page that was parsed in a previous run.
+func (c *Collection) resumePage(i int, links []string) int {
+	channel := make(chan string, len(links))
+	for _, link := range links {
+		if !c.checkpoint.emitted(link) {
+			channel <- link
+		}
+	}
+	close(channel)
+
+	c.mu.Lock()
+	c.Pages[i] = channel
+	pageCt := len(c.Pages)
+	c.mu.Unlock()
+
+	log.Printf("resumed page %d from checkpoint (%d documents pending)", i, len(channel))
+
+	return pageCt
+}
+
 var pagesGoRoutines = semaphore.NewWeighted(500)
 
 func (c *Collection) GetPages() error {
@@ -89,13 +132,21 @@ func (c *Collection) GetPages() error {
 		c.maxDocuments = 20
 	}
 
+pages:
 	for i := c.startPage; ; i++ {
 		if i > c.maxDocuments/20 {
 			break
 		}
 
+		if links, ok := c.checkpoint.parsed(i); ok {
+			if c.resumePage(i, links)*20 >= c.maxDocuments {
+				break
+			}
+			continue
+		}
+
 		mu.GetMutex("net").RLock()
-		res, err := http.Head(PageURL(c.Name, i))
+		res, err := Client.Head(PageURL(c.Name, i))
 		mu.GetMutex("net").RUnlock()
 
 		if err != nil {
@@ -105,6 +156,7 @@ func (c *Collection) GetPages() error {
 		switch res.StatusCode {
 		case http.StatusOK:
 			log.Printf("found page %d", i)
+			c.checkpoint.markDiscovered(i)
 
 			var channel chan string
 			var pageCt int
@@ -115,33 +167,29 @@ func (c *Collection) GetPages() error {
 			pageCt = len(c.Pages)
 			c.mu.Unlock()
 
-			if pageCt*20 >= c.maxDocuments {
-				return nil
-			}
-
+			wg.Add(1)
 			go func() {
 				_ = pagesGoRoutines.Acquire(context.Background(), 1)
 				defer pagesGoRoutines.Release(1)
-				wg.Add(1)
 				if err := c.GetPage(i, channel, wg); err != nil {
 					log.Printf("error getting page %d: %v", i, err)
 				}
 			}()
 
-			sleepFactor := i - c.startPage
-			if sleepFactor > 300 {
-				sleepFactor /= 2
+			if pageCt*20 >= c.maxDocuments {
+				break pages
 			}
-			time.Sleep(time.Millisecond * time.Duration(sleepFactor*5))
+
 			continue
 
 		case http.StatusNotFound:
 			if i == 0 {
+				c.done.Store(true)
 				return ErrNoPages
 			}
 			wg.Wait()
 			c.done.Store(true)
-			return nil
+			return c.checkpoint.Save()
 		default:
 			c.done.Store(true)
 			return fmt.Errorf("%w: %d", ErrBadStatusCode, res.StatusCode)
@@ -150,41 +198,31 @@ func (c *Collection) GetPages() error {
 
 	wg.Wait()
 	c.done.Store(true)
-	return nil
+	return c.checkpoint.Save()
 }
 
 func (c *Collection) Drain(ctx context.Context) (chan string, chan bool) {
 	var documents = make(chan string, c.maxDocuments)
 
 	var (
-		seenMap = make(map[string]bool)
-		seenMu  sync.RWMutex
-		chanMu  sync.RWMutex
-		doneCh  = make(chan bool)
+		seenMap    = make(map[string]bool)
+		seenMu     sync.Mutex
+		forwarders sync.WaitGroup
+		doneCh     = make(chan bool)
 	)
 
 	go func() {
 		defer func() {
-			for {
-				if chanMu.TryLock() {
-					break
-				}
-				time.Sleep(100 * time.Millisecond)
-				print(".")
-				continue
-			}
-			doneCh <- true
-			close(documents)
+			// every page channel is closed once its page is parsed (or fails to), so waiting on the
+			// forwarders guarantees nothing is dropped before documents is closed.
+			forwarders.Wait()
 			close(doneCh)
+			close(documents)
 			log.Println("drained all documents")
 		}()
 		for i := c.startPage; ; i++ {
 		try:
 
-			if c.done.Load() {
-				return
-			}
-
 			select {
 			case <-ctx.Done():
 				return
@@ -204,26 +242,29 @@ func (c *Collection) Drain(ctx context.Context) (chan string, chan bool) {
 				goto try
 			}
 
+			forwarders.Add(1)
 			go func() {
+				defer forwarders.Done()
 				for page := range channel {
 
-					seenMu.RLock()
-					_, seenOK := seenMap[page]
-					if seenOK {
-						seenMu.RUnlock()
+					if c.checkpoint.emitted(page) {
 						continue
 					}
-					seenMu.RUnlock()
 
 					seenMu.Lock()
+					seenOK := seenMap[page]
 					seenMap[page] = true
 					seenMu.Unlock()
 
-					if !chanMu.TryRLock() {
+					if seenOK {
+						continue
+					}
+
+					select {
+					case documents <- page:
+					case <-ctx.Done():
 						return
 					}
-					documents <- page
-					chanMu.RUnlock()
 				}
 			}()
 		}
@@ -241,6 +282,8 @@ func ParsePage(res *http.Response) ([]string, error) {
 		break
 	case http.StatusNotFound:
 		return nil, fmt.Errorf("%w: %s", ErrPageNotFound, res.Request.URL.String())
+	case http.StatusForbidden, http.StatusTooManyRequests:
+		return nil, fmt.Errorf("%w: %s", ErrAccessDenied, res.Request.URL.String())
 	default:
 		return nil, fmt.Errorf("%w: %d", ErrBadStatusCode, res.StatusCode)
 	}
@@ -257,7 +300,15 @@ func ParsePage(res *http.Response) ([]string, error) {
 	}
 	data := buf.Bytes()[:n]
 
+	// the throttle page has no result links either, it must not be mistaken for the end of a listing
+	if IsAccessDenied(string(data)) {
+		return nil, fmt.Errorf("%w: %s", ErrAccessDenied, res.Request.URL.String())
+	}
+
 	matches := pageRegex.FindAllSubmatch(data, -1)
+	if len(matches) == 0 {
+		matches = searchResultRegex.FindAllSubmatch(data, -1)
+	}
 	if len(matches) == 0 {
 		return nil, fmt.Errorf("%w: %s", ErrNoDocuments, res.Request.URL.String())
 	}
@@ -275,18 +326,12 @@ func ParsePage(res *http.Response) ([]string, error) {
 
 func (c *Collection) GetPage(i int, channel chan string, wg *sync.WaitGroup) error {
 	defer wg.Done()
-
-	sleepFactor := i - c.startPage
-	if sleepFactor > 300 {
-		sleepFactor /= 2
-	}
-
-	time.Sleep(time.Millisecond * (time.Duration(i * 50)))
+	defer close(channel)
 
 	log.Printf("getting page %d", i)
 
 	mu.GetMutex("net").RLock()
-	res, err := http.Get(PageURL(c.Name, i))
+	res, err := Client.Get(PageURL(c.Name, i))
 	mu.GetMutex("net").RUnlock()
 
 	if err != nil {
@@ -301,13 +346,13 @@ func (c *Collection) GetPage(i int, channel chan string, wg *sync.WaitGroup) err
 		return err
 	}
 
+	c.checkpoint.markParsed(i, links)
+
 	for _, link := range links {
 		log.Printf("page %d found document: %s", i, link)
 		channel <- link
 	}
 
-	close(channel)
-
 	log.Printf("page %d has %d documents", i, len(links))
 
 	_ = res.Body.Close()
@@ -320,7 +365,7 @@ func (c *Collection) Validate() error {
 	defer c.mu.RUnlock()
 
 	mu.GetMutex("net").RLock()
-	res, err := http.Head(EndpointURL(c.Name))
+	res, err := Client.Head(EndpointURL(c.Name))
 	mu.GetMutex("net").RUnlock()
 
 	if err != nil {
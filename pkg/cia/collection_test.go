@@ -3,6 +3,7 @@ package cia
 import (
 	"bytes"
 	"compress/gzip"
+	"context"
 	"encoding/base64"
 	"errors"
 	"io"
@@ -12,8 +13,10 @@ import (
 	"strconv"
 	"strings"
 	"testing"
+	"time"
 
 	"ciascrape/pkg/bufs"
+	http2 "ciascrape/pkg/http"
 )
 
 const testDataPacked = `H4sIAAAAAAACA+2YUW+iQBDH3/0UG156fVgWFirYQxJbbc70Shvlcs8Iq5BDILDqeZ/+dqGYrZ5Ve+kl9TCKu7AzOzP85xcFACuIljZ4flkZ8GOvKLpSkPruOiOSbRWZlwBkWyhjyyxULW+B0rBevYzIqoDTiMQBEMaQRjRmPjbuQ722qK77aUJJQtkuHghzMu1KKCdeECWzPE3niAWxmLPryI88mAdZpw0VxTDNXFFUrCi6qiiKBrFkf3J7N6B3Cdze+B7cPY5uBxbyWMihfnrM1bHeGiaL+YTkVQ5VLSr7i8om9iYkBsK4ztz7mSbpfM0dQcoqeWH3n10Cp3R5zQLj/nY8b9fmdtiDo/5TnfzoZfIbJ29KM/NmhO204PvsxPF6hqLpExsXLxMSQtjKB9eRviniaRQTqAqa2r+RRb1JTOqLBY38H2tIEn4ykOwWsGjIxMaW5ewT2j1KPT/kd8hCbMpPjaNfpJywWPkqVFm0LDpJg3XpIq/9p0HAtwzsrXvJG8CK5jPxDIxYkBLwYtqVnvp3oJqW3dKVvCyLI9+jUZqgLJhKoMj9rcaYp8EiJgXivhA3LpBgBZmVnCUzibUt2HRWSGlWXCO0Wq1k1k/yLF1uN1uBXteaXIbD1bwT5WcQk2RGwy7GbWweEi13VHVoKRhW16AsHcayCu5vynlV8hY7VrVmA37n+OBN8iFBxLo5DUQevdJ1f9dX/MYUsCjhdIxSt1Kqvv+4Y56uwGYE1SthUiqwVW32bPuRya7zNi/JfnMJHobj8fDRAWO35w4eBo77fwCe1aABfAP4fwJ4prVjAK9pV23zkGj3AV7DsmE2hD+F8G1hQpYkOQPEM6EouF0qpcMQ/81xh+7XQf/yrJkuJv3xmK42TP9ATBe1dgzTVVM39EOi3cd01ZQVvWH6KUw3zulXewfnXCDsbbBvtXwec/ZI7+DRy6QbpDdIfyek72jtGKS3NWwo2iHV7mN6WzVk02igfgrUzfP7oa5qiqLxv3QYaiLVwZee0/8+GrruwAHOo3vmj9uFKjRPYxrMv+vTGEFrR2Fe1XR8SLT7KH/VkTsHGf8bRMEjvCMcAAA=`
@@ -34,6 +37,7 @@ func getTestData() {
 
 func init() {
 	getTestData()
+	Client.WithLimiter(http2.NewLimiter(1000, 1000))
 }
 
 func TestEndpointURL_ReturnsCorrectURL(t *testing.T) {
@@ -209,3 +213,113 @@ func TestValidate_CollectionNotFound(t *testing.T) {
 		t.Errorf("expected error %v, got %v", ErrCollectionNotFound, err)
 	}
 }
+
+// testCollectionServer serves a collection of pages listing pages, with failing pages answering 500.
+// Like PageURL, it treats page 0 and 1 as the same first page.
+func testCollectionServer(pages int, failing ...int) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/readingroom/collection/test" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		page := 1
+		if p := r.URL.Query().Get("page"); p != "" {
+			page, _ = strconv.Atoi(p)
+		}
+		if page >= pages {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		for _, f := range failing {
+			if page == f && r.Method == http.MethodGet {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+		}
+		for i := 0; i < 3; i++ {
+			_, _ = w.Write([]byte(`<div class="field-content"><a href="/readingroom/document/doc-` + strconv.Itoa(page) + `-` + strconv.Itoa(i) + `">Document</a></div>` + "\n"))
+		}
+	}))
+}
+
+// drainAll collects everything Drain emits, failing the test if the documents channel is not closed in time.
+func drainAll(t *testing.T, c *Collection) []string {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	documents, _ := c.Drain(ctx)
+
+	var links []string
+	timeout := time.After(10 * time.Second)
+	for {
+		select {
+		case link, ok := <-documents:
+			if !ok {
+				return links
+			}
+			links = append(links, link)
+		case <-timeout:
+			t.Fatalf("documents channel not closed, got %d documents so far", len(links))
+		}
+	}
+}
+
+func TestDrain_AfterGetPages(t *testing.T) {
+	server := testCollectionServer(3)
+	defer server.Close()
+
+	EndpointBase = server.URL + "/"
+	collection := NewCollection("test")
+	if err := collection.GetPages(); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	// every page is parsed before Drain starts, none of them may be skipped for the collection being done
+	if links := drainAll(t, collection); len(links) != 6 {
+		t.Errorf("expected 6 documents, got %d: %v", len(links), links)
+	}
+}
+
+func TestDrain_FailedPage(t *testing.T) {
+	server := testCollectionServer(3, 2)
+	defer server.Close()
+
+	EndpointBase = server.URL + "/"
+	collection := NewCollection("test")
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- collection.GetPages()
+	}()
+
+	links := drainAll(t, collection)
+	if err := <-errCh; err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(links) != 3 {
+		t.Errorf("expected the 3 documents of the page that did not fail, got %d: %v", len(links), links)
+	}
+}
+
+func TestGetPages_MaxPages(t *testing.T) {
+	server := testCollectionServer(10)
+	defer server.Close()
+
+	EndpointBase = server.URL + "/"
+	collection := NewCollection("test").WithMaxPages(3)
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- collection.GetPages()
+	}()
+
+	links := drainAll(t, collection)
+	if err := <-errCh; err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	// the last page within the limit is fetched too
+	if len(links) != 6 {
+		t.Errorf("expected 6 documents from 2 distinct pages, got %d: %v", len(links), links)
+	}
+}
@@ -0,0 +1,228 @@
+package cia
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"ciascrape/pkg/bufs"
+	"ciascrape/pkg/mu"
+)
+
+const (
+	collectionLinkRegexPattern = `(?s)<a href="(?:https?://www\.cia\.gov)?/readingroom/collection/([^"?#/]+)"[^>]*>(.*?)</a>`
+	pagerRegexPattern          = `\?page=(\d+)`
+	viewsRowSeparator          = `<div class="views-row`
+	pagerSeparator             = `<div class="item-list`
+
+	// maxIndexRetries is how many times a page of the collection index is fetched again after Access Denied.
+	maxIndexRetries = 10
+)
+
+var (
+	collectionLinkRegex = regexp.MustCompile(collectionLinkRegexPattern)
+	pagerRegex          = regexp.MustCompile(pagerRegexPattern)
+)
+
+func EndpointCollections() string {
+	return EndpointBase + "readingroom/historical-collections"
+}
+
+// CollectionInfo describes a reading room collection as listed in the collection index.
+type CollectionInfo struct {
+	Slug        string `json:"slug"`
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	// Documents is an estimate derived from the number of listing pages of the collection.
+	Documents int `json:"documents"`
+}
+
+func getBody(url string) ([]byte, error) {
+	mu.GetMutex("net").RLock()
+	res, err := Client.Get(url)
+	mu.GetMutex("net").RUnlock()
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		_ = res.Body.Close()
+	}()
+
+	switch res.StatusCode {
+	case http.StatusOK:
+		break
+	case http.StatusNotFound:
+		return nil, fmt.Errorf("%w: %s", ErrPageNotFound, url)
+	case http.StatusForbidden, http.StatusTooManyRequests:
+		return nil, throttled(url, res)
+	default:
+		return nil, fmt.Errorf("%w: %d", ErrBadStatusCode, res.StatusCode)
+	}
+
+	buf := bufs.GetBuffer()
+	defer bufs.PutBuffer(buf)
+
+	n, err := buf.ReadFrom(res.Body)
+	if err != nil {
+		return nil, fmt.Errorf("http response body read error: %w", err)
+	}
+
+	data := make([]byte, n)
+	copy(data, buf.Bytes())
+
+	if IsAccessDenied(string(data)) {
+		return nil, throttled(url, res)
+	}
+
+	return data, nil
+}
+
+func parseCollectionIndex(data []byte) []*CollectionInfo {
+	var infos []*CollectionInfo
+
+	rows := strings.Split(string(data), viewsRowSeparator)
+	for _, row := range rows[1:] {
+		// drop the remainder of the views-row opening tag and anything after the pager
+		if i := strings.Index(row, ">"); i >= 0 {
+			row = row[i+1:]
+		}
+		if i := strings.Index(row, pagerSeparator); i >= 0 {
+			row = row[:i]
+		}
+		match := collectionLinkRegex.FindStringSubmatchIndex(row)
+		if match == nil {
+			continue
+		}
+		info := &CollectionInfo{
+			Slug: row[match[2]:match[3]],
+			Name: htmlToText(row[match[4]:match[5]]),
+		}
+		info.Description = htmlToText(row[:match[0]] + row[match[1]:])
+		infos = append(infos, info)
+	}
+
+	return infos
+}
+
+// getIndexPage fetches a page of the collection index, retrying while the reading room denies access.
+func getIndexPage(url string) ([]byte, error) {
+	for retries := 0; ; retries++ {
+		data, err := getBody(url)
+		if !errors.Is(err, ErrAccessDenied) {
+			return data, err
+		}
+		if retries >= maxIndexRetries {
+			return nil, fmt.Errorf("%w: gave up after %d attempts", err, retries+1)
+		}
+		log.Printf("[err] access denied on collection index page '%s' (%d), retrying...", url, retries+1)
+	}
+}
+
+// listCollectionIndex walks the pages of the collection index without estimating document counts. It ends
+// at the first page without new collections, and fails rather than return a listing cut short by an error.
+func listCollectionIndex() ([]*CollectionInfo, error) {
+	var (
+		infos []*CollectionInfo
+		seen  = make(map[string]bool)
+	)
+
+	for i := 0; i < maxPagesDefault; i++ {
+		url := EndpointCollections()
+		if i > 0 {
+			url += "?page=" + strconv.Itoa(i)
+		}
+
+		data, err := getIndexPage(url)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list collections: %w", err)
+		}
+
+		added := 0
+		for _, info := range parseCollectionIndex(data) {
+			if seen[info.Slug] {
+				continue
+			}
+			seen[info.Slug] = true
+			infos = append(infos, info)
+			added++
+		}
+
+		if added == 0 {
+			break
+		}
+	}
+
+	if len(infos) == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrNoDocuments, EndpointCollections())
+	}
+
+	return infos, nil
+}
+
+// ListCollections scrapes the reading room collection index and estimates the size of each collection.
+func ListCollections() ([]*CollectionInfo, error) {
+	infos, err := listCollectionIndex()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, info := range infos {
+		if info.Documents, err = EstimateDocuments(info.Slug); err != nil {
+			log.Printf("[err] failed to estimate documents in collection '%s': %v", info.Slug, err)
+		}
+	}
+
+	return infos, nil
+}
+
+// EstimateDocuments approximates the number of documents in a collection from its first listing page.
+func EstimateDocuments(collection string) (int, error) {
+	data, err := getBody(PageURL(collection, 1))
+	if err != nil {
+		return 0, err
+	}
+
+	last := -1
+	for _, match := range pagerRegex.FindAllSubmatch(data, -1) {
+		if n, err := strconv.Atoi(string(match[1])); err == nil && n > last {
+			last = n
+		}
+	}
+
+	if last < 0 {
+		return len(pageRegex.FindAllSubmatch(data, -1)), nil
+	}
+
+	return (last + 1) * 20, nil
+}
+
+// SuggestCollections returns the slugs of listed collections whose slug or name resembles name.
+func SuggestCollections(name string) []string {
+	if strings.TrimSpace(name) == "" {
+		return nil
+	}
+
+	infos, err := listCollectionIndex()
+	if err != nil {
+		return nil
+	}
+
+	name = strings.ToLower(strings.Trim(name, "/ "))
+	var suggestions []string
+
+	for _, info := range infos {
+		slug := strings.ToLower(info.Slug)
+		display := strings.ToLower(info.Name)
+		if strings.Contains(slug, name) || strings.Contains(name, slug) || strings.Contains(display, name) {
+			suggestions = append(suggestions, info.Slug)
+		}
+	}
+
+	return suggestions
+}
@@ -0,0 +1,121 @@
+package cia
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+const testCollectionIndex = `<div class="view-content">
+  <div class="views-row views-row-1 views-row-odd views-row-first">
+    <div class="views-field views-field-name"><span class="field-content"><a href="/readingroom/collection/stargate">STARGATE</a></span></div>
+    <div class="views-field views-field-description"><div class="field-content"><p>Remote viewing &amp; psychic research.</p></div></div>
+  </div>
+  <div class="views-row views-row-2 views-row-even views-row-last">
+    <div class="views-field views-field-name"><span class="field-content"><a href="https://www.cia.gov/readingroom/collection/ufos-fact-or-fiction">UFOs: Fact or Fiction?</a></span></div>
+    <div class="views-field views-field-description"><div class="field-content"><p>Declassified UFO documents.</p></div></div>
+  </div>
+</div>
+<div class="item-list"><ul class="pager"><li class="pager-next"><a href="/readingroom/historical-collections?page=1">next</a></li></ul></div>`
+
+func testCollectionsServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/readingroom/historical-collections":
+			if r.URL.Query().Get("page") != "" {
+				_, _ = w.Write([]byte(`<div class="view-empty">no results</div>`))
+				return
+			}
+			_, _ = w.Write([]byte(testCollectionIndex))
+		case "/readingroom/collection/stargate":
+			_, _ = w.Write([]byte(`<li class="pager-last last"><a href="/readingroom/collection/stargate?page=604">last</a></li>`))
+		case "/readingroom/collection/ufos-fact-or-fiction":
+			_, _ = w.Write([]byte(testData))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+}
+
+func TestListCollections_Success(t *testing.T) {
+	server := testCollectionsServer()
+	defer server.Close()
+
+	EndpointBase = server.URL + "/"
+
+	infos, err := ListCollections()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(infos) != 2 {
+		t.Fatalf("expected 2 collections, got %d", len(infos))
+	}
+
+	if infos[0].Slug != "stargate" || infos[0].Name != "STARGATE" {
+		t.Errorf("expected stargate collection, got %+v", infos[0])
+	}
+	if infos[0].Description != "Remote viewing & psychic research." {
+		t.Errorf("expected description to be parsed, got '%s'", infos[0].Description)
+	}
+	if infos[0].Documents != 605*20 {
+		t.Errorf("expected %d documents, got %d", 605*20, infos[0].Documents)
+	}
+
+	if infos[1].Slug != "ufos-fact-or-fiction" || infos[1].Name != "UFOs: Fact or Fiction?" {
+		t.Errorf("expected ufos collection, got %+v", infos[1])
+	}
+	if infos[1].Documents == 0 {
+		t.Errorf("expected documents on a single page collection to be counted")
+	}
+}
+
+func TestSuggestCollections(t *testing.T) {
+	server := testCollectionsServer()
+	defer server.Close()
+
+	EndpointBase = server.URL + "/"
+
+	suggestions := SuggestCollections("ufos")
+	if len(suggestions) != 1 || suggestions[0] != "ufos-fact-or-fiction" {
+		t.Errorf("expected ufos-fact-or-fiction to be suggested, got %v", suggestions)
+	}
+}
+
+func TestListCollections_AccessDenied(t *testing.T) {
+	var denied atomic.Int32
+	server := testCollectionsServer()
+	defer server.Close()
+	throttling := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("page") == "1" && denied.Add(1) == 1 {
+			_, _ = w.Write([]byte("<HTML><HEAD>\n<TITLE>Access Denied</TITLE>\n</HEAD></HTML>"))
+			return
+		}
+		server.Config.Handler.ServeHTTP(w, r)
+	}))
+	defer throttling.Close()
+	EndpointBase = throttling.URL + "/"
+
+	infos, err := listCollectionIndex()
+	if err != nil || len(infos) != 2 {
+		t.Fatalf("expected both collections after the Access Denied page, got %v, %v", infos, err)
+	}
+	if denied.Load() != 2 {
+		t.Errorf("expected the denied page to be fetched again, got %d fetches", denied.Load())
+	}
+
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("page") == "1" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		server.Config.Handler.ServeHTTP(w, r)
+	}))
+	defer failing.Close()
+	EndpointBase = failing.URL + "/"
+
+	if infos, err = listCollectionIndex(); !errors.Is(err, ErrBadStatusCode) {
+		t.Errorf("expected a failed page not to end the listing silently, got %v, %v", infos, err)
+	}
+}
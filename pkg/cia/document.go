@@ -0,0 +1,326 @@
+package cia
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+
+	"ciascrape/pkg/bufs"
+	"ciascrape/pkg/mu"
+)
+
+const (
+	titleRegexPattern      = `(?s)<h1[^>]*class="documentFirstHeading"[^>]*>(.*?)</h1>`
+	fieldRegexPattern      = `(?s)<div class="field-label">\s*([^<]*?)\s*:(?:&nbsp;|\s)*</div>\s*<div class="field-items">\s*<div class="field-item[^"]*"[^>]*>(.*?)</div>`
+	attachmentRegexPattern = `(?s)<span class="file">.*?<a href="([^"]+)"`
+)
+
+var (
+	ErrAccessDenied = errors.New("access denied by reading room")
+
+	titleRegex      = regexp.MustCompile(titleRegexPattern)
+	fieldRegex      = regexp.MustCompile(fieldRegexPattern)
+	attachmentRegex = regexp.MustCompile(attachmentRegexPattern)
+)
+
+// Document is the CREST metadata scraped from a single reading room document page.
+type Document struct {
+	URL                    string            `json:"url"`
+	Title                  string            `json:"title"`
+	DocumentType           string            `json:"document_type,omitempty"`
+	Collection             string            `json:"collection,omitempty"`
+	DocumentNumber         string            `json:"document_number,omitempty"`
+	ReleaseDecision        string            `json:"release_decision,omitempty"`
+	OriginalClassification string            `json:"original_classification,omitempty"`
+	PageCount              int               `json:"page_count,omitempty"`
+	CreationDate           string            `json:"creation_date,omitempty"`
+	ReleaseDate            string            `json:"release_date,omitempty"`
+	PublicationDate        string            `json:"publication_date,omitempty"`
+	SequenceNumber         string            `json:"sequence_number,omitempty"`
+	CaseNumber             string            `json:"case_number,omitempty"`
+	ContentType            string            `json:"content_type,omitempty"`
+	Body                   string            `json:"body,omitempty"`
+	Attachments            []string          `json:"attachments,omitempty"`
+	Fields                 map[string]string `json:"fields,omitempty"`
+}
+
+// PDFs returns the attachment URLs that point at PDF files.
+func (d *Document) PDFs() []string {
+	pdfs := make([]string, 0, len(d.Attachments))
+	for _, a := range d.Attachments {
+		if strings.HasSuffix(strings.ToLower(a), ".pdf") {
+			pdfs = append(pdfs, a)
+		}
+	}
+	return pdfs
+}
+
+// Text renders the document as plain text: the title, the metadata fields sorted by label, then the body.
+func (d *Document) Text() string {
+	sb := &strings.Builder{}
+	sb.WriteString(d.Title + "\n\n")
+
+	labels := make([]string, 0, len(d.Fields))
+	for label := range d.Fields {
+		labels = append(labels, label)
+	}
+	sort.Strings(labels)
+	for _, label := range labels {
+		sb.WriteString(label + ": " + d.Fields[label] + "\n")
+	}
+
+	if d.Body != "" {
+		sb.WriteString("\n" + d.Body + "\n")
+	}
+	return sb.String()
+}
+
+func (d *Document) setField(label, value string) {
+	d.Fields[label] = value
+	switch strings.ToLower(label) {
+	case "document type":
+		d.DocumentType = value
+	case "collection":
+		d.Collection = value
+	case "document number (foia) /esdn (crest)", "document number":
+		d.DocumentNumber = value
+	case "release decision":
+		d.ReleaseDecision = value
+	case "original classification":
+		d.OriginalClassification = value
+	case "document page count", "pages":
+		d.PageCount, _ = strconv.Atoi(value)
+	case "document creation date":
+		d.CreationDate = value
+	case "document release date":
+		d.ReleaseDate = value
+	case "publication date":
+		d.PublicationDate = value
+	case "sequence number":
+		d.SequenceNumber = value
+	case "case number":
+		d.CaseNumber = value
+	case "content type":
+		d.ContentType = value
+	}
+}
+
+func absoluteURL(link string) string {
+	link = html.UnescapeString(link)
+	switch {
+	case strings.HasPrefix(link, "http://"), strings.HasPrefix(link, "https://"):
+		return link
+	case strings.HasPrefix(link, "/"):
+		return strings.TrimSuffix(EndpointBase, "/") + link
+	default:
+		return EndpointBase + link
+	}
+}
+
+// hasClass reports whether the element node carries a class starting with the given prefix.
+func hasClass(n *html.Node, prefix string) bool {
+	for _, attr := range n.Attr {
+		if attr.Key != "class" {
+			continue
+		}
+		for _, class := range strings.Fields(attr.Val) {
+			if strings.HasPrefix(class, prefix) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// findElement returns the first element below n, in document order, that is a div carrying the given class prefix.
+func findElement(n *html.Node, classPrefix string) *html.Node {
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type == html.ElementNode && c.Data == "div" && hasClass(c, classPrefix) {
+			return c
+		}
+		if found := findElement(c, classPrefix); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// parseBody returns the text of the page's body field. The field is located with an HTML parser
+// rather than a pattern so that divs nested inside the body do not cut it short.
+func parseBody(data []byte) string {
+	root, err := html.Parse(bytes.NewReader(data))
+	if err != nil {
+		return ""
+	}
+	field := findElement(root, "field-name-body")
+	if field == nil {
+		return ""
+	}
+	item := findElement(field, "field-item")
+	if item == nil {
+		return ""
+	}
+
+	sb := &strings.Builder{}
+	for c := item.FirstChild; c != nil; c = c.NextSibling {
+		if err := html.Render(sb, c); err != nil {
+			return ""
+		}
+	}
+	return htmlToText(sb.String())
+}
+
+// IsAccessDenied reports whether the given page content is the reading room's
+// throttle (Access Denied) or maintenance page rather than a real document.
+func IsAccessDenied(content string) bool {
+	content = strings.TrimSpace(content)
+	return strings.HasPrefix(content, "Access Denied") ||
+		strings.Contains(strings.ToLower(content), "<title>access denied</title>") ||
+		strings.Contains(content, "the link you are trying to access is undergoing scheduled maintenance")
+}
+
+// ParseDocument parses a reading room document page into a Document.
+func ParseDocument(res *http.Response) (*Document, error) {
+	defer func() {
+		_ = res.Body.Close()
+	}()
+	switch res.StatusCode {
+	case http.StatusOK:
+		break
+	case http.StatusNotFound:
+		return nil, fmt.Errorf("%w: %s", ErrPageNotFound, res.Request.URL.String())
+	case http.StatusForbidden:
+		return nil, fmt.Errorf("%w: %s", ErrAccessDenied, res.Request.URL.String())
+	default:
+		return nil, fmt.Errorf("%w: %d", ErrBadStatusCode, res.StatusCode)
+	}
+
+	buf := bufs.GetBuffer()
+	defer bufs.PutBuffer(buf)
+
+	n, err := buf.ReadFrom(res.Body)
+	if err != nil {
+		return nil, fmt.Errorf("http response body read error: %w", err)
+	}
+	if n == 0 {
+		return nil, fmt.Errorf("http response body is empty")
+	}
+
+	return ParseDocumentData(res.Request.URL.String(), buf.Bytes()[:n])
+}
+
+// ParseDocumentData parses the reading room document page at url, already read into data.
+func ParseDocumentData(url string, data []byte) (*Document, error) {
+	if IsAccessDenied(string(data)) {
+		return nil, fmt.Errorf("%w: %s", ErrAccessDenied, url)
+	}
+
+	doc := &Document{
+		URL:    url,
+		Fields: make(map[string]string),
+	}
+
+	if match := titleRegex.FindSubmatch(data); len(match) > 1 {
+		doc.Title = htmlToText(string(match[1]))
+	}
+
+	for _, match := range fieldRegex.FindAllSubmatch(data, -1) {
+		label := htmlToText(string(match[1]))
+		if label == "" {
+			continue
+		}
+		if value := htmlToText(string(match[2])); value != "" {
+			doc.setField(label, value)
+		}
+	}
+
+	doc.Body = parseBody(data)
+
+	seen := make(map[string]bool)
+	for _, match := range attachmentRegex.FindAllSubmatch(data, -1) {
+		link := absoluteURL(string(match[1]))
+		if seen[link] {
+			continue
+		}
+		seen[link] = true
+		doc.Attachments = append(doc.Attachments, link)
+	}
+
+	if doc.Title == "" && doc.DocumentNumber == "" {
+		return nil, fmt.Errorf("%w: %s", ErrNoDocuments, url)
+	}
+
+	return doc, nil
+}
+
+// GetDocument fetches and parses a reading room document page.
+func GetDocument(url string) (*Document, error) {
+	mu.GetMutex("net").RLock()
+	res, err := Client.Get(url)
+	mu.GetMutex("net").RUnlock()
+
+	if err != nil {
+		return nil, err
+	}
+
+	doc, err := ParseDocument(res)
+	if errors.Is(err, ErrAccessDenied) {
+		if err := Client.Throttled(context.Background(), res); err != nil {
+			log.Printf("[err] failed to rotate address: %v", err)
+		}
+	}
+
+	return doc, err
+}
+
+// GetFile downloads an attachment of a document, e.g. a PDF.
+func GetFile(url string) ([]byte, error) {
+	mu.GetMutex("net").RLock()
+	res, err := Client.Get(url)
+	mu.GetMutex("net").RUnlock()
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		_ = res.Body.Close()
+	}()
+
+	switch res.StatusCode {
+	case http.StatusOK:
+		break
+	case http.StatusNotFound:
+		return nil, fmt.Errorf("%w: %s", ErrPageNotFound, url)
+	case http.StatusForbidden, http.StatusTooManyRequests:
+		return nil, throttled(url, res)
+	default:
+		return nil, fmt.Errorf("%w: %d", ErrBadStatusCode, res.StatusCode)
+	}
+
+	buf := bufs.GetBuffer()
+	defer bufs.PutBuffer(buf)
+
+	if _, err = buf.ReadFrom(res.Body); err != nil {
+		return nil, fmt.Errorf("http response body read error: %w", err)
+	}
+
+	// a throttled download is an HTML page instead of the file
+	if !bytes.HasPrefix(buf.Bytes(), []byte("%PDF")) && IsAccessDenied(buf.String()) {
+		return nil, throttled(url, res)
+	}
+
+	data := make([]byte, buf.Len())
+	copy(data, buf.Bytes())
+
+	return data, nil
+}
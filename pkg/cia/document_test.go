@@ -0,0 +1,149 @@
+package cia
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+const testDocumentPage = `<html><head><title>(TAB A) TASK FORCE | CIA FOIA (foia.cia.gov)</title></head><body>
+<h1 class="documentFirstHeading">(TAB A) TASK FORCE</h1>
+<div class="field field-name-field-document-type field-type-taxonomy-term-reference field-label-inline clearfix"><div class="field-label">Document Type:&nbsp;</div><div class="field-items"><div class="field-item even">CREST</div></div></div>
+<div class="field field-name-field-collection field-type-taxonomy-term-reference field-label-inline clearfix"><div class="field-label">Collection:&nbsp;</div><div class="field-items"><div class="field-item even"><a href="/readingroom/collection/stargate">STARGATE</a></div></div></div>
+<div class="field field-name-field-document-number field-type-text field-label-inline clearfix"><div class="field-label">Document Number (FOIA) /ESDN (CREST):&nbsp;</div><div class="field-items"><div class="field-item even">CIA-RDP96-00788R001200410003-2</div></div></div>
+<div class="field field-name-field-release-decision field-type-taxonomy-term-reference field-label-inline clearfix"><div class="field-label">Release Decision:&nbsp;</div><div class="field-items"><div class="field-item even">RIFPUB</div></div></div>
+<div class="field field-name-field-original-classification field-type-taxonomy-term-reference field-label-inline clearfix"><div class="field-label">Original Classification:&nbsp;</div><div class="field-items"><div class="field-item even">S</div></div></div>
+<div class="field field-name-field-page-count field-type-number-integer field-label-inline clearfix"><div class="field-label">Document Page Count:&nbsp;</div><div class="field-items"><div class="field-item even">2</div></div></div>
+<div class="field field-name-field-document-creation-date field-type-datetime field-label-inline clearfix"><div class="field-label">Document Creation Date:&nbsp;</div><div class="field-items"><div class="field-item even"><span class="date-display-single" property="dc:date" datatype="xsd:dateTime" content="2016-11-04T00:00:00-04:00">November 4, 2016</span></div></div></div>
+<div class="field field-name-field-sequence-number field-type-text field-label-inline clearfix"><div class="field-label">Sequence Number:&nbsp;</div><div class="field-items"><div class="field-item even">3</div></div></div>
+<div class="field field-name-field-case-number field-type-text field-label-inline clearfix"><div class="field-label">Case Number:&nbsp;</div><div class="field-items"><div class="field-item even">F-2016-01234</div></div></div>
+<div class="field field-name-field-publication-date field-type-datetime field-label-inline clearfix"><div class="field-label">Publication Date:&nbsp;</div><div class="field-items"><div class="field-item even"><span class="date-display-single">November 8, 1995</span></div></div></div>
+<div class="field field-name-field-content-type field-type-taxonomy-term-reference field-label-inline clearfix"><div class="field-label">Content Type:&nbsp;</div><div class="field-items"><div class="field-item even">MISC</div></div></div>
+<div class="field field-name-field-file field-type-file field-label-inline clearfix"><div class="field-label">File:&nbsp;</div><div class="field-items"><div class="field-item even"><table class="sticky-enabled">
+ <thead><tr><th>Attachment</th><th>Size</th> </tr></thead>
+<tbody>
+ <tr class="odd"><td><span class="file"><img class="file-icon" alt="PDF icon" title="application/pdf" src="/readingroom/modules/file/icons/application-pdf.png" /> <a href="https://www.cia.gov/readingroom/docs/CIA-RDP96-00788R001200410003-2.pdf" type="application/pdf; length=22628">CIA-RDP96-00788R001200410003-2.pdf</a></span></td><td>22.1 KB</td> </tr>
+</tbody>
+</table>
+</div></div></div>
+<div class="field field-name-body field-type-text-with-summary field-label-hidden"><div class="field-items"><div class="field-item even" property="content:encoded"><p>Approved For Release 2000/08/08 &amp; more</p><p>TASK FORCE</p></div></div></div>
+</body></html>`
+
+func TestParseDocument_Success(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(testDocumentPage))
+	}))
+	defer server.Close()
+
+	EndpointBase = server.URL + "/"
+
+	doc, err := GetDocument(server.URL + "/readingroom/document/cia-rdp96-00788r001200410003-2")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	expected := map[string]string{
+		"title":                   "(TAB A) TASK FORCE",
+		"document type":           "CREST",
+		"collection":              "STARGATE",
+		"document number":         "CIA-RDP96-00788R001200410003-2",
+		"release decision":        "RIFPUB",
+		"original classification": "S",
+		"creation date":           "November 4, 2016",
+		"publication date":        "November 8, 1995",
+		"case number":             "F-2016-01234",
+		"sequence number":         "3",
+		"content type":            "MISC",
+		"body":                    "Approved For Release 2000/08/08 & more\nTASK FORCE",
+	}
+	actual := map[string]string{
+		"title":                   doc.Title,
+		"document type":           doc.DocumentType,
+		"collection":              doc.Collection,
+		"document number":         doc.DocumentNumber,
+		"release decision":        doc.ReleaseDecision,
+		"original classification": doc.OriginalClassification,
+		"creation date":           doc.CreationDate,
+		"publication date":        doc.PublicationDate,
+		"case number":             doc.CaseNumber,
+		"sequence number":         doc.SequenceNumber,
+		"content type":            doc.ContentType,
+		"body":                    doc.Body,
+	}
+	for k, v := range expected {
+		if actual[k] != v {
+			t.Errorf("expected %s to be '%s', got '%s'", k, v, actual[k])
+		}
+	}
+	if doc.PageCount != 2 {
+		t.Errorf("expected page count to be 2, got %d", doc.PageCount)
+	}
+	if len(doc.PDFs()) != 1 || doc.PDFs()[0] != "https://www.cia.gov/readingroom/docs/CIA-RDP96-00788R001200410003-2.pdf" {
+		t.Errorf("expected one PDF attachment, got %v", doc.Attachments)
+	}
+}
+
+func TestParseDocument_AccessDenied(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("<HTML><HEAD>\n<TITLE>Access Denied</TITLE>\n</HEAD><BODY>\n<H1>Access Denied</H1>\n</BODY></HTML>"))
+	}))
+	defer server.Close()
+
+	_, err := GetDocument(server.URL + "/readingroom/document/test")
+	if !errors.Is(err, ErrAccessDenied) {
+		t.Errorf("expected error %v, got %v", ErrAccessDenied, err)
+	}
+}
+
+func TestHTMLToText(t *testing.T) {
+	in := "<script>alert(1)</script><p>one&nbsp;two</p>\n\n\n\n<div>three<br/>four</div>"
+	expected := "one two\n\nthree\nfour"
+	if out := htmlToText(in); out != expected {
+		t.Errorf("expected %q, got %q", expected, out)
+	}
+}
+
+func TestDocument_Text(t *testing.T) {
+	doc := &Document{
+		Title:  "TASK FORCE",
+		Body:   "Approved For Release",
+		Fields: map[string]string{"Sequence Number": "3", "Collection": "STARGATE"},
+	}
+	expected := "TASK FORCE\n\nCollection: STARGATE\nSequence Number: 3\n\nApproved For Release\n"
+	if result := doc.Text(); result != expected {
+		t.Errorf("expected %q, got %q", expected, result)
+	}
+}
+
+func TestParseDocument_NestedBody(t *testing.T) {
+	page := `<html><body><h1 class="documentFirstHeading">NESTED</h1>
+<div class="field field-name-body field-type-text-with-summary field-label-hidden"><div class="field-items"><div class="field-item even" property="content:encoded"><div class="page"><div><p>first page</p></div></div>
+<div class="page"><p>second page</p></div></div></div></div>
+<div class="field field-name-field-foo"><div class="field-items"><div class="field-item even">not body</div></div></div>
+</body></html>`
+
+	doc, err := ParseDocumentData("https://example.com/readingroom/document/nested", []byte(page))
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if expected := "first page\n\nsecond page"; doc.Body != expected {
+		t.Errorf("expected body %q, got %q", expected, doc.Body)
+	}
+}
+
+func TestGetFile_AccessDenied(t *testing.T) {
+	var status int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "0")
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte("<HTML><HEAD>\n<TITLE>Access Denied</TITLE>\n</HEAD></HTML>"))
+	}))
+	defer server.Close()
+
+	for _, status = range []int{http.StatusOK, http.StatusForbidden, http.StatusTooManyRequests} {
+		if _, err := GetFile(server.URL + "/readingroom/docs/test.pdf"); !errors.Is(err, ErrAccessDenied) {
+			t.Errorf("status %d: expected error %v, got %v", status, ErrAccessDenied, err)
+		}
+	}
+}
@@ -0,0 +1,276 @@
+package cia
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+
+	"ciascrape/pkg/mu"
+)
+
+var (
+	// ErrNoPDF is returned when none of the places a PDF could be at has it.
+	ErrNoPDF = errors.New("no PDF found")
+
+	// PDFs resolves PDF links for the scraper, remembering which pattern works for each collection.
+	PDFs = NewPDFResolver()
+)
+
+// pdfSniffSize is how much of a response that doesn't say it is a PDF is read to tell what it is.
+const pdfSniffSize = 64 << 10
+
+// PDFLocation is where a PDF was found.
+type PDFLocation struct {
+	URL string
+	// Pattern names the candidate the PDF was found by, see PDFResolver.
+	Pattern string
+	// Moved is set if the PDF is neither where it was linked to nor where the reading room usually keeps
+	// it: the reading room redirected to it or its document page links it from elsewhere.
+	Moved bool
+}
+
+// pdfPattern turns a PDF link, or the link of a document page, into the URLs the PDF may be at.
+type pdfPattern struct {
+	name       string
+	candidates func(link string) ([]string, error)
+}
+
+// PDFResolver finds where the reading room keeps a PDF. It tries the link as is, with its file name
+// upper- and lower-cased, moved from readingroom/document to readingroom/docs, and finally the attachments
+// listed on the document page. Candidates are probed with HEAD requests, and the last pattern that worked
+// for a collection, other than the attachments, is tried first for its next PDFs.
+type PDFResolver struct {
+	patterns []pdfPattern
+	cache    map[string]string
+	mu       sync.RWMutex
+}
+
+func NewPDFResolver() *PDFResolver {
+	return &PDFResolver{
+		patterns: []pdfPattern{
+			{"as-linked", single(func(link string) string {
+				if strings.HasSuffix(strings.ToLower(link), ".pdf") {
+					return link
+				}
+				return link + ".pdf"
+			})},
+			{"upper-case", single(pdfName(strings.ToUpper))},
+			{"lower-case", single(pdfName(strings.ToLower))},
+			{"docs", single(func(link string) string {
+				return pdfName(strings.ToUpper)(strings.Replace(link, "readingroom/document/", "readingroom/docs/", 1))
+			})},
+			{"attachment", attachmentPDFs},
+		},
+		cache: make(map[string]string),
+	}
+}
+
+func single(f func(string) string) func(string) ([]string, error) {
+	return func(link string) ([]string, error) {
+		return []string{f(link)}, nil
+	}
+}
+
+// pdfName returns a func that recases the file name of a link and gives it a .pdf extension.
+func pdfName(recase func(string) string) func(string) string {
+	return func(link string) string {
+		dir, file := path.Split(link)
+		file = strings.TrimSuffix(strings.TrimSuffix(file, ".pdf"), ".PDF")
+		if recase != nil {
+			file = recase(file)
+		}
+		return dir + file + ".pdf"
+	}
+}
+
+// documentPage returns the document page a PDF link belongs to.
+func documentPage(link string) string {
+	dir, file := path.Split(link)
+	file = strings.ToLower(strings.TrimSuffix(strings.TrimSuffix(file, ".pdf"), ".PDF"))
+	return strings.Replace(dir, "readingroom/docs/", "readingroom/document/", 1) + file
+}
+
+// attachmentPDFs returns the PDFs the document page of link lists, the one named like link first.
+func attachmentPDFs(link string) ([]string, error) {
+	doc, err := GetDocument(documentPage(link))
+	switch {
+	case errors.Is(err, ErrPageNotFound), errors.Is(err, ErrNoDocuments):
+		return nil, nil
+	case err != nil:
+		return nil, err
+	}
+	name := strings.ToLower(pdfName(nil)(path.Base(link)))
+	pdfs := doc.PDFs()
+	for i, pdf := range pdfs {
+		if strings.ToLower(path.Base(pdf)) == name {
+			pdfs[0], pdfs[i] = pdfs[i], pdfs[0]
+			break
+		}
+	}
+	return pdfs, nil
+}
+
+// ordered returns the patterns with the one known to work for collection first.
+func (r *PDFResolver) ordered(collection string) []pdfPattern {
+	r.mu.RLock()
+	known := r.cache[collection]
+	r.mu.RUnlock()
+	patterns := make([]pdfPattern, 0, len(r.patterns))
+	for _, p := range r.patterns {
+		if p.name == known {
+			patterns = append([]pdfPattern{p}, patterns...)
+			continue
+		}
+		patterns = append(patterns, p)
+	}
+	return patterns
+}
+
+// Resolve finds the PDF of link, a PDF link or the link of a document page, in collection ("" if unknown).
+// It returns ErrNoPDF if no candidate has it and ErrAccessDenied if the reading room throttles us, so that
+// a missing PDF can be told from one we were kept from.
+func (r *PDFResolver) Resolve(collection, link string) (*PDFLocation, error) {
+	var (
+		tried   = make(map[string]bool)
+		lastErr error
+	)
+	for _, p := range r.ordered(collection) {
+		candidates, err := p.candidates(link)
+		if errors.Is(err, ErrAccessDenied) {
+			return nil, err
+		}
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		for _, candidate := range candidates {
+			if tried[candidate] {
+				continue
+			}
+			tried[candidate] = true
+
+			found, err := probePDF(candidate)
+			if errors.Is(err, ErrAccessDenied) {
+				return nil, err
+			}
+			if err != nil {
+				lastErr = err
+				continue
+			}
+			if found == "" {
+				continue
+			}
+
+			// an attachment only tells where this one PDF went: trying it first would fetch the document page
+			// of every other PDF of the collection
+			if p.name != "attachment" {
+				r.mu.Lock()
+				r.cache[collection] = p.name
+				r.mu.Unlock()
+			}
+
+			// the document page only has to be asked for PDFs that aren't where they are linked or usually kept
+			loc := &PDFLocation{URL: found, Pattern: p.name, Moved: found != candidate || p.name == "attachment"}
+			if loc.Moved {
+				log.Printf("[info] PDF '%s' moved to '%s'", link, found)
+			}
+			return loc, nil
+		}
+	}
+	if lastErr != nil {
+		return nil, fmt.Errorf("failed to resolve PDF '%s': %w", link, lastErr)
+	}
+	return nil, fmt.Errorf("%w: %s", ErrNoPDF, link)
+}
+
+// ResolvePDF finds the PDF of link in collection with PDFs.
+func ResolvePDF(collection, link string) (*PDFLocation, error) {
+	return PDFs.Resolve(collection, link)
+}
+
+func isPDFType(contentType string) bool {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch mediaType {
+	case "application/pdf", "application/x-pdf", "application/octet-stream", "binary/octet-stream":
+		return true
+	}
+	return false
+}
+
+// probePDF checks whether url answers with a PDF, returning where it ended up after redirects, or "" if
+// there is no PDF there. Responses that don't say what they are are sniffed with a GET of their first bytes.
+func probePDF(url string) (string, error) {
+	mu.GetMutex("net").RLock()
+	res, err := Client.Head(url)
+	mu.GetMutex("net").RUnlock()
+	if err != nil {
+		return "", err
+	}
+	_ = res.Body.Close()
+
+	switch res.StatusCode {
+	case http.StatusOK:
+		if isPDFType(res.Header.Get("Content-Type")) {
+			return res.Request.URL.String(), nil
+		}
+	case http.StatusMethodNotAllowed, http.StatusNotImplemented:
+	case http.StatusNotFound, http.StatusGone:
+		return "", nil
+	case http.StatusForbidden, http.StatusTooManyRequests:
+		return "", throttled(url, res)
+	default:
+		return "", fmt.Errorf("%w: %d", ErrBadStatusCode, res.StatusCode)
+	}
+
+	// only ask for the start of the file: recorders buffer whole responses, and the PDF itself is fetched later
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=0-%d", pdfSniffSize-1))
+	mu.GetMutex("net").RLock()
+	res, err = Client.Do(req)
+	mu.GetMutex("net").RUnlock()
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		_ = res.Body.Close()
+	}()
+	switch res.StatusCode {
+	case http.StatusOK, http.StatusPartialContent:
+	case http.StatusNotFound, http.StatusGone, http.StatusRequestedRangeNotSatisfiable:
+		return "", nil
+	case http.StatusForbidden, http.StatusTooManyRequests:
+		return "", throttled(url, res)
+	default:
+		return "", fmt.Errorf("%w: %d", ErrBadStatusCode, res.StatusCode)
+	}
+	head, err := io.ReadAll(io.LimitReader(res.Body, pdfSniffSize))
+	if err != nil {
+		return "", fmt.Errorf("http response body read error: %w", err)
+	}
+	switch {
+	case bytes.HasPrefix(bytes.TrimLeft(head, "\x00\t\n\r "), []byte("%PDF")):
+		return res.Request.URL.String(), nil
+	case IsAccessDenied(string(head)):
+		return "", throttled(url, res)
+	}
+	return "", nil
+}
+
+// throttled reports the throttled response res to the client and returns ErrAccessDenied for url.
+func throttled(url string, res *http.Response) error {
+	if err := Client.Throttled(context.Background(), res); err != nil {
+		log.Printf("[err] failed to rotate address: %v", err)
+	}
+	return fmt.Errorf("%w: %s", ErrAccessDenied, url)
+}
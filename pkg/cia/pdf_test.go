@@ -0,0 +1,195 @@
+package cia
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// pdfRoom is a stand-in for the reading room serving the PDFs at files, the document pages at pages and
+// answering every other path with status.
+func pdfRoom(files map[string]bool, pages map[string]string, status int) (*httptest.Server, *[]string) {
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Method+" "+r.URL.Path)
+		switch {
+		case strings.HasPrefix(r.URL.Path, "/moved/"):
+			http.Redirect(w, r, "/readingroom/docs/"+strings.TrimPrefix(r.URL.Path, "/moved/"), http.StatusMovedPermanently)
+		case files[r.URL.Path]:
+			w.Header().Set("Content-Type", "application/pdf")
+			_, _ = w.Write([]byte("%PDF-1.4"))
+		case pages[r.URL.Path] != "":
+			_, _ = w.Write([]byte(pages[r.URL.Path]))
+		default:
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(status)
+		}
+	}))
+	EndpointBase = server.URL + "/"
+	return server, &requests
+}
+
+func documentHTML(pdf string) string {
+	return `<h1 class="documentFirstHeading">MEMORANDUM</h1>
+<span class="file"><img class="file-icon" alt="PDF icon" /> <a href="` + pdf + `" type="application/pdf">memo.pdf</a></span>`
+}
+
+func TestPDFResolver_Patterns(t *testing.T) {
+	server, requests := pdfRoom(map[string]bool{
+		"/readingroom/docs/CIA-RDP96-00788R001200410003-2.pdf": true,
+		"/readingroom/docs/CIA-RDP96-00788R001200420001-3.pdf": true,
+	}, nil, http.StatusNotFound)
+	defer server.Close()
+
+	r := NewPDFResolver()
+	loc, err := r.Resolve("STARGATE", server.URL+"/readingroom/document/cia-rdp96-00788r001200410003-2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loc.URL != server.URL+"/readingroom/docs/CIA-RDP96-00788R001200410003-2.pdf" || loc.Pattern != "docs" || loc.Moved {
+		t.Errorf("unexpected location: %+v", loc)
+	}
+
+	// the pattern that worked is tried first for the next PDF of the collection
+	*requests = nil
+	if loc, err = r.Resolve("STARGATE", server.URL+"/readingroom/document/cia-rdp96-00788r001200420001-3"); err != nil {
+		t.Fatal(err)
+	}
+	if loc.Pattern != "docs" || len(*requests) != 1 || (*requests)[0] != "HEAD /readingroom/docs/CIA-RDP96-00788R001200420001-3.pdf" {
+		t.Errorf("expected a single probe of the cached pattern, got %v for %+v", *requests, loc)
+	}
+}
+
+func TestPDFResolver_Moved(t *testing.T) {
+	server, _ := pdfRoom(map[string]bool{
+		"/readingroom/docs/memo.pdf":           true,
+		"/readingroom/docs/annex/REPORT-2.pdf": true,
+	}, map[string]string{
+		"/readingroom/document/report-2": documentHTML("/readingroom/docs/annex/REPORT-2.pdf"),
+	}, http.StatusNotFound)
+	defer server.Close()
+
+	r := NewPDFResolver()
+	loc, err := r.Resolve("", server.URL+"/moved/memo.pdf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loc.URL != server.URL+"/readingroom/docs/memo.pdf" || !loc.Moved {
+		t.Errorf("expected the redirect to be followed, got %+v", loc)
+	}
+
+	loc, err = r.Resolve("", server.URL+"/readingroom/docs/report-2.pdf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loc.URL != server.URL+"/readingroom/docs/annex/REPORT-2.pdf" || loc.Pattern != "attachment" || !loc.Moved {
+		t.Errorf("expected the attachment of the document page, got %+v", loc)
+	}
+}
+
+func TestPDFResolver_Errors(t *testing.T) {
+	server, _ := pdfRoom(nil, map[string]string{
+		"/readingroom/document/report-3": documentHTML("/readingroom/docs/other.pdf"),
+	}, http.StatusNotFound)
+	r := NewPDFResolver()
+	for _, link := range []string{"/readingroom/docs/report-1.pdf", "/readingroom/docs/report-3.pdf"} {
+		if _, err := r.Resolve("", server.URL+link); !errors.Is(err, ErrNoPDF) {
+			t.Errorf("expected %v for %s, got %v", ErrNoPDF, link, err)
+		}
+	}
+	server.Close()
+
+	for _, status := range []int{http.StatusForbidden, http.StatusTooManyRequests} {
+		server, _ = pdfRoom(nil, nil, status)
+		if _, err := r.Resolve("", server.URL+"/readingroom/docs/report-1.pdf"); !errors.Is(err, ErrAccessDenied) {
+			t.Errorf("expected %v for status %d, got %v", ErrAccessDenied, status, err)
+		}
+		server.Close()
+	}
+
+	// throttle pages served as 200 are told apart by their content
+	server, _ = pdfRoom(nil, map[string]string{
+		"/readingroom/docs/report-1.pdf": "<html><head><title>Access Denied</title></head></html>",
+	}, http.StatusNotFound)
+	if _, err := r.Resolve("", server.URL+"/readingroom/docs/report-1.pdf"); !errors.Is(err, ErrAccessDenied) {
+		t.Errorf("expected %v for a throttle page, got %v", ErrAccessDenied, err)
+	}
+	server.Close()
+
+	server, _ = pdfRoom(nil, nil, http.StatusInternalServerError)
+	defer server.Close()
+	if _, err := r.Resolve("", server.URL+"/readingroom/docs/report-1.pdf"); errors.Is(err, ErrNoPDF) || !errors.Is(err, ErrBadStatusCode) {
+		t.Errorf("expected server errors not to look like a missing PDF, got %v", err)
+	}
+}
+
+func TestPDFResolver_AttachmentNotCached(t *testing.T) {
+	server, requests := pdfRoom(map[string]bool{
+		"/readingroom/docs/annex/REPORT-2.pdf": true,
+		"/readingroom/docs/REPORT-3.pdf":       true,
+	}, map[string]string{
+		"/readingroom/document/report-2": documentHTML("/readingroom/docs/annex/REPORT-2.pdf"),
+	}, http.StatusNotFound)
+	defer server.Close()
+
+	r := NewPDFResolver()
+	loc, err := r.Resolve("STARGATE", server.URL+"/readingroom/docs/report-2.pdf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loc.Pattern != "attachment" {
+		t.Fatalf("expected the attachment of the document page, got %+v", loc)
+	}
+
+	*requests = nil
+	if loc, err = r.Resolve("STARGATE", server.URL+"/readingroom/docs/report-3.pdf"); err != nil {
+		t.Fatal(err)
+	}
+	if loc.Pattern != "upper-case" {
+		t.Errorf("expected the upper-case pattern, got %+v", loc)
+	}
+	for _, req := range *requests {
+		if strings.Contains(req, "/readingroom/document/") {
+			t.Errorf("expected the document page not to be fetched, got %v", *requests)
+		}
+	}
+}
+
+// sizeRecorder remembers the size of every recorded body.
+type sizeRecorder struct{ sizes []int }
+
+func (s *sizeRecorder) Record(_ *http.Request, _ *http.Response, body []byte) error {
+	s.sizes = append(s.sizes, len(body))
+	return nil
+}
+
+func TestPDFResolver_SniffsFirstBytes(t *testing.T) {
+	pdf := append([]byte("%PDF-1.4\n"), bytes.Repeat([]byte{' '}, 4*pdfSniffSize)...)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// a server that doesn't say what it serves
+		w.Header().Set("Content-Type", "text/plain")
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(pdf))
+	}))
+	defer server.Close()
+
+	rec := &sizeRecorder{}
+	Client.WithRecorder(rec)
+	defer Client.WithoutRecorder(rec)
+
+	loc, err := NewPDFResolver().Resolve("", server.URL+"/readingroom/docs/report-1.pdf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loc.Pattern != "as-linked" {
+		t.Errorf("expected the sniffed PDF, got %+v", loc)
+	}
+	for _, size := range rec.sizes {
+		if size > pdfSniffSize {
+			t.Errorf("expected only the first %d bytes to be fetched, got %d", pdfSniffSize, size)
+		}
+	}
+}
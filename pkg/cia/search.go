@@ -0,0 +1,149 @@
+package cia
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"regexp"
+	"strconv"
+
+	"ciascrape/pkg/mu"
+)
+
+const searchResultRegexPattern = `(?s)<h3 class="title">\s*<a href="(?:https?://www\.cia\.gov)?/readingroom/document/([^"]+)"`
+
+// maxSearchRetries is how often a search result page is fetched again while the reading room answers with Access Denied.
+const maxSearchRetries = 10
+
+var searchResultRegex = regexp.MustCompile(searchResultRegexPattern)
+
+// Source is a paginated listing of reading room documents that can be drained into the upload pipeline.
+type Source interface {
+	GetPages() error
+	Drain(ctx context.Context) (chan string, chan bool)
+	MarkEmitted(link string)
+	SaveCheckpoint() error
+}
+
+var (
+	_ Source = (*Collection)(nil)
+	_ Source = (*Search)(nil)
+)
+
+func SearchURL(query string, page int) string {
+	u := EndpointBase + "readingroom/search/site/" + url.PathEscape(query)
+	if page > 0 {
+		u += "?page=" + strconv.Itoa(page)
+	}
+	return u
+}
+
+// SearchName is the name a Search registers its pages under, e.g. for checkpoints.
+func SearchName(query string) string {
+	return "search:" + query
+}
+
+// Search collects the documents returned by a reading room site search.
+// Like Collection, it can only be drained once.
+type Search struct {
+	*Collection
+	Query string
+}
+
+func NewSearch(query string) *Search {
+	return &Search{
+		Collection: NewCollection(SearchName(query)),
+		Query:      query,
+	}
+}
+
+func (s *Search) WithMaxPages(maxPages int) *Search {
+	s.Collection.WithMaxPages(maxPages)
+	return s
+}
+
+func (s *Search) WithStartPage(startPage int) *Search {
+	s.Collection.WithStartPage(startPage)
+	return s
+}
+
+func (s *Search) WithCheckpoint(cp *Checkpoint) *Search {
+	s.Collection.WithCheckpoint(cp)
+	return s
+}
+
+// GetPages walks the search result pages in order until one comes back without results.
+// Search result pages do not 404 past the last page, so unlike Collection.GetPages they are
+// fetched one at a time.
+func (s *Search) GetPages() error {
+	defer s.done.Store(true)
+
+	if s.maxDocuments < 20 {
+		s.maxDocuments = 20
+	}
+
+	for i := s.startPage; i <= s.maxDocuments/20; i++ {
+		if links, ok := s.checkpoint.parsed(i); ok {
+			s.resumePage(i, links)
+			continue
+		}
+
+		links, err := s.getResults(i)
+		if errors.Is(err, ErrNoDocuments) || errors.Is(err, ErrPageNotFound) {
+			if i == s.startPage {
+				return ErrNoDocuments
+			}
+			break
+		}
+		if err != nil {
+			_ = s.checkpoint.Save()
+			return err
+		}
+
+		s.checkpoint.markParsed(i, links)
+
+		channel := make(chan string, len(links))
+		for _, link := range links {
+			channel <- link
+		}
+		close(channel)
+
+		s.mu.Lock()
+		s.Pages[i] = channel
+		s.mu.Unlock()
+
+		log.Printf("search '%s' page %d has %d documents", s.Query, i, len(links))
+	}
+
+	return s.checkpoint.Save()
+}
+
+// getResults fetches search result page i, retrying while the reading room answers with Access Denied.
+// Pacing between attempts is left to the Client rate limiter.
+func (s *Search) getResults(i int) ([]string, error) {
+	for retries := 0; ; retries++ {
+		log.Printf("getting search '%s' page %d", s.Query, i)
+
+		mu.GetMutex("net").RLock()
+		res, err := Client.Get(SearchURL(s.Query, i))
+		mu.GetMutex("net").RUnlock()
+
+		if err != nil {
+			return nil, err
+		}
+
+		links, err := ParsePage(res)
+		if !errors.Is(err, ErrAccessDenied) {
+			return links, err
+		}
+		if err := Client.Throttled(context.Background(), res); err != nil {
+			log.Printf("[err] failed to rotate address: %v", err)
+		}
+		if retries >= maxSearchRetries {
+			return nil, fmt.Errorf("%w: gave up on search '%s' page %d after %d attempts", err, s.Query, i, retries+1)
+		}
+		log.Printf("[err] access denied on search '%s' page %d (%d), retrying...", s.Query, i, retries+1)
+	}
+}
@@ -0,0 +1,114 @@
+package cia
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+func testSearchServer(pages int) *httptest.Server {
+	return httptest.NewServer(testSearchHandler(pages))
+}
+
+func testSearchHandler(pages int) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/readingroom/search/site/remote viewing" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		page := 0
+		if p := r.URL.Query().Get("page"); p != "" {
+			_, _ = fmt.Sscanf(p, "%d", &page)
+		}
+		if page >= pages {
+			_, _ = w.Write([]byte(`<h2>Your search yielded no results</h2>`))
+			return
+		}
+		_, _ = w.Write([]byte(`<ol class="search-results apachesolr_search-results">`))
+		for i := 0; i < 3; i++ {
+			_, _ = fmt.Fprintf(w, "<li class=\"search-result\">\n<h3 class=\"title\">\n<a href=\"https://www.cia.gov/readingroom/document/doc-%d-%d\">DOC</a>\n</h3></li>", page, i)
+		}
+		_, _ = w.Write([]byte(`</ol>`))
+	}
+}
+
+func TestSearchURL_ReturnsCorrectURL(t *testing.T) {
+	expected := EndpointBase + "readingroom/search/site/remote%20viewing?page=2"
+	if result := SearchURL("remote viewing", 2); result != expected {
+		t.Errorf("expected %s, got %s", expected, result)
+	}
+	expected = EndpointBase + "readingroom/search/site/mkultra"
+	if result := SearchURL("mkultra", 0); result != expected {
+		t.Errorf("expected %s, got %s", expected, result)
+	}
+}
+
+func TestSearch_GetPagesAndDrain(t *testing.T) {
+	server := testSearchServer(2)
+	defer server.Close()
+
+	EndpointBase = server.URL + "/"
+
+	search := NewSearch("remote viewing")
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- search.GetPages()
+	}()
+
+	documents, _ := search.Drain(context.Background())
+
+	var links []string
+	for link := range documents {
+		links = append(links, link)
+	}
+
+	if err := <-errCh; err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(links) != 6 {
+		t.Errorf("expected 6 documents, got %d: %v", len(links), links)
+	}
+}
+
+func TestSearch_NoResults(t *testing.T) {
+	server := testSearchServer(0)
+	defer server.Close()
+
+	EndpointBase = server.URL + "/"
+
+	if err := NewSearch("remote viewing").GetPages(); !errors.Is(err, ErrNoDocuments) {
+		t.Errorf("expected error %v, got %v", ErrNoDocuments, err)
+	}
+}
+
+func TestSearch_RetriesAccessDenied(t *testing.T) {
+	results := testSearchHandler(2)
+
+	var denied atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("page") == "1" && denied.Add(1) <= 2 {
+			_, _ = w.Write([]byte("<HTML><HEAD>\n<TITLE>Access Denied</TITLE>\n</HEAD><BODY>\n<H1>Access Denied</H1>\n</BODY></HTML>"))
+			return
+		}
+		results(w, r)
+	}))
+	defer server.Close()
+
+	EndpointBase = server.URL + "/"
+
+	search := NewSearch("remote viewing")
+	if err := search.GetPages(); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(search.Pages) != 2 {
+		t.Errorf("expected the throttled page to be retried and 2 pages to be found, got %d", len(search.Pages))
+	}
+	if denied.Load() < 3 {
+		t.Errorf("expected page 1 to be fetched 3 times, got %d", denied.Load())
+	}
+}
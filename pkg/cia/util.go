@@ -1,6 +1,19 @@
 package cia
 
-import "strconv"
+import (
+	"html"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	scriptRegex     = regexp.MustCompile(`(?is)<(script|style|noscript)[^>]*>.*?</(script|style|noscript)>`)
+	blockRegex      = regexp.MustCompile(`(?i)<(br|/p|/div|/h[1-6]|/li|/tr|/table|/blockquote)[^>]*>`)
+	tagRegex        = regexp.MustCompile(`(?s)<[^>]*>`)
+	spaceRegex      = regexp.MustCompile(`[ \t\f\v\p{Zs}]+`)
+	blankLinesRegex = regexp.MustCompile(`\n{3,}`)
+)
 
 func EndpointURL(collection string) string {
 	return EndpointCollection() + collection
@@ -15,3 +28,19 @@ func PageURL(collection string, page int) string {
 	}
 	return EndpointCollection() + collection + "?page=" + strconv.Itoa(page)
 }
+
+// htmlToText strips markup from an HTML fragment, keeping block-level breaks as newlines.
+func htmlToText(s string) string {
+	s = scriptRegex.ReplaceAllString(s, "")
+	s = blockRegex.ReplaceAllString(s, "\n")
+	s = tagRegex.ReplaceAllString(s, "")
+	s = html.UnescapeString(s)
+	s = spaceRegex.ReplaceAllString(s, " ")
+	lines := strings.Split(s, "\n")
+	for i := range lines {
+		lines[i] = strings.TrimSpace(lines[i])
+	}
+	s = strings.Join(lines, "\n")
+	s = blankLinesRegex.ReplaceAllString(s, "\n\n")
+	return strings.TrimSpace(s)
+}
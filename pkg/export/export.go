@@ -0,0 +1,222 @@
+// Package export writes the scraped documents to files instead of a RAG store, as a corpus other tools can use.
+package export
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"ciascrape/pkg/cia"
+	"ciascrape/pkg/rag"
+)
+
+// Metadata is the CREST metadata of an exported document.
+type Metadata struct {
+	DocumentType           string            `json:"document_type,omitempty"`
+	Collection             string            `json:"collection,omitempty"`
+	DocumentNumber         string            `json:"document_number,omitempty"`
+	ReleaseDecision        string            `json:"release_decision,omitempty"`
+	OriginalClassification string            `json:"original_classification,omitempty"`
+	PageCount              int               `json:"page_count,omitempty"`
+	CreationDate           string            `json:"creation_date,omitempty"`
+	ReleaseDate            string            `json:"release_date,omitempty"`
+	PublicationDate        string            `json:"publication_date,omitempty"`
+	SequenceNumber         string            `json:"sequence_number,omitempty"`
+	CaseNumber             string            `json:"case_number,omitempty"`
+	ContentType            string            `json:"content_type,omitempty"`
+	PDFs                   []string          `json:"pdfs,omitempty"`
+	Fields                 map[string]string `json:"fields,omitempty"`
+}
+
+func metadataOf(doc *cia.Document) Metadata {
+	return Metadata{
+		DocumentType:           doc.DocumentType,
+		Collection:             doc.Collection,
+		DocumentNumber:         doc.DocumentNumber,
+		ReleaseDecision:        doc.ReleaseDecision,
+		OriginalClassification: doc.OriginalClassification,
+		PageCount:              doc.PageCount,
+		CreationDate:           doc.CreationDate,
+		ReleaseDate:            doc.ReleaseDate,
+		PublicationDate:        doc.PublicationDate,
+		SequenceNumber:         doc.SequenceNumber,
+		CaseNumber:             doc.CaseNumber,
+		ContentType:            doc.ContentType,
+		PDFs:                   doc.PDFs(),
+		Fields:                 doc.Fields,
+	}
+}
+
+// Record is an exported document: a reading room page with the text of its PDFs.
+type Record struct {
+	URL       string    `json:"url"`
+	Title     string    `json:"title"`
+	Text      string    `json:"text"`
+	PDFText   string    `json:"pdf_text"`
+	Metadata  Metadata  `json:"metadata"`
+	Hash      string    `json:"hash"`
+	FetchedAt time.Time `json:"fetched_at"`
+	// body is the body of the page without the metadata Text repeats
+	body string
+}
+
+// hash returns the SHA-256 of the text and PDF text of the record.
+func (r *Record) hash() string {
+	sum := sha256.Sum256([]byte(r.Text + "\x00" + r.PDFText))
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// collector assembles records from what the scraping pipeline uploads. A page is uploaded first, then
+// its PDFs, and it is attached last, which is when its record is written.
+type collector struct {
+	extract rag.Extractor
+	write   func(r *Record) error
+	pending map[string]*Record
+	// owners maps the URL of a PDF to the page it is attached to
+	owners map[string]string
+	seen   map[string]bool
+	mu     sync.Mutex
+}
+
+func newCollector(write func(r *Record) error) collector {
+	return collector{
+		extract: rag.PlainText,
+		write:   write,
+		pending: make(map[string]*Record),
+		owners:  make(map[string]string),
+		seen:    make(map[string]bool),
+	}
+}
+
+func (c *collector) Seen(url string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.seen[url]
+}
+
+func (c *collector) markSeen(url string) {
+	c.mu.Lock()
+	c.seen[url] = true
+	c.mu.Unlock()
+}
+
+func (c *collector) UploadText(doc *cia.Document) (*rag.Document, error) {
+	if rag.IsAccessDenied(doc) {
+		return nil, rag.ErrAccessDenied
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.seen[doc.URL] {
+		return nil, rag.ErrDuplicate
+	}
+	c.pending[doc.URL] = &Record{
+		URL:       doc.URL,
+		Title:     doc.Title,
+		Text:      doc.Text(),
+		Metadata:  metadataOf(doc),
+		FetchedAt: time.Now().UTC(),
+		body:      doc.Body,
+	}
+	for _, pdf := range doc.PDFs() {
+		c.owners[pdf] = doc.URL
+	}
+	return &rag.Document{ID: doc.URL, Location: doc.URL, URL: doc.URL, Title: doc.Title}, nil
+}
+
+// UploadFile adds the text of the file to the record of the page it is attached to. Files we can't read
+// are only listed in the metadata of the page.
+func (c *collector) UploadFile(url, name string, data []byte) (*rag.Document, error) {
+	if c.Seen(url) {
+		return nil, rag.ErrDuplicate
+	}
+	text, err := c.extract(name, data)
+	if errors.Is(err, rag.ErrUnsupported) {
+		log.Printf("[export] no text for '%s': %v", url, err)
+	} else if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if owner, ok := c.pending[c.owners[url]]; ok {
+		if text = strings.TrimSpace(text); text != "" {
+			if owner.PDFText != "" {
+				owner.PDFText += "\n\n"
+			}
+			owner.PDFText += text
+		}
+	} else {
+		c.pending[url] = &Record{URL: url, Title: name, PDFText: text, FetchedAt: time.Now().UTC()}
+	}
+	return &rag.Document{ID: url, Location: url, URL: url, Title: name}, nil
+}
+
+// UploadLink is not supported, only what we fetched ourselves is exported.
+func (c *collector) UploadLink(string) (*rag.Document, error) {
+	return nil, rag.ErrUnsupported
+}
+
+// Attach writes the records of docs. PDFs merged into the record of their page are only marked seen.
+func (c *collector) Attach(docs ...*rag.Document) error {
+	for _, doc := range docs {
+		if doc == nil {
+			continue
+		}
+		c.mu.Lock()
+		r, ok := c.pending[doc.URL]
+		_, merged := c.pending[c.owners[doc.URL]]
+		if !ok && merged {
+			c.seen[doc.URL] = true
+		}
+		c.mu.Unlock()
+		if !ok {
+			continue
+		}
+
+		r.Hash = r.hash()
+		if err := c.write(r); err != nil {
+			return err
+		}
+
+		c.mu.Lock()
+		delete(c.pending, doc.URL)
+		for _, pdf := range r.Metadata.PDFs {
+			if c.owners[pdf] == doc.URL {
+				delete(c.owners, pdf)
+			}
+		}
+		c.seen[doc.URL] = true
+		c.mu.Unlock()
+	}
+	return nil
+}
+
+// Delete drops documents that were not written yet. Written ones can't be taken back.
+func (c *collector) Delete(docs ...*rag.Document) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, doc := range docs {
+		if doc == nil {
+			continue
+		}
+		if c.seen[doc.URL] {
+			return fmt.Errorf("%w: '%s' was already exported", rag.ErrUnsupported, doc.URL)
+		}
+		delete(c.pending, doc.URL)
+	}
+	return nil
+}
+
+// checkPending logs the documents that were uploaded but never attached, and so never written.
+func (c *collector) checkPending() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.pending) > 0 {
+		log.Printf("[err][export] %d documents were uploaded but never attached", len(c.pending))
+	}
+}
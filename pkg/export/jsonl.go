@@ -0,0 +1,262 @@
+package export
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"ciascrape/pkg/rag"
+)
+
+const (
+	DefaultJSONLMaxSize = 100 << 20
+	DefaultJSONLPrefix  = "cia_scrape"
+)
+
+// JSONL writes a record per document to newline-delimited JSON files in a directory, optionally
+// gzip-compressed, starting a new file once the current one has grown past the configured size.
+type JSONL struct {
+	collector
+	dir     string
+	prefix  string
+	maxSize int64
+	gzip    bool
+	file    *os.File
+	gz      *gzip.Writer
+	w       io.Writer
+	size    int64
+	serial  int
+	files   []string
+	fileMu  sync.Mutex
+}
+
+var _ rag.Backend = (*JSONL)(nil)
+
+// NewJSONL prepares a sink for dir. The first file is only created once a record is written.
+func NewJSONL(dir string) *JSONL {
+	j := &JSONL{
+		dir:     dir,
+		prefix:  DefaultJSONLPrefix,
+		maxSize: DefaultJSONLMaxSize,
+	}
+	j.collector = newCollector(j.write)
+	return j
+}
+
+// WithMaxSize sets the size in bytes, before compression, after which a new file is started.
+func (j *JSONL) WithMaxSize(size int64) *JSONL {
+	if size > 0 {
+		j.maxSize = size
+	}
+	return j
+}
+
+// WithPrefix sets the prefix of the file names.
+func (j *JSONL) WithPrefix(prefix string) *JSONL {
+	if prefix != "" {
+		j.prefix = prefix
+	}
+	return j
+}
+
+// WithGzip compresses the files with gzip.
+func (j *JSONL) WithGzip(compress bool) *JSONL {
+	j.gzip = compress
+	return j
+}
+
+// WithExtractor sets how the text of PDFs is read.
+func (j *JSONL) WithExtractor(extract rag.Extractor) *JSONL {
+	if extract != nil {
+		j.extract = extract
+	}
+	return j
+}
+
+func (j *JSONL) Name() string {
+	return "jsonl"
+}
+
+// Files returns the paths of the files written so far.
+func (j *JSONL) Files() []string {
+	j.fileMu.Lock()
+	defer j.fileMu.Unlock()
+	return append([]string(nil), j.files...)
+}
+
+func (j *JSONL) pattern() string {
+	return filepath.Join(j.dir, j.prefix+"-*.jsonl*")
+}
+
+// Validate creates the directory and reads the URLs of the documents in files written by earlier runs, for Seen.
+func (j *JSONL) Validate() error {
+	if err := os.MkdirAll(j.dir, 0755); err != nil {
+		return fmt.Errorf("failed to create export directory: %w", err)
+	}
+	paths, err := filepath.Glob(j.pattern())
+	if err != nil {
+		return err
+	}
+	count := 0
+	for _, path := range paths {
+		n, err := j.readSeen(path)
+		if err != nil {
+			// most likely a file cut short by a crash, what was read still counts
+			log.Printf("[err][export] failed to read '%s': %v", path, err)
+		}
+		count += n
+	}
+	log.Printf("total existing documents in %d export files observed for dedupe purposes: %d", len(paths), count)
+	return nil
+}
+
+func (j *JSONL) readSeen(path string) (int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+	var r io.Reader = f
+	if strings.HasSuffix(path, ".gz") {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return 0, err
+		}
+		defer func() {
+			_ = gz.Close()
+		}()
+		r = gz
+	}
+
+	count := 0
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+	for scanner.Scan() {
+		record := struct {
+			URL      string `json:"url"`
+			Metadata struct {
+				PDFs []string `json:"pdfs"`
+			} `json:"metadata"`
+		}{}
+		if err = json.Unmarshal(scanner.Bytes(), &record); err != nil || record.URL == "" {
+			continue
+		}
+		j.markSeen(record.URL)
+		for _, pdf := range record.Metadata.PDFs {
+			j.markSeen(pdf)
+		}
+		count++
+	}
+	return count, scanner.Err()
+}
+
+func (j *JSONL) write(r *Record) error {
+	dat, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+
+	j.fileMu.Lock()
+	defer j.fileMu.Unlock()
+
+	if j.w == nil || j.size >= j.maxSize {
+		if err = j.rotate(); err != nil {
+			return err
+		}
+	}
+	n, err := j.w.Write(append(dat, '\n'))
+	j.size += int64(n)
+	if err != nil {
+		return fmt.Errorf("failed to write export record: %w", err)
+	}
+	return nil
+}
+
+// rotate closes the current file and starts a new one.
+func (j *JSONL) rotate() error {
+	if err := j.closeFile(); err != nil {
+		return err
+	}
+
+	ext := ".jsonl"
+	if j.gzip {
+		ext += ".gz"
+	}
+	var (
+		f   *os.File
+		err error
+	)
+	for {
+		j.serial++
+		name := fmt.Sprintf("%s-%s-%05d%s", j.prefix, time.Now().UTC().Format("20060102150405"), j.serial, ext)
+		f, err = os.OpenFile(filepath.Join(j.dir, name), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+		if !errors.Is(err, os.ErrExist) {
+			break
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("failed to create export file: %w", err)
+	}
+
+	j.file, j.w, j.size = f, f, 0
+	if j.gzip {
+		j.gz = gzip.NewWriter(f)
+		j.w = j.gz
+	}
+	j.files = append(j.files, f.Name())
+	return nil
+}
+
+func (j *JSONL) closeFile() error {
+	if j.file == nil {
+		return nil
+	}
+	f, gz := j.file, j.gz
+	j.file, j.gz, j.w = nil, nil, nil
+	if gz != nil {
+		if err := gz.Close(); err != nil {
+			_ = f.Close()
+			return err
+		}
+	}
+	if err := f.Sync(); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Flush pushes what was written to the current file out to disk.
+func (j *JSONL) Flush(context.Context) error {
+	j.fileMu.Lock()
+	defer j.fileMu.Unlock()
+	if j.gz != nil {
+		if err := j.gz.Flush(); err != nil {
+			return err
+		}
+	}
+	if j.file != nil {
+		return j.file.Sync()
+	}
+	return nil
+}
+
+func (j *JSONL) Close() error {
+	j.checkPending()
+
+	j.fileMu.Lock()
+	defer j.fileMu.Unlock()
+	return j.closeFile()
+}
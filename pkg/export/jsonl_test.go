@@ -0,0 +1,176 @@
+package export
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"ciascrape/pkg/cia"
+	"ciascrape/pkg/rag"
+)
+
+func readRecords(t *testing.T, paths []string) []Record {
+	t.Helper()
+	var records []Record
+	for _, path := range paths {
+		f, err := os.Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var r io.Reader = f
+		if strings.HasSuffix(path, ".gz") {
+			if r, err = gzip.NewReader(f); err != nil {
+				t.Fatal(err)
+			}
+		}
+		scanner := bufio.NewScanner(r)
+		for scanner.Scan() {
+			record := Record{}
+			if err = json.Unmarshal(scanner.Bytes(), &record); err != nil {
+				t.Fatalf("bad line in '%s': %v", path, err)
+			}
+			records = append(records, record)
+		}
+		_ = f.Close()
+	}
+	return records
+}
+
+func testDocument(n string) *cia.Document {
+	return &cia.Document{
+		URL:            "https://www.cia.gov/readingroom/document/doc-" + n,
+		Title:          "(TAB " + n + ") TASK FORCE",
+		DocumentNumber: "CIA-RDP96-00788R00120041000" + n,
+		ReleaseDate:    "December 4, 1998",
+		Body:           "TASK FORCE " + n,
+		Attachments:    []string{"https://www.cia.gov/readingroom/docs/doc-" + n + ".pdf"},
+		Fields:         map[string]string{"Document Number (FOIA) /ESDN (CREST)": "CIA-RDP96-00788R00120041000" + n},
+	}
+}
+
+// upload feeds doc and its PDF through j like the scraping pipeline does in local fetch mode.
+func upload(t *testing.T, j rag.Backend, doc *cia.Document, pdf string) {
+	t.Helper()
+	page, err := j.UploadText(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pdfDoc, err := j.UploadFile(doc.PDFs()[0], "doc.pdf", []byte(pdf))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = j.Attach(pdfDoc); err != nil {
+		t.Fatal(err)
+	}
+	if err = j.Attach(page); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestJSONL_Records(t *testing.T) {
+	dir := t.TempDir()
+	var backend rag.Backend = NewJSONL(dir)
+	j := backend.(*JSONL)
+	if err := backend.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	doc := testDocument("1")
+	upload(t, j, doc, "remote viewing of Soviet facilities")
+	if _, err := j.UploadText(doc); !errors.Is(err, rag.ErrDuplicate) {
+		t.Errorf("expected %v, got %v", rag.ErrDuplicate, err)
+	}
+	if !j.Seen(doc.PDFs()[0]) {
+		t.Error("expected the PDF to be seen")
+	}
+
+	// PDFs we can't read are still exported with their page
+	doc2 := testDocument("2")
+	upload(t, j, doc2, "%PDF-1.4")
+
+	if _, err := j.UploadLink(doc.URL); !errors.Is(err, rag.ErrUnsupported) {
+		t.Errorf("expected %v, got %v", rag.ErrUnsupported, err)
+	}
+	denied := testDocument("3")
+	denied.Title = "Access Denied"
+	if _, err := j.UploadText(denied); !errors.Is(err, rag.ErrAccessDenied) {
+		t.Errorf("expected %v, got %v", rag.ErrAccessDenied, err)
+	}
+	if err := j.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	records := readRecords(t, j.Files())
+	if len(j.Files()) != 1 || len(records) != 2 {
+		t.Fatalf("expected 2 records in 1 file, got %d in %q", len(records), j.Files())
+	}
+	r := records[0]
+	if r.URL != doc.URL || r.Title != doc.Title || !strings.Contains(r.Text, "TASK FORCE 1") ||
+		r.PDFText != "remote viewing of Soviet facilities" || r.Metadata.DocumentNumber != doc.DocumentNumber ||
+		r.Metadata.ReleaseDate != doc.ReleaseDate || len(r.Metadata.PDFs) != 1 || r.FetchedAt.IsZero() {
+		t.Errorf("unexpected record: %+v", r)
+	}
+	if !strings.HasPrefix(r.Hash, "sha256:") || r.Hash == records[1].Hash {
+		t.Errorf("unexpected hashes %q and %q", r.Hash, records[1].Hash)
+	}
+	if records[1].PDFText != "" {
+		t.Errorf("expected no PDF text, got %q", records[1].PDFText)
+	}
+
+	// a new run skips what is already exported
+	again := NewJSONL(dir)
+	if err := again.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if !again.Seen(doc.URL) || !again.Seen(doc2.PDFs()[0]) || again.Seen(denied.URL) {
+		t.Error("expected the exported documents and only those to be seen")
+	}
+}
+
+func TestJSONL_RollingGzip(t *testing.T) {
+	dir := t.TempDir()
+	j := NewJSONL(dir).WithPrefix("stargate").WithGzip(true).WithMaxSize(1).
+		WithExtractor(func(name string, data []byte) (string, error) {
+			return "extracted from " + name, nil
+		})
+	if err := j.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	for _, n := range []string{"1", "2", "3"} {
+		upload(t, j, testDocument(n), "%PDF-1.4")
+	}
+	if err := j.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := j.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	files := j.Files()
+	if len(files) != 3 {
+		t.Fatalf("expected a file per record, got %q", files)
+	}
+	for _, path := range files {
+		if !strings.HasSuffix(path, ".jsonl.gz") || !strings.Contains(path, "stargate-") {
+			t.Errorf("unexpected file name '%s'", path)
+		}
+	}
+	records := readRecords(t, files)
+	if len(records) != 3 || records[2].URL != testDocument("3").URL || records[2].PDFText != "extracted from doc.pdf" {
+		t.Errorf("unexpected records: %+v", records)
+	}
+
+	again := NewJSONL(dir).WithPrefix("stargate")
+	if err := again.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if !again.Seen(testDocument("2").URL) {
+		t.Error("expected documents in gzip files to be seen")
+	}
+}
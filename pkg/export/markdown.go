@@ -0,0 +1,285 @@
+package export
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"ciascrape/pkg/rag"
+)
+
+var (
+	// documentNumberRegex matches CREST document numbers, e.g. CIA-RDP96-00788R001200410003-2.
+	documentNumberRegex = regexp.MustCompile(`\bCIA-RDP\d{2}-?[A-Z0-9]*?[A-Z]\d{12}-\d\b`)
+
+	fileNameRegex   = regexp.MustCompile(`[^a-zA-Z0-9._-]+`)
+	blankLinesRegex = regexp.MustCompile(`\n{3,}`)
+)
+
+// Markdown writes a Markdown file per document to a directory, e.g. an Obsidian vault. Files are named by
+// document number and start with YAML front matter holding the CREST metadata. Document numbers cited
+// in the text are turned into wiki-links to the files of those documents.
+type Markdown struct {
+	collector
+	dir    string
+	files  []string
+	fileMu sync.Mutex
+}
+
+var _ rag.Backend = (*Markdown)(nil)
+
+func NewMarkdown(dir string) *Markdown {
+	m := &Markdown{dir: dir}
+	m.collector = newCollector(m.write)
+	return m
+}
+
+// WithExtractor sets how the text of PDFs is read.
+func (m *Markdown) WithExtractor(extract rag.Extractor) *Markdown {
+	if extract != nil {
+		m.extract = extract
+	}
+	return m
+}
+
+func (m *Markdown) Name() string {
+	return "markdown"
+}
+
+// Files returns the paths of the files written so far.
+func (m *Markdown) Files() []string {
+	m.fileMu.Lock()
+	defer m.fileMu.Unlock()
+	return append([]string(nil), m.files...)
+}
+
+// Validate creates the directory and reads the URLs from the front matter of files written by earlier runs, for Seen.
+func (m *Markdown) Validate() error {
+	if err := os.MkdirAll(m.dir, 0755); err != nil {
+		return fmt.Errorf("failed to create export directory: %w", err)
+	}
+	paths, err := filepath.Glob(filepath.Join(m.dir, "*.md"))
+	if err != nil {
+		return err
+	}
+	for _, path := range paths {
+		if err = m.readSeen(path); err != nil {
+			log.Printf("[err][export] failed to read '%s': %v", path, err)
+		}
+	}
+	log.Printf("total existing documents in markdown export observed for dedupe purposes: %d", len(paths))
+	return nil
+}
+
+func (m *Markdown) readSeen(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	scanner := bufio.NewScanner(f)
+	if !scanner.Scan() || scanner.Text() != "---" {
+		return scanner.Err()
+	}
+	for scanner.Scan() && scanner.Text() != "---" {
+		line := scanner.Text()
+		value, ok := strings.CutPrefix(line, "url: ")
+		if !ok {
+			value, ok = strings.CutPrefix(line, "pdf: ")
+		}
+		if !ok {
+			value, ok = strings.CutPrefix(line, "  - ")
+		}
+		if !ok {
+			continue
+		}
+		if s, err := strconv.Unquote(value); err == nil && strings.Contains(s, "://") {
+			m.markSeen(s)
+		}
+	}
+	return scanner.Err()
+}
+
+// fileName returns the name of the file of r, without extension: its document number if it has one.
+func fileName(r *Record) string {
+	name := r.Metadata.DocumentNumber
+	if name == "" {
+		name = strings.TrimSuffix(path.Base(r.URL), path.Ext(r.URL))
+	}
+	return strings.Trim(fileNameRegex.ReplaceAllString(name, "-"), "-.")
+}
+
+// yamlString quotes s as a YAML double-quoted scalar, which takes the same escapes as JSON.
+func yamlString(s string) string {
+	dat, _ := json.Marshal(s)
+	return string(dat)
+}
+
+// cleanText normalizes whitespace, drops control characters and escapes what Markdown would
+// read as block syntax at the start of a line.
+func cleanText(s string) string {
+	s = strings.ReplaceAll(strings.ReplaceAll(s, "\r\n", "\n"), "\r", "\n")
+	s = strings.Map(func(r rune) rune {
+		switch {
+		case r == '\n':
+			return r
+		case r == '\t' || unicode.IsSpace(r):
+			return ' '
+		case unicode.IsControl(r) || r == unicode.ReplacementChar:
+			return -1
+		}
+		return r
+	}, s)
+
+	lines := strings.Split(s, "\n")
+	for i, line := range lines {
+		line = strings.Join(strings.Fields(line), " ")
+		if strings.HasPrefix(line, "#") || strings.HasPrefix(line, ">") {
+			line = `\` + line
+		}
+		lines[i] = line
+	}
+	return strings.TrimSpace(blankLinesRegex.ReplaceAllString(strings.Join(lines, "\n"), "\n\n"))
+}
+
+// linkCitations turns the document numbers cited in text, other than self, into wiki-links and
+// returns them in order of appearance.
+func linkCitations(text, self string) (string, []string) {
+	seen := make(map[string]bool)
+	var cites []string
+	text = documentNumberRegex.ReplaceAllStringFunc(text, func(number string) string {
+		if number == self {
+			return number
+		}
+		if !seen[number] {
+			seen[number] = true
+			cites = append(cites, number)
+		}
+		return "[[" + number + "]]"
+	})
+	return text, cites
+}
+
+func (m *Markdown) render(r *Record) string {
+	body, cites := linkCitations(cleanText(r.body), r.Metadata.DocumentNumber)
+	pdfText, pdfCites := linkCitations(cleanText(r.PDFText), r.Metadata.DocumentNumber)
+	for _, c := range pdfCites {
+		if !strings.Contains(body, "[["+c+"]]") {
+			cites = append(cites, c)
+		}
+	}
+
+	sb := &strings.Builder{}
+	field := func(key, value string) {
+		if value != "" {
+			sb.WriteString(key + ": " + yamlString(value) + "\n")
+		}
+	}
+	list := func(key string, values []string) {
+		if len(values) == 0 {
+			return
+		}
+		sb.WriteString(key + ":\n")
+		for _, v := range values {
+			sb.WriteString("  - " + yamlString(v) + "\n")
+		}
+	}
+
+	md := r.Metadata
+	sb.WriteString("---\n")
+	field("title", r.Title)
+	field("url", r.URL)
+	if len(md.PDFs) > 0 {
+		field("pdf", md.PDFs[0])
+	}
+	if len(md.PDFs) > 1 {
+		list("pdfs", md.PDFs)
+	}
+	field("document_number", md.DocumentNumber)
+	field("document_type", md.DocumentType)
+	field("collection", md.Collection)
+	field("release_decision", md.ReleaseDecision)
+	field("original_classification", md.OriginalClassification)
+	if md.PageCount > 0 {
+		sb.WriteString("page_count: " + strconv.Itoa(md.PageCount) + "\n")
+	}
+	field("creation_date", md.CreationDate)
+	field("release_date", md.ReleaseDate)
+	field("publication_date", md.PublicationDate)
+	field("sequence_number", md.SequenceNumber)
+	field("case_number", md.CaseNumber)
+	field("content_type", md.ContentType)
+	list("cites", cites)
+	field("hash", r.Hash)
+	field("fetched_at", r.FetchedAt.Format(time.RFC3339))
+	sb.WriteString("---\n\n")
+
+	sb.WriteString("# " + strings.Join(strings.Fields(r.Title), " ") + "\n")
+	if body != "" {
+		sb.WriteString("\n" + body + "\n")
+	}
+	if pdfText != "" {
+		sb.WriteString("\n## PDF\n\n" + pdfText + "\n")
+	}
+	return sb.String()
+}
+
+func (m *Markdown) write(r *Record) error {
+	name := fileName(r)
+	if name == "" {
+		name = "document"
+	}
+	data := []byte(m.render(r))
+
+	m.fileMu.Lock()
+	defer m.fileMu.Unlock()
+
+	// documents are only written once, so an existing file is another document with the same number
+	var (
+		f   *os.File
+		err error
+	)
+	for i := 1; ; i++ {
+		file := name + ".md"
+		if i > 1 {
+			file = fmt.Sprintf("%s-%d.md", name, i)
+		}
+		f, err = os.OpenFile(filepath.Join(m.dir, file), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+		if !errors.Is(err, os.ErrExist) {
+			break
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("failed to create export file: %w", err)
+	}
+	if _, err = f.Write(data); err != nil {
+		_ = f.Close()
+		return fmt.Errorf("failed to write export file: %w", err)
+	}
+	m.files = append(m.files, f.Name())
+	return f.Close()
+}
+
+func (m *Markdown) Flush(context.Context) error {
+	return nil
+}
+
+func (m *Markdown) Close() error {
+	m.checkPending()
+	return nil
+}
@@ -0,0 +1,73 @@
+package export
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"ciascrape/pkg/rag"
+)
+
+func TestMarkdown_Files(t *testing.T) {
+	dir := t.TempDir()
+	var backend rag.Backend = NewMarkdown(dir).WithExtractor(func(name string, data []byte) (string, error) {
+		return string(data), nil
+	})
+	m := backend.(*Markdown)
+	if err := backend.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	doc := testDocument("1")
+	doc.OriginalClassification = "S"
+	doc.PageCount = 3
+	doc.Body = "# SECRET\r\nSee   CIA-RDP96-00788R001200410002 and\x00 CIA-RDP79T00975A029000010001-5.\n\n\n\nAlso CIA-RDP79T00975A029000010001-5."
+	upload(t, m, doc, "Attached to CIA-RDP80-00809A000600020049-1 and "+doc.DocumentNumber)
+	if err := m.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	files := m.Files()
+	if len(files) != 1 || filepath.Base(files[0]) != doc.DocumentNumber+".md" {
+		t.Fatalf("unexpected files: %q", files)
+	}
+	data, err := os.ReadFile(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	content := string(data)
+	for _, want := range []string{
+		"---\ntitle: \"(TAB 1) TASK FORCE\"\nurl: \"" + doc.URL + "\"\npdf: \"" + doc.PDFs()[0] + "\"\n",
+		"original_classification: \"S\"\npage_count: 3\n",
+		"release_date: \"December 4, 1998\"\n",
+		"cites:\n  - \"CIA-RDP79T00975A029000010001-5\"\n  - \"CIA-RDP80-00809A000600020049-1\"\n",
+		"hash: \"sha256:",
+		"---\n\n# (TAB 1) TASK FORCE\n\n\\# SECRET\nSee CIA-RDP96-00788R001200410002 and [[CIA-RDP79T00975A029000010001-5]].\n\nAlso [[CIA-RDP79T00975A029000010001-5]].\n",
+		"\n## PDF\n\nAttached to [[CIA-RDP80-00809A000600020049-1]] and " + doc.DocumentNumber + "\n",
+	} {
+		if !strings.Contains(content, want) {
+			t.Errorf("expected file to contain %q, got:\n%s", want, content)
+		}
+	}
+
+	// a document without a number is named after its URL, one with a taken number gets a suffix
+	doc2 := testDocument("2")
+	doc2.DocumentNumber = ""
+	doc3 := testDocument("3")
+	doc3.DocumentNumber = doc.DocumentNumber
+	upload(t, m, doc2, "")
+	upload(t, m, doc3, "")
+	files = m.Files()
+	if len(files) != 3 || filepath.Base(files[1]) != "doc-2.md" || filepath.Base(files[2]) != doc.DocumentNumber+"-2.md" {
+		t.Errorf("unexpected files: %q", files)
+	}
+
+	again := NewMarkdown(dir)
+	if err = again.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if !again.Seen(doc.URL) || !again.Seen(doc.PDFs()[0]) || !again.Seen(doc3.URL) || again.Seen(testDocument("4").URL) {
+		t.Error("expected the exported documents and only those to be seen")
+	}
+}
@@ -1,19 +1,147 @@
 package http
 
 import (
+	"bytes"
+	"context"
 	"fmt"
+	"io"
+	"log"
 	"math/rand"
 	"net/http"
+	"net/url"
 	"strings"
 	"sync/atomic"
 	"time"
 )
 
+// Recorder receives a copy of every exchange made by a Client, e.g. to archive it.
+type Recorder interface {
+	Record(req *http.Request, res *http.Response, body []byte) error
+}
+
+// Rotator changes the address the client's requests leave from, see package rotate.
+type Rotator interface {
+	Rotate(ctx context.Context) error
+}
+
 type Client struct {
 	*http.Client
+	limiter   *Limiter
+	rotation  Rotator
+	proxies   *ProxyPool
+	recorders []Recorder
 }
 
-var DefaultClient = &Client{http.DefaultClient}
+var DefaultClient = &Client{Client: http.DefaultClient}
+
+func NewClient() *Client {
+	return &Client{Client: &http.Client{}}
+}
+
+// WithLimiter paces every request of the client through l.
+func (c *Client) WithLimiter(l *Limiter) *Client {
+	c.limiter = l
+	return c
+}
+
+// WithTransport replaces how the client's requests are carried out, e.g. to replay them from an archive.
+func (c *Client) WithTransport(rt http.RoundTripper) *Client {
+	c.Client.Transport = rt
+	return c
+}
+
+func (c *Client) Limiter() *Limiter {
+	return c.limiter
+}
+
+// WithRotator sets how Throttled changes the address the client's requests leave from. It is usually a
+// rotate.Rotation, so that callers noticing the same throttling share a single rotation.
+func (c *Client) WithRotator(r Rotator) *Client {
+	c.rotation = r
+	return c
+}
+
+// transport returns a copy of the client's http.Transport to modify, closing the idle connections of the old one.
+func (c *Client) transport() *http.Transport {
+	if old, ok := c.Client.Transport.(*http.Transport); ok && old != nil {
+		old.CloseIdleConnections()
+		return old.Clone()
+	}
+	return http.DefaultTransport.(*http.Transport).Clone()
+}
+
+// WithProxy sends every request of the client through the proxy at u (http, https or socks5).
+func (c *Client) WithProxy(u *url.URL) *Client {
+	t := c.transport()
+	t.Proxy = http.ProxyURL(u)
+	c.Client.Transport = t
+	c.proxies = nil
+	return c
+}
+
+// WithProxyPool spreads the client's requests across the proxies of pool.
+func (c *Client) WithProxyPool(pool *ProxyPool) *Client {
+	t := c.transport()
+	t.Proxy = proxyFor
+	c.Client.Transport = t
+	c.proxies = pool
+	return c
+}
+
+func (c *Client) ProxyPool() *ProxyPool {
+	return c.proxies
+}
+
+// Throttled is called when the server has throttled the client, e.g. with an Access Denied page in res
+// (which may be nil if unknown). It slows the limiter down unless Do already did for the status of res,
+// puts the proxy res was fetched through on cool-down and, if a rotator is set, blocks until the
+// client's address has been rotated.
+// Callers must not hold the "net" lock.
+func (c *Client) Throttled(ctx context.Context, res *http.Response) error {
+	if !throttledStatus(res) {
+		c.limiter.Decrease()
+	}
+	if px := proxyOf(res); px != nil && c.proxies != nil {
+		c.proxies.throttled(px)
+	}
+	if c.rotation == nil {
+		return nil
+	}
+	return c.rotation.Rotate(ctx)
+}
+
+// WithRecorder hands every response of the client to r in addition to any recorders already set.
+func (c *Client) WithRecorder(r Recorder) *Client {
+	c.recorders = append(c.recorders, r)
+	return c
+}
+
+// WithoutRecorder stops handing responses to r.
+func (c *Client) WithoutRecorder(r Recorder) *Client {
+	for i := range c.recorders {
+		if c.recorders[i] == r {
+			c.recorders = append(c.recorders[:i], c.recorders[i+1:]...)
+			break
+		}
+	}
+	return c
+}
+
+// record buffers the body of res so the recorders and the caller can both read it.
+func (c *Client) record(req *http.Request, res *http.Response) error {
+	body, err := io.ReadAll(res.Body)
+	_ = res.Body.Close()
+	res.Body = io.NopCloser(bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	for _, r := range c.recorders {
+		if err := r.Record(req, res, body); err != nil {
+			log.Printf("[err][recorder] failed to record '%s': %v", req.URL, err)
+		}
+	}
+	return nil
+}
 
 var i = &atomic.Int64{}
 
@@ -56,5 +184,47 @@ func getUA() string {
 
 func (c *Client) Do(req *http.Request) (*http.Response, error) {
 	req.Header.Set("User-Agent", getUA())
-	return c.Client.Do(req)
+	if c.limiter != nil {
+		if err := c.limiter.Wait(req.Context()); err != nil {
+			return nil, err
+		}
+	}
+	var px *proxy
+	if c.proxies != nil {
+		var err error
+		if px, err = c.proxies.pick(req.Context()); err != nil {
+			return nil, err
+		}
+		req = req.WithContext(context.WithValue(req.Context(), proxyKey{}, px))
+	}
+	res, err := c.Client.Do(req)
+	if px != nil {
+		c.proxies.observe(px, res, err)
+	}
+	if err != nil {
+		return res, err
+	}
+	if c.limiter != nil {
+		c.limiter.Observe(res)
+	}
+	if len(c.recorders) > 0 {
+		err = c.record(req, res)
+	}
+	return res, err
+}
+
+func (c *Client) Get(url string) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	return c.Do(req)
+}
+
+func (c *Client) Head(url string) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodHead, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	return c.Do(req)
 }
@@ -0,0 +1,82 @@
+package http
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+type testRotator struct {
+	calls int
+}
+
+func (r *testRotator) Rotate(context.Context) error {
+	r.calls++
+	return nil
+}
+
+func TestClient_WithProxy(t *testing.T) {
+	var proxied string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied = r.URL.String()
+	}))
+	defer proxy.Close()
+
+	u, _ := url.Parse(proxy.URL)
+	res, err := NewClient().WithProxy(u).Get("http://reading-room.invalid/readingroom/document/doc-1")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	_ = res.Body.Close()
+
+	if proxied != "http://reading-room.invalid/readingroom/document/doc-1" {
+		t.Errorf("expected request to go through the proxy, got %q", proxied)
+	}
+}
+
+func TestClient_Throttled(t *testing.T) {
+	rotator := &testRotator{}
+	c := NewClient().WithLimiter(NewLimiter(10, 1)).WithRotator(rotator)
+
+	if err := c.Throttled(context.Background(), nil); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if rotator.calls != 1 {
+		t.Errorf("expected 1 rotation, got %d", rotator.calls)
+	}
+	if rate := c.Limiter().Rate(); rate >= 10 {
+		t.Errorf("expected rate to decrease, got %v", rate)
+	}
+
+	if err := NewClient().Throttled(context.Background(), nil); err != nil {
+		t.Errorf("expected no error without limiter or rotator, got %v", err)
+	}
+}
+
+func TestClient_ThrottledDecreasesOnce(t *testing.T) {
+	var status int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte("<HTML><HEAD>\n<TITLE>Access Denied</TITLE>\n</HEAD></HTML>"))
+	}))
+	defer server.Close()
+
+	for _, status = range []int{http.StatusForbidden, http.StatusOK} {
+		c := NewClient().WithLimiter(NewLimiter(10, 1))
+		res, err := c.Get(server.URL)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		_ = res.Body.Close()
+		if err := c.Throttled(context.Background(), res); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		// a 403 is slowed down for by Do, an Access Denied page behind a 200 by Throttled
+		if rate, expected := c.Limiter().Rate(), 10*decreaseFactor; rate != expected {
+			t.Errorf("status %d: expected rate %v after one denial, got %v", status, expected, rate)
+		}
+	}
+}
@@ -0,0 +1,220 @@
+package http
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultRPS    = 2.0
+	DefaultBurst  = 5
+	DefaultJitter = 250 * time.Millisecond
+
+	defaultRetryAfter = 5 * time.Second
+	maxRetryAfter     = 5 * time.Minute
+	decreaseFactor    = 0.5
+	increaseDivisor   = 20
+)
+
+// Limiter is a token bucket whose rate adapts to the server's responses (AIMD):
+// the rate is halved whenever the server throttles us and creeps back up by a
+// fraction of the configured rate after every healthy response.
+// A nil *Limiter never blocks.
+type Limiter struct {
+	rate        float64
+	maxRate     float64
+	minRate     float64
+	burst       float64
+	jitter      time.Duration
+	tokens      float64
+	last        time.Time
+	pausedUntil time.Time
+	mu          sync.Mutex
+}
+
+func NewLimiter(rps float64, burst int) *Limiter {
+	if rps <= 0 {
+		rps = DefaultRPS
+	}
+	if burst < 1 {
+		burst = 1
+	}
+	return &Limiter{
+		rate:    rps,
+		maxRate: rps,
+		minRate: rps / 100,
+		burst:   float64(burst),
+		tokens:  float64(burst),
+		last:    time.Now(),
+	}
+}
+
+// WithJitter adds a random delay of up to jitter to every Wait.
+func (l *Limiter) WithJitter(jitter time.Duration) *Limiter {
+	l.mu.Lock()
+	l.jitter = jitter
+	l.mu.Unlock()
+	return l
+}
+
+// WithMinRate sets the floor that Decrease will not push the rate below.
+func (l *Limiter) WithMinRate(rps float64) *Limiter {
+	l.mu.Lock()
+	if rps > 0 && rps <= l.maxRate {
+		l.minRate = rps
+	}
+	l.mu.Unlock()
+	return l
+}
+
+func (l *Limiter) refill(now time.Time) {
+	l.tokens = math.Min(l.burst, l.tokens+now.Sub(l.last).Seconds()*l.rate)
+	l.last = now
+}
+
+// Wait blocks until a request may be sent or ctx is done.
+func (l *Limiter) Wait(ctx context.Context) error {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	now := time.Now()
+	l.refill(now)
+	l.tokens--
+
+	var delay time.Duration
+	if l.tokens < 0 {
+		delay = time.Duration(-l.tokens / l.rate * float64(time.Second))
+	}
+	if until := l.pausedUntil.Sub(now); until > delay {
+		delay = until
+	}
+	if l.jitter > 0 {
+		delay += time.Duration(rand.Int63n(int64(l.jitter)))
+	}
+	l.mu.Unlock()
+
+	if delay <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		l.mu.Lock()
+		l.tokens++
+		l.mu.Unlock()
+		return ctx.Err()
+	}
+}
+
+// Pause holds back every request for d.
+func (l *Limiter) Pause(d time.Duration) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	if until := time.Now().Add(d); until.After(l.pausedUntil) {
+		l.pausedUntil = until
+	}
+	l.mu.Unlock()
+}
+
+// Decrease multiplicatively slows the limiter down, e.g. after an Access Denied page.
+func (l *Limiter) Decrease() {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	l.refill(time.Now())
+	l.rate = math.Max(l.minRate, l.rate*decreaseFactor)
+	l.mu.Unlock()
+}
+
+// Increase additively speeds the limiter back up towards its configured rate.
+func (l *Limiter) Increase() {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	l.refill(time.Now())
+	l.rate = math.Min(l.maxRate, l.rate+l.maxRate/increaseDivisor)
+	l.mu.Unlock()
+}
+
+// Rate returns the current requests per second.
+func (l *Limiter) Rate() float64 {
+	if l == nil {
+		return 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.rate
+}
+
+// Observe adjusts the limiter according to a response: 429 and 503 honor Retry-After and slow down,
+// 403 (the reading room's Access Denied page) slows down, anything else speeds back up.
+func (l *Limiter) Observe(res *http.Response) {
+	if l == nil || res == nil {
+		return
+	}
+	switch res.StatusCode {
+	case http.StatusTooManyRequests, http.StatusServiceUnavailable:
+		l.Pause(RetryAfter(res))
+		l.Decrease()
+	case http.StatusForbidden:
+		l.Decrease()
+	default:
+		if res.StatusCode < http.StatusInternalServerError {
+			l.Increase()
+		}
+	}
+}
+
+// throttledStatus reports whether Observe already slowed down for the status code of res.
+func throttledStatus(res *http.Response) bool {
+	if res == nil {
+		return false
+	}
+	switch res.StatusCode {
+	case http.StatusForbidden, http.StatusTooManyRequests, http.StatusServiceUnavailable:
+		return true
+	default:
+		return false
+	}
+}
+
+// RetryAfter parses the Retry-After header of res, which may be given in seconds or as an HTTP date.
+func RetryAfter(res *http.Response) time.Duration {
+	header := res.Header.Get("Retry-After")
+	if header == "" {
+		return defaultRetryAfter
+	}
+
+	var d time.Duration
+	if secs, err := strconv.Atoi(header); err == nil {
+		d = time.Duration(secs) * time.Second
+	} else if t, err := http.ParseTime(header); err == nil {
+		d = time.Until(t)
+	} else {
+		return defaultRetryAfter
+	}
+
+	switch {
+	case d < 0:
+		return 0
+	case d > maxRetryAfter:
+		return maxRetryAfter
+	default:
+		return d
+	}
+}
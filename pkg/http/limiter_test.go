@@ -0,0 +1,103 @@
+package http
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestLimiter_WaitHonorsRate(t *testing.T) {
+	l := NewLimiter(20, 1)
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		if err := l.Wait(context.Background()); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	}
+	// the first token is available immediately, the next two take 50ms each
+	if elapsed := time.Since(start); elapsed < 90*time.Millisecond {
+		t.Errorf("expected at least 90ms to pass, got %v", elapsed)
+	}
+}
+
+func TestLimiter_WaitCancelled(t *testing.T) {
+	l := NewLimiter(1, 1)
+	_ = l.Wait(context.Background())
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := l.Wait(ctx); err == nil {
+		t.Errorf("expected context error, got nil")
+	}
+}
+
+func TestLimiter_AIMD(t *testing.T) {
+	l := NewLimiter(10, 1)
+	l.Decrease()
+	l.Decrease()
+	if l.Rate() != 2.5 {
+		t.Errorf("expected rate to be halved twice to 2.5, got %v", l.Rate())
+	}
+	l.Increase()
+	if l.Rate() != 3 {
+		t.Errorf("expected rate to increase by 0.5, got %v", l.Rate())
+	}
+	for i := 0; i < 100; i++ {
+		l.Increase()
+	}
+	if l.Rate() != 10 {
+		t.Errorf("expected rate to be capped at 10, got %v", l.Rate())
+	}
+	for i := 0; i < 100; i++ {
+		l.Decrease()
+	}
+	if l.Rate() != 0.1 {
+		t.Errorf("expected rate to be floored at 0.1, got %v", l.Rate())
+	}
+}
+
+func TestLimiter_ObserveRetryAfter(t *testing.T) {
+	l := NewLimiter(1000, 10)
+	res := &http.Response{StatusCode: http.StatusTooManyRequests, Header: http.Header{}}
+	res.Header.Set("Retry-After", "1")
+	l.Observe(res)
+
+	if l.Rate() != 500 {
+		t.Errorf("expected rate to be halved, got %v", l.Rate())
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if err := l.Wait(ctx); err == nil {
+		t.Errorf("expected Wait to be held back by Retry-After")
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	res := &http.Response{Header: http.Header{}}
+	if d := RetryAfter(res); d != defaultRetryAfter {
+		t.Errorf("expected default retry after, got %v", d)
+	}
+	res.Header.Set("Retry-After", "120")
+	if d := RetryAfter(res); d != 2*time.Minute {
+		t.Errorf("expected 2m, got %v", d)
+	}
+	res.Header.Set("Retry-After", time.Now().Add(time.Hour).UTC().Format(http.TimeFormat))
+	if d := RetryAfter(res); d != maxRetryAfter {
+		t.Errorf("expected retry after to be capped at %v, got %v", maxRetryAfter, d)
+	}
+}
+
+func TestLimiter_Nil(t *testing.T) {
+	var l *Limiter
+	if err := l.Wait(context.Background()); err != nil {
+		t.Errorf("expected a nil limiter not to wait, got %v", err)
+	}
+	l.Pause(time.Second)
+	l.Decrease()
+	l.Increase()
+	l.Observe(&http.Response{StatusCode: http.StatusTooManyRequests})
+	if rate := l.Rate(); rate != 0 {
+		t.Errorf("expected a nil limiter to report rate 0, got %v", rate)
+	}
+}
@@ -0,0 +1,241 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+type ProxyMode int
+
+// ParseProxyMode parses "request" or "throttle".
+func ParseProxyMode(s string) (ProxyMode, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "", "request":
+		return RotatePerRequest, nil
+	case "throttle":
+		return RotateOnThrottle, nil
+	default:
+		return 0, fmt.Errorf("unknown proxy mode '%s' (expected request or throttle)", s)
+	}
+}
+
+const (
+	// RotatePerRequest sends each request through the next available proxy.
+	RotatePerRequest ProxyMode = iota
+	// RotateOnThrottle keeps using one proxy until it is throttled or fails.
+	RotateOnThrottle
+)
+
+const (
+	DefaultProxyCooldown = 10 * time.Minute
+	maxProxyFailures     = 3
+)
+
+var ErrNoProxies = errors.New("no proxies given")
+
+type proxyKey struct{}
+
+// ProxyStats is a snapshot of how a proxy of a ProxyPool has been doing.
+type ProxyStats struct {
+	URL       string
+	Requests  int64
+	Failures  int64
+	Throttled int64
+	Healthy   bool
+	// CoolingUntil is when the proxy will be used again after being throttled or failing.
+	CoolingUntil time.Time
+}
+
+func (s ProxyStats) String() string {
+	state := "healthy"
+	switch {
+	case !s.Healthy:
+		state = "unhealthy"
+	case time.Now().Before(s.CoolingUntil):
+		state = "cooling down until " + s.CoolingUntil.Format(time.TimeOnly)
+	}
+	return fmt.Sprintf("%s: %d requests, %d failures, %d throttled (%s)", s.URL, s.Requests, s.Failures, s.Throttled, state)
+}
+
+type proxy struct {
+	url           *url.URL
+	stats         ProxyStats
+	failuresInRow int
+}
+
+func (p *proxy) available(now time.Time) bool {
+	return !now.Before(p.stats.CoolingUntil)
+}
+
+// ProxyPool spreads requests across HTTP and SOCKS5 proxies. A proxy that gets throttled is put on
+// cool-down, and one that keeps failing is marked unhealthy and also cooled down before it is tried again.
+type ProxyPool struct {
+	proxies  []*proxy
+	mode     ProxyMode
+	cooldown time.Duration
+	current  int
+	mu       sync.Mutex
+}
+
+// ParseProxy parses a proxy given as an http://, https:// or socks5:// URL.
+func ParseProxy(raw string) (*url.URL, error) {
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid proxy '%s'", raw)
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5", "socks5h":
+	default:
+		return nil, fmt.Errorf("unsupported proxy scheme '%s'", u.Scheme)
+	}
+	return u, nil
+}
+
+// NewProxyPool parses proxies given as http://, https:// or socks5:// URLs.
+func NewProxyPool(proxies ...string) (*ProxyPool, error) {
+	p := &ProxyPool{cooldown: DefaultProxyCooldown}
+	for _, raw := range proxies {
+		raw = strings.TrimSpace(raw)
+		if raw == "" {
+			continue
+		}
+		u, err := ParseProxy(raw)
+		if err != nil {
+			return nil, err
+		}
+		p.proxies = append(p.proxies, &proxy{url: u, stats: ProxyStats{URL: u.Redacted(), Healthy: true}})
+	}
+	if len(p.proxies) == 0 {
+		return nil, ErrNoProxies
+	}
+	return p, nil
+}
+
+func (p *ProxyPool) WithMode(mode ProxyMode) *ProxyPool {
+	p.mode = mode
+	return p
+}
+
+// WithCooldown sets how long a throttled or unhealthy proxy is left alone.
+func (p *ProxyPool) WithCooldown(cooldown time.Duration) *ProxyPool {
+	if cooldown > 0 {
+		p.cooldown = cooldown
+	}
+	return p
+}
+
+// pick returns the proxy to use for the next request, waiting for one to finish its cool-down if need be.
+func (p *ProxyPool) pick(ctx context.Context) (*proxy, error) {
+	for {
+		p.mu.Lock()
+		now := time.Now()
+		var soonest *proxy
+		for i := range p.proxies {
+			n := (p.current + i) % len(p.proxies)
+			candidate := p.proxies[n]
+			if candidate.available(now) {
+				p.current = n
+				if p.mode == RotatePerRequest {
+					p.current = (n + 1) % len(p.proxies)
+				}
+				candidate.stats.Requests++
+				p.mu.Unlock()
+				return candidate, nil
+			}
+			if soonest == nil || candidate.stats.CoolingUntil.Before(soonest.stats.CoolingUntil) {
+				soonest = candidate
+			}
+		}
+		wait := soonest.stats.CoolingUntil.Sub(now)
+		p.mu.Unlock()
+
+		log.Printf("[proxy] all proxies are cooling down, waiting %v", wait.Round(time.Second))
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		}
+	}
+}
+
+func (p *ProxyPool) coolDown(px *proxy, reason string) {
+	px.stats.CoolingUntil = time.Now().Add(p.cooldown)
+	if p.proxies[p.current] == px {
+		p.current = (p.current + 1) % len(p.proxies)
+	}
+	log.Printf("[proxy] %s %s, cooling down for %v", px.stats.URL, reason, p.cooldown)
+}
+
+// throttled puts px on cool-down because the server throttled a request sent through it.
+func (p *ProxyPool) throttled(px *proxy) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !px.available(time.Now()) {
+		// already cooling down, e.g. a 403 Access Denied page reported by both Client.Do and the caller
+		return
+	}
+	px.stats.Throttled++
+	p.coolDown(px, "was throttled")
+}
+
+// observe updates the health of px from the outcome of a request sent through it.
+func (p *ProxyPool) observe(px *proxy, res *http.Response, err error) {
+	if err != nil {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		px.stats.Failures++
+		px.failuresInRow++
+		if px.failuresInRow >= maxProxyFailures {
+			px.stats.Healthy = false
+			p.coolDown(px, "keeps failing")
+		}
+		return
+	}
+
+	switch res.StatusCode {
+	case http.StatusForbidden, http.StatusTooManyRequests:
+		p.throttled(px)
+	default:
+		p.mu.Lock()
+		px.failuresInRow = 0
+		px.stats.Healthy = true
+		p.mu.Unlock()
+	}
+}
+
+// Stats returns a snapshot of every proxy in the pool.
+func (p *ProxyPool) Stats() []ProxyStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	stats := make([]ProxyStats, 0, len(p.proxies))
+	for _, px := range p.proxies {
+		stats = append(stats, px.stats)
+	}
+	return stats
+}
+
+// proxyFor is the http.Transport Proxy func of a client using the pool. The proxy is chosen by Client.Do.
+func proxyFor(req *http.Request) (*url.URL, error) {
+	if px, ok := req.Context().Value(proxyKey{}).(*proxy); ok {
+		return px.url, nil
+	}
+	return nil, nil
+}
+
+func proxyOf(res *http.Response) *proxy {
+	if res == nil || res.Request == nil {
+		return nil
+	}
+	px, _ := res.Request.Context().Value(proxyKey{}).(*proxy)
+	return px
+}
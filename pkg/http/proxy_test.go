@@ -0,0 +1,140 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const testTarget = "http://reading-room.invalid/readingroom/document/doc-1"
+
+func testProxy(status int) (*httptest.Server, *atomic.Int32) {
+	hits := &atomic.Int32{}
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.WriteHeader(status)
+	})), hits
+}
+
+func get(t *testing.T, c *Client) *http.Response {
+	t.Helper()
+	res, err := c.Get(testTarget)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	_ = res.Body.Close()
+	return res
+}
+
+func TestNewProxyPool_Invalid(t *testing.T) {
+	if _, err := NewProxyPool(); !errors.Is(err, ErrNoProxies) {
+		t.Errorf("expected %v, got %v", ErrNoProxies, err)
+	}
+	if _, err := NewProxyPool("ftp://127.0.0.1:21"); err == nil {
+		t.Errorf("expected error for unsupported scheme, got nil")
+	}
+	if _, err := ParseProxyMode("sometimes"); err == nil {
+		t.Errorf("expected error for unknown mode, got nil")
+	}
+}
+
+func TestProxyPool_RotatesPerRequest(t *testing.T) {
+	a, aHits := testProxy(http.StatusOK)
+	defer a.Close()
+	b, bHits := testProxy(http.StatusOK)
+	defer b.Close()
+
+	pool, err := NewProxyPool(a.URL, b.URL)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	c := NewClient().WithProxyPool(pool)
+	for i := 0; i < 4; i++ {
+		get(t, c)
+	}
+
+	if aHits.Load() != 2 || bHits.Load() != 2 {
+		t.Errorf("expected requests to alternate, got %d and %d", aHits.Load(), bHits.Load())
+	}
+}
+
+func TestProxyPool_CoolsDownThrottledProxy(t *testing.T) {
+	a, aHits := testProxy(http.StatusForbidden)
+	defer a.Close()
+	b, bHits := testProxy(http.StatusOK)
+	defer b.Close()
+
+	pool, err := NewProxyPool(a.URL, b.URL)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	c := NewClient().WithProxyPool(pool.WithMode(RotateOnThrottle))
+	for i := 0; i < 3; i++ {
+		get(t, c)
+	}
+
+	if aHits.Load() != 1 || bHits.Load() != 2 {
+		t.Errorf("expected the throttled proxy to be skipped, got %d and %d", aHits.Load(), bHits.Load())
+	}
+	stats := pool.Stats()
+	if stats[0].Throttled != 1 || !stats[0].CoolingUntil.After(time.Now()) || stats[1].Requests != 2 {
+		t.Errorf("unexpected stats: %v", stats)
+	}
+}
+
+func TestProxyPool_MarksFailingProxyUnhealthy(t *testing.T) {
+	dead, _ := testProxy(http.StatusOK)
+	dead.Close()
+	b, bHits := testProxy(http.StatusOK)
+	defer b.Close()
+
+	pool, err := NewProxyPool(dead.URL, b.URL)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	c := NewClient().WithProxyPool(pool.WithMode(RotateOnThrottle))
+	for i := 0; i < maxProxyFailures; i++ {
+		if _, err = c.Get(testTarget); err == nil {
+			t.Fatalf("expected error from dead proxy, got nil")
+		}
+	}
+	get(t, c)
+
+	if bHits.Load() != 1 {
+		t.Errorf("expected to fall over to the healthy proxy, got %d requests", bHits.Load())
+	}
+	if stats := pool.Stats(); stats[0].Healthy || stats[0].Failures != maxProxyFailures {
+		t.Errorf("unexpected stats: %v", stats[0])
+	}
+}
+
+func TestClient_ThrottledCoolsDownProxy(t *testing.T) {
+	a, _ := testProxy(http.StatusOK)
+	defer a.Close()
+
+	pool, err := NewProxyPool(a.URL)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	c := NewClient().WithProxyPool(pool.WithCooldown(time.Hour))
+	res := get(t, c)
+
+	if err = c.Throttled(context.Background(), res); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if stats := pool.Stats(); stats[0].Throttled != 1 {
+		t.Errorf("expected proxy to be throttled, got %v", stats[0])
+	}
+
+	// the only proxy is cooling down, so the next request waits for it
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, testTarget, nil)
+	if _, err = c.Do(req); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected %v, got %v", context.DeadlineExceeded, err)
+	}
+}
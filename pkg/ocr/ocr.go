@@ -0,0 +1,273 @@
+// Package ocr reads the text of scanned PDFs by running the page images pdfcpu extracts through an external
+// OCR command, such as tesseract.
+package ocr
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+
+	"ciascrape/pkg/pdftext"
+)
+
+const (
+	// DefaultCommand runs tesseract with TSV output, which carries the confidence of every word.
+	DefaultCommand = `tesseract "$1" stdout tsv`
+	DefaultTimeout = 2 * time.Minute
+)
+
+var (
+	ErrNoImages  = errors.New("no images in PDF")
+	ErrOCRFailed = errors.New("OCR command failed")
+)
+
+// Page is the text recognized on a page of a PDF. Confidence is between 0 and 1, or -1 if the command
+// did not report it.
+type Page struct {
+	Number     int
+	Text       string
+	Confidence float64
+}
+
+// OCR runs a shell command on every image of a PDF. The command gets the path of the image as $1 and writes
+// the text to stdout, either as plain text or as tesseract TSV.
+type OCR struct {
+	command       string
+	timeout       time.Duration
+	minConfidence float64
+}
+
+func NewOCR(command string) *OCR {
+	if strings.TrimSpace(command) == "" {
+		command = DefaultCommand
+	}
+	return &OCR{command: strings.TrimSpace(command), timeout: DefaultTimeout}
+}
+
+// WithTimeout bounds how long the command may take for a single image.
+func (o *OCR) WithTimeout(timeout time.Duration) *OCR {
+	if timeout > 0 {
+		o.timeout = timeout
+	}
+	return o
+}
+
+// WithMinConfidence leaves pages recognized with a lower confidence out of Text.
+func (o *OCR) WithMinConfidence(confidence float64) *OCR {
+	o.minConfidence = confidence
+	return o
+}
+
+type pageImage struct {
+	page, obj int
+	ext       string
+	data      []byte
+}
+
+// images returns the images of the PDF in data, in page order.
+func images(data []byte) ([]pageImage, error) {
+	var imgs []pageImage
+	conf := model.NewDefaultConfiguration()
+	conf.ValidationMode = model.ValidationRelaxed
+	err := pdftext.Guard(func() error {
+		return api.ExtractImages(bytes.NewReader(data), nil, func(img model.Image, _ bool, _ int) error {
+			dat, err := io.ReadAll(img)
+			if err != nil {
+				return err
+			}
+			imgs = append(imgs, pageImage{page: img.PageNr, obj: img.ObjNr, ext: img.FileType, data: dat})
+			return nil
+		}, conf)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to extract images: %w", err)
+	}
+	sort.SliceStable(imgs, func(i, j int) bool {
+		if imgs[i].page != imgs[j].page {
+			return imgs[i].page < imgs[j].page
+		}
+		return imgs[i].obj < imgs[j].obj
+	})
+	return imgs, nil
+}
+
+// Recognize runs the command on the images of the PDF in data and returns the text of every page with images.
+func (o *OCR) Recognize(ctx context.Context, data []byte) ([]Page, error) {
+	imgs, err := images(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(imgs) == 0 {
+		return nil, ErrNoImages
+	}
+
+	dir, err := os.MkdirTemp("", "cia_scrape-ocr-")
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+
+	var (
+		pages []Page
+		// words weighs the confidence of the images of a page
+		words int
+	)
+	for i, img := range imgs {
+		path := filepath.Join(dir, fmt.Sprintf("page-%d-%d.%s", img.page, i, img.ext))
+		if err = os.WriteFile(path, img.data, 0600); err != nil {
+			return nil, err
+		}
+		text, confidence, n, err := o.run(ctx, path)
+		if err != nil {
+			return nil, fmt.Errorf("page %d: %w", img.page, err)
+		}
+
+		if len(pages) == 0 || pages[len(pages)-1].Number != img.page {
+			pages = append(pages, Page{Number: img.page, Confidence: confidence})
+			words = n
+		} else {
+			p := &pages[len(pages)-1]
+			switch {
+			case p.Confidence < 0 || confidence < 0:
+				p.Confidence = -1
+			case words+n > 0:
+				p.Confidence = (p.Confidence*float64(words) + confidence*float64(n)) / float64(words+n)
+			}
+			words += n
+		}
+		p := &pages[len(pages)-1]
+		if p.Text != "" && text != "" {
+			p.Text += "\n\n"
+		}
+		p.Text += text
+	}
+	return pages, nil
+}
+
+// Text returns the text of the pages of the PDF in data recognized with enough confidence, separated by blank lines.
+func (o *OCR) Text(ctx context.Context, data []byte) (string, error) {
+	pages, err := o.Recognize(ctx, data)
+	if err != nil {
+		return "", err
+	}
+	return o.TextOf(pages), nil
+}
+
+// TextOf returns the text of the pages recognized with enough confidence, separated by blank lines.
+func (o *OCR) TextOf(pages []Page) string {
+	texts := make([]string, 0, len(pages))
+	for _, p := range pages {
+		if p.Text == "" || (p.Confidence >= 0 && p.Confidence < o.minConfidence) {
+			continue
+		}
+		texts = append(texts, p.Text)
+	}
+	return strings.Join(texts, "\n\n")
+}
+
+// TextOrOCR returns the text layer of the PDF in data, or, if it has none and o is not nil, the text o reads
+// from its page images. name labels the log lines.
+func TextOrOCR(name string, data []byte, o *OCR) (string, error) {
+	text, err := pdftext.Text(data)
+	if err == nil || o == nil {
+		return text, err
+	}
+	log.Printf("running OCR on '%s'...", name)
+	pages, ocrErr := o.Recognize(context.Background(), data)
+	if ocrErr != nil {
+		return "", fmt.Errorf("%w (OCR: %v)", err, ocrErr)
+	}
+	for _, p := range pages {
+		log.Printf("[ocr] '%s' page %d: %d characters, confidence %.2f", name, p.Number, len(p.Text), p.Confidence)
+	}
+	if text = o.TextOf(pages); text == "" {
+		return "", err
+	}
+	return text, nil
+}
+
+// run runs the command on the image at path and returns its text, confidence and word count.
+func (o *OCR) run(ctx context.Context, path string) (string, float64, int, error) {
+	ctx, cancel := context.WithTimeout(ctx, o.timeout)
+	defer cancel()
+
+	stderr := &bytes.Buffer{}
+	cmd := exec.CommandContext(ctx, "sh", "-c", o.command, "ocr", path)
+	cmd.Stderr = stderr
+	// kill what the shell started too, or it keeps stdout open past the timeout
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+	cmd.WaitDelay = time.Second
+	out, err := cmd.Output()
+	if err != nil {
+		return "", 0, 0, fmt.Errorf("%w: '%s': %v: %s", ErrOCRFailed, o.command, err, strings.TrimSpace(stderr.String()))
+	}
+	if text, confidence, n, ok := parseTSV(out); ok {
+		return text, confidence, n, nil
+	}
+	return strings.TrimSpace(string(out)), -1, 0, nil
+}
+
+// parseTSV reads tesseract TSV output into lines and paragraphs of text with the mean confidence of its words.
+func parseTSV(out []byte) (string, float64, int, bool) {
+	lines := strings.Split(strings.TrimRight(string(out), "\n"), "\n")
+	if len(lines) == 0 || !strings.HasPrefix(lines[0], "level\tpage_num\tblock_num\tpar_num\tline_num\tword_num") {
+		return "", 0, 0, false
+	}
+
+	sb := &strings.Builder{}
+	var (
+		total    float64
+		words    int
+		lastLine string
+		lastPar  string
+	)
+	for _, line := range lines[1:] {
+		cols := strings.Split(strings.TrimRight(line, "\r"), "\t")
+		if len(cols) < 12 || cols[0] != "5" {
+			continue
+		}
+		conf, err := strconv.ParseFloat(cols[10], 64)
+		word := strings.TrimSpace(cols[11])
+		if err != nil || conf < 0 || word == "" {
+			continue
+		}
+		par := strings.Join(cols[1:4], ".")
+		lineID := par + "." + cols[4]
+		switch {
+		case words == 0:
+		case par != lastPar:
+			sb.WriteString("\n\n")
+		case lineID != lastLine:
+			sb.WriteString("\n")
+		default:
+			sb.WriteString(" ")
+		}
+		sb.WriteString(word)
+		lastPar, lastLine = par, lineID
+		total += conf
+		words++
+	}
+	if words == 0 {
+		return "", 0, 0, true
+	}
+	return sb.String(), total / float64(words) / 100, words, true
+}
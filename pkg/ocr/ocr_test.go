@@ -0,0 +1,116 @@
+package ocr
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"ciascrape/internal/pdftest"
+	"ciascrape/pkg/pdftext"
+)
+
+const tsvHeader = "level\tpage_num\tblock_num\tpar_num\tline_num\tword_num\tleft\ttop\twidth\theight\tconf\ttext"
+
+// fakeTesseract writes a script that answers like tesseract with TSV output: confident words for the
+// first page and noise for the others. It fails for images that are missing or empty.
+func fakeTesseract(t *testing.T) string {
+	t.Helper()
+	script := filepath.Join(t.TempDir(), "tesseract.sh")
+	body := `#!/bin/sh
+test -s "$1" || { echo "cannot read $1" >&2; exit 1; }
+echo '` + tsvHeader + `'
+case "$1" in
+*page-1-*.png)
+	printf '1\t1\t0\t0\t0\t0\t0\t0\t2\t2\t-1\t\n'
+	printf '5\t1\t1\t1\t1\t1\t0\t0\t1\t1\t96\tTASK\n'
+	printf '5\t1\t1\t1\t1\t2\t0\t0\t1\t1\t90\tFORCE\n'
+	printf '5\t1\t1\t1\t2\t1\t0\t0\t1\t1\t93\tremote\n'
+	printf '5\t1\t1\t2\t1\t1\t0\t0\t1\t1\t81\tSECRET\n'
+	;;
+*)
+	printf '5\t1\t1\t1\t1\t1\t0\t0\t1\t1\t12\t~:;\n'
+	;;
+esac
+`
+	if err := os.WriteFile(script, []byte(body), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return `sh ` + script + ` "$1"`
+}
+
+func TestOCR_Recognize(t *testing.T) {
+	o := NewOCR(fakeTesseract(t))
+	pages, err := o.Recognize(context.Background(), pdftest.Scanned(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pages) != 2 {
+		t.Fatalf("expected 2 pages, got %+v", pages)
+	}
+	if pages[0].Number != 1 || pages[0].Text != "TASK FORCE\nremote\n\nSECRET" || pages[0].Confidence != 0.9 {
+		t.Errorf("unexpected first page: %+v", pages[0])
+	}
+	if pages[1].Number != 2 || pages[1].Text != "~:;" || pages[1].Confidence != 0.12 {
+		t.Errorf("unexpected second page: %+v", pages[1])
+	}
+
+	text, err := o.WithMinConfidence(0.5).Text(context.Background(), pdftest.Scanned(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if text != "TASK FORCE\nremote\n\nSECRET" {
+		t.Errorf("expected the noisy page to be left out, got %q", text)
+	}
+}
+
+func TestOCR_PlainText(t *testing.T) {
+	pages, err := NewOCR(`echo "  MEMORANDUM FOR $(basename "$1")  "`).Recognize(context.Background(), pdftest.Scanned(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pages) != 1 || pages[0].Text != "MEMORANDUM FOR page-1-0.png" || pages[0].Confidence != -1 {
+		t.Errorf("unexpected pages: %+v", pages)
+	}
+}
+
+func TestOCR_Errors(t *testing.T) {
+	_, err := NewOCR(`echo "out of memory" >&2; exit 3`).Recognize(context.Background(), pdftest.Scanned(1))
+	if !errors.Is(err, ErrOCRFailed) || !strings.Contains(err.Error(), "out of memory") {
+		t.Errorf("expected %v with the command's output, got %v", ErrOCRFailed, err)
+	}
+
+	noImages := bytes.Replace(pdftest.Scanned(1), []byte("/Im0 Do"), []byte("       "), 1)
+	noImages = bytes.Replace(noImages, []byte("/XObject << /Im0 5 0 R >>"), []byte("                         "), 1)
+	if _, err = NewOCR("cat").Recognize(context.Background(), noImages); !errors.Is(err, ErrNoImages) {
+		t.Errorf("expected %v, got %v", ErrNoImages, err)
+	}
+
+	_, err = NewOCR("sleep 5").WithTimeout(100*time.Millisecond).Recognize(context.Background(), pdftest.Scanned(1))
+	if !errors.Is(err, ErrOCRFailed) {
+		t.Errorf("expected the command to time out, got %v", err)
+	}
+}
+
+func TestTextOrOCR(t *testing.T) {
+	if _, err := TextOrOCR("scan.pdf", pdftest.Scanned(1), nil); !errors.Is(err, pdftext.ErrNoText) {
+		t.Errorf("expected %v without OCR, got %v", pdftext.ErrNoText, err)
+	}
+
+	text, err := TextOrOCR("scan.pdf", pdftest.Scanned(2), NewOCR(fakeTesseract(t)).WithMinConfidence(0.5))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if text != "TASK FORCE\nremote\n\nSECRET" {
+		t.Errorf("unexpected text: %q", text)
+	}
+
+	_, err = TextOrOCR("scan.pdf", pdftest.Scanned(1), NewOCR(`exit 3`))
+	if !errors.Is(err, pdftext.ErrNoText) || !strings.Contains(err.Error(), "OCR") {
+		t.Errorf("expected %v with the OCR error, got %v", pdftext.ErrNoText, err)
+	}
+}
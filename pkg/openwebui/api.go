@@ -0,0 +1,198 @@
+// Package openwebui stores the scraped documents in an Open WebUI knowledge collection.
+package openwebui
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"strings"
+	"sync"
+
+	http2 "ciascrape/pkg/http"
+
+	"ciascrape/pkg/mu"
+)
+
+const (
+	DefaultEndpoint  = "http://localhost:8080/"
+	DefaultKnowledge = "cia-reading-room"
+)
+
+var (
+	ErrUnmarshal         = errors.New("failed to unmarshal response")
+	ErrKnowledgeNotFound = errors.New("knowledge collection not found")
+)
+
+type Config struct {
+	Endpoint string
+	APIKey   string
+	// Knowledge is the name of the knowledge collection documents are added to.
+	Knowledge string
+	// KnowledgeID is the ID of the collection, looked up or created by Validate.
+	KnowledgeID string
+	seen        map[string]string
+	mu          sync.RWMutex
+}
+
+func NewConfig() *Config {
+	return &Config{
+		Endpoint:  DefaultEndpoint,
+		Knowledge: DefaultKnowledge,
+		seen:      make(map[string]string),
+	}
+}
+
+func (c *Config) WithEndpoint(endpoint string) *Config {
+	if !strings.HasSuffix(endpoint, "/") {
+		endpoint += "/"
+	}
+	c.Endpoint = endpoint
+	return c
+}
+
+func (c *Config) WithAPIKey(key string) *Config {
+	if strings.TrimSpace(key) == "" {
+		return c
+	}
+	c.APIKey = key
+	return c
+}
+
+// WithKnowledge sets the name of the knowledge collection, the Open WebUI counterpart of an AnythingLLM workspace.
+func (c *Config) WithKnowledge(name string) *Config {
+	c.Knowledge = name
+	return c
+}
+
+func (c *Config) do(req *http.Request) (*http.Response, error) {
+	if c.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(c.APIKey))
+	}
+	req.Header.Set("Accept", "application/json")
+	mu.GetMutex("net").RLock()
+	res, err := http2.DefaultClient.Do(req)
+	mu.GetMutex("net").RUnlock()
+	return res, err
+}
+
+func (c *Config) get(endpoint string) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, c.Endpoint+endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	return c.do(req)
+}
+
+func (c *Config) delete(endpoint string) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodDelete, c.Endpoint+endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	return c.do(req)
+}
+
+func (c *Config) post(endpoint string, v interface{}) (*http.Response, error) {
+	dat, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(http.MethodPost, c.Endpoint+endpoint, bytes.NewReader(dat))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return c.do(req)
+}
+
+// uploadMultipart posts data as the multipart file name, with metadata as a JSON form field.
+func (c *Config) uploadMultipart(endpoint, name string, data []byte, metadata interface{}) (*http.Response, error) {
+	buf := &bytes.Buffer{}
+	w := multipart.NewWriter(buf)
+
+	fw, err := w.CreateFormFile("file", name)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = fw.Write(data); err != nil {
+		return nil, err
+	}
+	if metadata != nil {
+		meta, err := json.Marshal(metadata)
+		if err != nil {
+			return nil, err
+		}
+		if err = w.WriteField("metadata", string(meta)); err != nil {
+			return nil, err
+		}
+	}
+	if err = w.Close(); err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, c.Endpoint+endpoint, buf)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", w.FormDataContentType())
+	return c.do(req)
+}
+
+// readJSON unmarshals the body of a 200 response into v and closes it.
+func readJSON(res *http.Response, v interface{}) error {
+	defer func() {
+		_ = res.Body.Close()
+	}()
+	data, err := io.ReadAll(res.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read response: %w", err)
+	}
+	if res.StatusCode != http.StatusOK {
+		detail := struct {
+			Detail interface{} `json:"detail"`
+		}{}
+		if json.Unmarshal(data, &detail) == nil && detail.Detail != nil {
+			return fmt.Errorf("bad status code: %s: %v", res.Status, detail.Detail)
+		}
+		return fmt.Errorf("bad status code: %s", res.Status)
+	}
+	if v == nil {
+		return nil
+	}
+	if err = json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("%w: %v", ErrUnmarshal, err)
+	}
+	return nil
+}
+
+type User struct {
+	ID    string `json:"id"`
+	Email string `json:"email"`
+	Name  string `json:"name"`
+	Role  string `json:"role"`
+}
+
+// Validate checks the API key, finds or creates the knowledge collection and lists the files already in it.
+func (c *Config) Validate() error {
+	if strings.TrimSpace(c.Knowledge) == "" {
+		return errors.New("missing knowledge collection")
+	}
+	res, err := c.get("api/v1/auths/")
+	if err != nil {
+		return err
+	}
+	user := &User{}
+	if err = readJSON(res, user); err != nil {
+		return fmt.Errorf("failed to authenticate: %w", err)
+	}
+
+	knowledge, err := c.EnsureKnowledge()
+	if err != nil {
+		return err
+	}
+	c.updateSeen(knowledge.Files)
+	return nil
+}
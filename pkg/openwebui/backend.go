@@ -0,0 +1,176 @@
+package openwebui
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"path"
+	"strings"
+
+	"ciascrape/pkg/cia"
+	"ciascrape/pkg/rag"
+)
+
+// Metadata is uploaded with every file and comes back in its FileMeta, which is how documents
+// already in the knowledge collection are recognized.
+type Metadata struct {
+	URL            string            `json:"url,omitempty"`
+	Title          string            `json:"title,omitempty"`
+	Source         string            `json:"source,omitempty"`
+	DocumentNumber string            `json:"document_number,omitempty"`
+	DocumentType   string            `json:"document_type,omitempty"`
+	Collection     string            `json:"collection,omitempty"`
+	Published      string            `json:"published,omitempty"`
+	Fields         map[string]string `json:"fields,omitempty"`
+}
+
+// Backend stores the scraped documents in an Open WebUI knowledge collection.
+type Backend struct {
+	c *Config
+}
+
+var _ rag.Backend = (*Backend)(nil)
+
+func NewBackend(c *Config) *Backend {
+	return &Backend{c: c}
+}
+
+// HasSeen reports whether url was uploaded, in this run or, once Validate listed them, in an earlier one.
+func (c *Config) HasSeen(url string) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	_, ok := c.seen[url]
+	return ok
+}
+
+func (c *Config) markSeen(url, id string) {
+	c.mu.Lock()
+	c.seen[url] = id
+	c.mu.Unlock()
+}
+
+func (c *Config) unmarkSeen(id string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for url, seenID := range c.seen {
+		if seenID == id {
+			delete(c.seen, url)
+		}
+	}
+}
+
+func (c *Config) updateSeen(files []File) {
+	for _, f := range files {
+		if f.Meta.Data.URL != "" {
+			c.markSeen(f.Meta.Data.URL, f.ID)
+		}
+	}
+	log.Printf("total existing files in knowledge '%s' observed for dedupe purposes: %d", c.Knowledge, len(files))
+}
+
+// fileName names the upload of url, e.g. cia-rdp96-00788r001200410003-2.txt for a document page.
+func fileName(url, ext string) string {
+	name := path.Base(strings.TrimRight(url, "/"))
+	if name == "." || name == "/" || name == "" {
+		name = "document"
+	}
+	if !strings.HasSuffix(strings.ToLower(name), ext) {
+		name += ext
+	}
+	return name
+}
+
+func toRAG(f *File, url, title string) *rag.Document {
+	return &rag.Document{ID: f.ID, Location: f.ID, URL: url, Title: title}
+}
+
+func (c *Config) store(url, name string, data []byte, meta Metadata) (*rag.Document, error) {
+	if c.HasSeen(url) {
+		return nil, rag.ErrDuplicate
+	}
+	f, err := c.CreateFile(name, data, meta)
+	if err != nil {
+		return nil, err
+	}
+	c.markSeen(url, f.ID)
+	return toRAG(f, url, meta.Title), nil
+}
+
+func (b *Backend) Name() string {
+	return "openwebui"
+}
+
+func (b *Backend) Validate() error {
+	return b.c.Validate()
+}
+
+func (b *Backend) Seen(url string) bool {
+	return b.c.HasSeen(url)
+}
+
+// UploadText uploads the text of a document page as a .txt file.
+func (b *Backend) UploadText(doc *cia.Document) (*rag.Document, error) {
+	if rag.IsAccessDenied(doc) {
+		return nil, rag.ErrAccessDenied
+	}
+	published := doc.PublicationDate
+	if published == "" {
+		published = doc.ReleaseDate
+	}
+	return b.c.store(doc.URL, fileName(doc.URL, ".txt"), []byte(doc.Text()), Metadata{
+		URL:            doc.URL,
+		Title:          doc.Title,
+		Source:         rag.ReadingRoomSource,
+		DocumentNumber: doc.DocumentNumber,
+		DocumentType:   doc.DocumentType,
+		Collection:     doc.Collection,
+		Published:      published,
+		Fields:         doc.Fields,
+	})
+}
+
+func (b *Backend) UploadFile(url, name string, data []byte) (*rag.Document, error) {
+	return b.c.store(url, name, data, Metadata{URL: url, Title: name, Source: rag.ReadingRoomSource})
+}
+
+// UploadLink is not supported, Open WebUI is only given what we fetched ourselves.
+func (b *Backend) UploadLink(string) (*rag.Document, error) {
+	return nil, rag.ErrUnsupported
+}
+
+// Attach adds the uploaded files to the knowledge collection.
+func (b *Backend) Attach(docs ...*rag.Document) error {
+	for _, doc := range docs {
+		if err := b.c.AddFile(doc.Location); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Delete removes files from the knowledge collection and deletes them.
+func (b *Backend) Delete(docs ...*rag.Document) error {
+	for _, doc := range docs {
+		if doc == nil || doc.Location == "" {
+			continue
+		}
+		if err := b.c.RemoveFile(doc.Location); err != nil {
+			// most likely never added
+			log.Printf("[err] %v", err)
+		}
+		if err := b.c.DeleteFile(doc.Location); err != nil {
+			return fmt.Errorf("failed to delete '%s': %w", doc.URL, err)
+		}
+		b.c.unmarkSeen(doc.Location)
+	}
+	return nil
+}
+
+// Flush does nothing, files are added to the knowledge collection as they are attached.
+func (b *Backend) Flush(context.Context) error {
+	return nil
+}
+
+func (b *Backend) Close() error {
+	return nil
+}
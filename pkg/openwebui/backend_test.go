@@ -0,0 +1,195 @@
+package openwebui
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"ciascrape/pkg/cia"
+	"ciascrape/pkg/rag"
+)
+
+// fakeOpenWebUI is a minimal stand-in for the Open WebUI files and knowledge API.
+type fakeOpenWebUI struct {
+	knowledge map[string]*Knowledge
+	files     map[string]*File
+	contents  map[string]string
+	nextID    int
+	mu        sync.Mutex
+}
+
+func newFakeOpenWebUI() *fakeOpenWebUI {
+	existing := &File{ID: "file-0", Filename: "doc-0.txt", Meta: FileMeta{Name: "doc-0.txt", Data: Metadata{URL: "https://www.cia.gov/readingroom/document/doc-0"}}}
+	return &fakeOpenWebUI{
+		knowledge: map[string]*Knowledge{"k-1": {ID: "k-1", Name: "stargate", Files: []File{*existing}}},
+		files:     map[string]*File{existing.ID: existing},
+		contents:  make(map[string]string),
+	}
+}
+
+func (f *fakeOpenWebUI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Authorization") != "Bearer testKey" {
+		w.WriteHeader(http.StatusUnauthorized)
+		_, _ = w.Write([]byte(`{"detail": "Not authenticated"}`))
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	path := strings.TrimPrefix(r.URL.Path, "/api/v1/")
+	switch {
+	case path == "auths/":
+		_, _ = w.Write([]byte(`{"id": "u-1", "email": "analyst@example.com", "role": "user"}`))
+	case path == "knowledge/" && r.Method == http.MethodGet:
+		list := make([]Knowledge, 0, len(f.knowledge))
+		for _, k := range f.knowledge {
+			list = append(list, Knowledge{ID: k.ID, Name: k.Name})
+		}
+		_ = json.NewEncoder(w).Encode(list)
+	case path == "knowledge/create":
+		req := map[string]string{}
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		f.nextID++
+		k := &Knowledge{ID: fmt.Sprintf("k-new-%d", f.nextID), Name: req["name"], Description: req["description"]}
+		f.knowledge[k.ID] = k
+		_ = json.NewEncoder(w).Encode(k)
+	case strings.HasSuffix(path, "/file/add") || strings.HasSuffix(path, "/file/remove"):
+		id := strings.Split(path, "/")[1]
+		k, ok := f.knowledge[id]
+		req := fileID{}
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		file, fileOK := f.files[req.FileID]
+		if !ok || !fileOK {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"detail": "Not found"}`))
+			return
+		}
+		if strings.HasSuffix(path, "/add") {
+			k.Files = append(k.Files, *file)
+		} else {
+			for i := range k.Files {
+				if k.Files[i].ID == req.FileID {
+					k.Files = append(k.Files[:i], k.Files[i+1:]...)
+					break
+				}
+			}
+		}
+		_ = json.NewEncoder(w).Encode(k)
+	case strings.HasPrefix(path, "knowledge/"):
+		k, ok := f.knowledge[strings.TrimPrefix(path, "knowledge/")]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"detail": "We could not find what you're looking for :/"}`))
+			return
+		}
+		_ = json.NewEncoder(w).Encode(k)
+	case path == "files/" && r.Method == http.MethodPost:
+		mf, header, err := r.FormFile("file")
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		data, _ := io.ReadAll(mf)
+		meta := Metadata{}
+		_ = json.Unmarshal([]byte(r.FormValue("metadata")), &meta)
+		f.nextID++
+		file := &File{ID: fmt.Sprintf("file-%d", f.nextID), Filename: header.Filename, Meta: FileMeta{Name: header.Filename, Size: int64(len(data)), Data: meta}}
+		f.files[file.ID] = file
+		f.contents[file.ID] = string(data)
+		_ = json.NewEncoder(w).Encode(file)
+	case strings.HasPrefix(path, "files/") && r.Method == http.MethodDelete:
+		id := strings.TrimPrefix(path, "files/")
+		if _, ok := f.files[id]; !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		delete(f.files, id)
+		_, _ = w.Write([]byte(`true`))
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func newTestConfig(t *testing.T, f *fakeOpenWebUI, knowledge string) *Config {
+	t.Helper()
+	server := httptest.NewServer(f)
+	t.Cleanup(server.Close)
+	return NewConfig().WithEndpoint(server.URL).WithAPIKey("testKey").WithKnowledge(knowledge)
+}
+
+func TestBackend_UploadAttachDelete(t *testing.T) {
+	f := newFakeOpenWebUI()
+	var backend rag.Backend = NewBackend(newTestConfig(t, f, "stargate"))
+	if err := backend.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if !backend.Seen("https://www.cia.gov/readingroom/document/doc-0") {
+		t.Error("expected the file already in the knowledge collection to be seen")
+	}
+
+	doc := &cia.Document{
+		URL:            "https://www.cia.gov/readingroom/document/doc-1",
+		Title:          "(TAB A) TASK FORCE",
+		DocumentNumber: "CIA-RDP96-00788R001200410003-2",
+		Body:           "TASK FORCE",
+	}
+	text, err := backend.UploadText(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = backend.UploadText(doc); !errors.Is(err, rag.ErrDuplicate) {
+		t.Errorf("expected %v, got %v", rag.ErrDuplicate, err)
+	}
+	pdf, err := backend.UploadFile("https://www.cia.gov/readingroom/docs/doc-1.pdf", "doc-1.pdf", []byte("%PDF-1.4"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = backend.Attach(text, pdf); err != nil {
+		t.Fatal(err)
+	}
+
+	k := f.knowledge["k-1"]
+	if len(k.Files) != 3 || k.Files[1].Filename != "doc-1.txt" || k.Files[1].Meta.Data.DocumentNumber != doc.DocumentNumber {
+		t.Fatalf("unexpected knowledge files: %+v", k.Files)
+	}
+	if !strings.Contains(f.contents[text.Location], "TASK FORCE") {
+		t.Errorf("unexpected text upload: %q", f.contents[text.Location])
+	}
+
+	if err = backend.Delete(pdf); err != nil {
+		t.Fatal(err)
+	}
+	if len(k.Files) != 2 || f.files[pdf.Location] != nil || backend.Seen(pdf.URL) {
+		t.Errorf("expected the PDF to be removed, got %+v", k.Files)
+	}
+
+	if _, err = backend.UploadLink(doc.URL); !errors.Is(err, rag.ErrUnsupported) {
+		t.Errorf("expected %v, got %v", rag.ErrUnsupported, err)
+	}
+	doc.URL, doc.Title = doc.URL+"-denied", "Access Denied"
+	if _, err = backend.UploadText(doc); !errors.Is(err, rag.ErrAccessDenied) {
+		t.Errorf("expected %v, got %v", rag.ErrAccessDenied, err)
+	}
+}
+
+func TestValidate_CreatesKnowledge(t *testing.T) {
+	f := newFakeOpenWebUI()
+	c := newTestConfig(t, f, "mkultra")
+	if err := c.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if k := f.knowledge[c.KnowledgeID]; k == nil || k.Name != "mkultra" {
+		t.Errorf("expected knowledge 'mkultra' to be created, got %q", c.KnowledgeID)
+	}
+
+	c = newTestConfig(t, f, "stargate").WithAPIKey("yeet")
+	if err := c.Validate(); err == nil || !strings.Contains(err.Error(), "Not authenticated") {
+		t.Errorf("expected an authentication error, got %v", err)
+	}
+}
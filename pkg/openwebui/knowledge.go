@@ -0,0 +1,154 @@
+package openwebui
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+)
+
+// FileMeta is the metadata Open WebUI keeps about an uploaded file. Data holds the metadata we uploaded it with.
+type FileMeta struct {
+	Name        string   `json:"name"`
+	ContentType string   `json:"content_type"`
+	Size        int64    `json:"size"`
+	Data        Metadata `json:"data"`
+}
+
+type File struct {
+	ID       string   `json:"id"`
+	Filename string   `json:"filename"`
+	Hash     string   `json:"hash"`
+	Meta     FileMeta `json:"meta"`
+}
+
+type Knowledge struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Files       []File `json:"files"`
+}
+
+type fileID struct {
+	FileID string `json:"file_id"`
+}
+
+func (c *Config) ListKnowledge() ([]Knowledge, error) {
+	res, err := c.get("api/v1/knowledge/")
+	if err != nil {
+		return nil, err
+	}
+	var knowledge []Knowledge
+	if err = readJSON(res, &knowledge); err != nil {
+		return nil, fmt.Errorf("failed to list knowledge: %w", err)
+	}
+	return knowledge, nil
+}
+
+// GetKnowledge returns the knowledge collection with its files.
+func (c *Config) GetKnowledge(id string) (*Knowledge, error) {
+	res, err := c.get("api/v1/knowledge/" + url.PathEscape(id))
+	if err != nil {
+		return nil, err
+	}
+	knowledge := &Knowledge{}
+	if err = readJSON(res, knowledge); err != nil {
+		return nil, fmt.Errorf("failed to get knowledge '%s': %w", id, err)
+	}
+	if knowledge.ID == "" {
+		return nil, fmt.Errorf("%w: %s", ErrKnowledgeNotFound, id)
+	}
+	return knowledge, nil
+}
+
+func (c *Config) CreateKnowledge(name, description string) (*Knowledge, error) {
+	res, err := c.post("api/v1/knowledge/create", map[string]string{"name": name, "description": description})
+	if err != nil {
+		return nil, err
+	}
+	knowledge := &Knowledge{}
+	if err = readJSON(res, knowledge); err != nil {
+		return nil, fmt.Errorf("failed to create knowledge '%s': %w", name, err)
+	}
+	return knowledge, nil
+}
+
+// EnsureKnowledge looks up the ID of the configured knowledge collection by name, creating it if it does not exist yet.
+func (c *Config) EnsureKnowledge() (*Knowledge, error) {
+	if c.KnowledgeID == "" {
+		all, err := c.ListKnowledge()
+		if err != nil {
+			return nil, err
+		}
+		for _, k := range all {
+			if strings.EqualFold(k.Name, c.Knowledge) || k.ID == c.Knowledge {
+				c.KnowledgeID = k.ID
+				break
+			}
+		}
+	}
+	if c.KnowledgeID != "" {
+		knowledge, err := c.GetKnowledge(c.KnowledgeID)
+		if !errors.Is(err, ErrKnowledgeNotFound) {
+			return knowledge, err
+		}
+	}
+
+	log.Printf("creating knowledge collection '%s'", c.Knowledge)
+	knowledge, err := c.CreateKnowledge(c.Knowledge, "Documents scraped from the CIA FOIA Electronic Reading Room")
+	if err != nil {
+		return nil, err
+	}
+	c.KnowledgeID = knowledge.ID
+	return knowledge, nil
+}
+
+func (c *Config) AddFile(id string) error {
+	res, err := c.post("api/v1/knowledge/"+url.PathEscape(c.KnowledgeID)+"/file/add", &fileID{FileID: id})
+	if err != nil {
+		return err
+	}
+	if err = readJSON(res, nil); err != nil {
+		return fmt.Errorf("failed to add file '%s' to knowledge: %w", id, err)
+	}
+	return nil
+}
+
+func (c *Config) RemoveFile(id string) error {
+	res, err := c.post("api/v1/knowledge/"+url.PathEscape(c.KnowledgeID)+"/file/remove", &fileID{FileID: id})
+	if err != nil {
+		return err
+	}
+	if err = readJSON(res, nil); err != nil {
+		return fmt.Errorf("failed to remove file '%s' from knowledge: %w", id, err)
+	}
+	return nil
+}
+
+// CreateFile uploads data as the file name with metadata, which is kept with the file and used for dedupe.
+func (c *Config) CreateFile(name string, data []byte, metadata Metadata) (*File, error) {
+	res, err := c.uploadMultipart("api/v1/files/", name, data, metadata)
+	if err != nil {
+		return nil, err
+	}
+	file := &File{}
+	if err = readJSON(res, file); err != nil {
+		return nil, fmt.Errorf("failed to upload '%s': %w", name, err)
+	}
+	if file.ID == "" {
+		return nil, fmt.Errorf("failed to upload '%s': no file ID returned", name)
+	}
+	return file, nil
+}
+
+func (c *Config) DeleteFile(id string) error {
+	res, err := c.delete("api/v1/files/" + url.PathEscape(id))
+	if err != nil {
+		return err
+	}
+	if err = readJSON(res, nil); err != nil {
+		return fmt.Errorf("failed to delete file '%s': %w", id, err)
+	}
+	return nil
+}
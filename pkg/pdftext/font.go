@@ -0,0 +1,152 @@
+package pdftext
+
+import (
+	"strings"
+	"unicode/utf16"
+
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/types"
+)
+
+// winAnsi maps the codes 0x80-0x9f of WinAnsiEncoding, where it differs from Latin-1.
+var winAnsi = map[byte]rune{
+	0x80: '€', 0x82: '‚', 0x83: 'ƒ', 0x84: '„', 0x85: '…', 0x86: '†', 0x87: '‡', 0x88: 'ˆ', 0x89: '‰',
+	0x8a: 'Š', 0x8b: '‹', 0x8c: 'Œ', 0x8e: 'Ž', 0x91: '\'', 0x92: '\'', 0x93: '"', 0x94: '"', 0x95: '•',
+	0x96: '-', 0x97: '-', 0x98: '˜', 0x99: '™', 0x9a: 'š', 0x9b: '›', 0x9c: 'œ', 0x9e: 'ž', 0x9f: 'Ÿ',
+}
+
+// font decodes the strings shown with a font into text.
+type font struct {
+	// toUnicode maps character codes to text, from the ToUnicode CMap of the font
+	toUnicode map[string]string
+	// codeLen is the length in bytes of a character code
+	codeLen int
+}
+
+// simpleFont is used for fonts we know nothing about.
+var simpleFont = &font{codeLen: 1}
+
+func (f *font) decode(s []byte) string {
+	sb := &strings.Builder{}
+	for i := 0; i+f.codeLen <= len(s); i += f.codeLen {
+		code := s[i : i+f.codeLen]
+		if text, ok := f.toUnicode[string(code)]; ok {
+			sb.WriteString(text)
+			continue
+		}
+		if f.codeLen != 1 {
+			// CIDs mean nothing without a ToUnicode CMap
+			continue
+		}
+		switch c := code[0]; {
+		case c == '\t' || c == '\n' || c == '\r':
+			sb.WriteByte(' ')
+		case c < 0x20 || c == 0x7f:
+		case c >= 0x80 && c <= 0x9f:
+			if r, ok := winAnsi[c]; ok {
+				sb.WriteRune(r)
+			}
+		default:
+			sb.WriteRune(rune(c))
+		}
+	}
+	return sb.String()
+}
+
+// utf16Text decodes the UTF-16BE destination of a CMap mapping.
+func utf16Text(b []byte) string {
+	units := make([]uint16, 0, len(b)/2)
+	for i := 0; i+1 < len(b); i += 2 {
+		units = append(units, uint16(b[i])<<8|uint16(b[i+1]))
+	}
+	return string(utf16.Decode(units))
+}
+
+// incremented returns b plus n, as a big-endian number of the same length.
+func incremented(b []byte, n int) []byte {
+	out := append([]byte(nil), b...)
+	for i := len(out) - 1; i >= 0 && n > 0; i-- {
+		sum := int(out[i]) + n
+		out[i] = byte(sum)
+		n = sum >> 8
+	}
+	return out
+}
+
+// maxRange caps bfrange mappings, so a corrupt CMap can't exhaust memory.
+const maxRange = 1 << 16
+
+// parseCMap reads the codespace and bfchar and bfrange mappings of a ToUnicode CMap into f.
+func parseCMap(data []byte, f *font) {
+	l := &lexer{data: data}
+	var operands []token
+	for {
+		t, ok := l.next()
+		if !ok {
+			return
+		}
+		if t.kind != tokenOperator {
+			operands = append(operands, t)
+			continue
+		}
+		switch t.text {
+		case "endcodespacerange":
+			if len(operands) > 0 && len(operands[0].str) > 0 {
+				f.codeLen = len(operands[0].str)
+			}
+		case "endbfchar":
+			for i := 0; i+1 < len(operands); i += 2 {
+				f.toUnicode[string(operands[i].str)] = utf16Text(operands[i+1].str)
+			}
+		case "endbfrange":
+			for i := 0; i+2 < len(operands); i += 3 {
+				lo, hi, dst := operands[i].str, operands[i+1].str, operands[i+2]
+				if len(lo) == 0 || len(lo) != len(hi) {
+					continue
+				}
+				for n := 0; n < maxRange; n++ {
+					code := incremented(lo, n)
+					if string(code) > string(hi) {
+						break
+					}
+					switch {
+					case dst.kind == tokenArray && n < len(dst.array):
+						f.toUnicode[string(code)] = utf16Text(dst.array[n].str)
+					case dst.kind == tokenString && len(dst.str) > 0:
+						f.toUnicode[string(code)] = utf16Text(incremented(dst.str, n))
+					}
+				}
+			}
+		}
+		operands = operands[:0]
+	}
+}
+
+// pageFonts returns the fonts of the resources of a page, by resource name.
+func pageFonts(ctx *model.Context, resources types.Dict) map[string]*font {
+	fonts := make(map[string]*font)
+	if resources == nil {
+		return fonts
+	}
+	fontDict, err := ctx.DereferenceDict(resources["Font"])
+	if err != nil || fontDict == nil {
+		return fonts
+	}
+	for name, o := range fontDict {
+		d, err := ctx.DereferenceDict(o)
+		if err != nil || d == nil {
+			continue
+		}
+		f := &font{toUnicode: make(map[string]string), codeLen: 1}
+		if subtype := d.NameEntry("Subtype"); subtype != nil && *subtype == "Type0" {
+			f.codeLen = 2
+		}
+		if o, ok := d.Find("ToUnicode"); ok {
+			if sd, _, err := ctx.DereferenceStreamDict(o); err == nil && sd != nil && sd.Decode() == nil {
+				parseCMap(sd.Content, f)
+			}
+		}
+		fonts[name] = f
+	}
+	return fonts
+}
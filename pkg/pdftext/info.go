@@ -0,0 +1,86 @@
+package pdftext
+
+import (
+	"strings"
+	"time"
+
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/types"
+)
+
+// Info holds the properties of a PDF: its information dictionary and page count.
+// Dates the PDF doesn't have or that can't be parsed are zero.
+type Info struct {
+	Title     string
+	Author    string
+	Subject   string
+	Keywords  string
+	Creator   string
+	Producer  string
+	Created   time.Time
+	Modified  time.Time
+	PageCount int
+}
+
+// ReadInfo returns the properties of the PDF in data.
+func ReadInfo(data []byte) (*Info, error) {
+	var info *Info
+	err := Guard(func() (err error) {
+		info, err = readInfo(data)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+func readInfo(data []byte) (*Info, error) {
+	ctx, err := readContext(data)
+	if err != nil {
+		return nil, err
+	}
+	info := &Info{PageCount: ctx.PageCount}
+	if ctx.Info == nil {
+		return info, nil
+	}
+	d, err := ctx.DereferenceDict(*ctx.Info)
+	if err != nil || d == nil {
+		// a broken information dictionary leaves the rest of the PDF readable
+		return info, nil
+	}
+
+	str := func(key string) string {
+		obj, ok := d.Find(key)
+		if !ok {
+			return ""
+		}
+		s, err := ctx.DereferenceStringOrHexLiteral(obj, model.V10, nil)
+		if err != nil {
+			return ""
+		}
+		return strings.TrimSpace(strings.Map(func(r rune) rune {
+			if r < ' ' {
+				return ' '
+			}
+			return r
+		}, s))
+	}
+	date := func(key string) time.Time {
+		t, ok := types.DateTime(str(key), true)
+		if !ok {
+			return time.Time{}
+		}
+		return t
+	}
+
+	info.Title = str("Title")
+	info.Author = str("Author")
+	info.Subject = str("Subject")
+	info.Keywords = str("Keywords")
+	info.Creator = str("Creator")
+	info.Producer = str("Producer")
+	info.Created = date("CreationDate")
+	info.Modified = date("ModDate")
+	return info, nil
+}
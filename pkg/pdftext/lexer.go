@@ -0,0 +1,254 @@
+package pdftext
+
+import (
+	"bytes"
+	"encoding/hex"
+	"strconv"
+)
+
+type tokenKind int
+
+const (
+	tokenNumber tokenKind = iota
+	tokenName
+	tokenString
+	tokenArray
+	tokenDict
+	tokenOperator
+)
+
+// token is an operand or operator of a content stream or CMap.
+type token struct {
+	kind  tokenKind
+	text  string
+	str   []byte
+	num   float64
+	array []token
+}
+
+// lexer splits PostScript-like syntax, as used by content streams and CMaps, into tokens.
+type lexer struct {
+	data []byte
+	pos  int
+}
+
+func isWhite(c byte) bool {
+	switch c {
+	case ' ', '\t', '\r', '\n', '\f', 0:
+		return true
+	}
+	return false
+}
+
+func isDelimiter(c byte) bool {
+	switch c {
+	case '(', ')', '<', '>', '[', ']', '{', '}', '/', '%':
+		return true
+	}
+	return false
+}
+
+func (l *lexer) skipWhite() {
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		switch {
+		case isWhite(c):
+			l.pos++
+		case c == '%':
+			for l.pos < len(l.data) && l.data[l.pos] != '\n' && l.data[l.pos] != '\r' {
+				l.pos++
+			}
+		default:
+			return
+		}
+	}
+}
+
+// next returns the next token, or false at the end of the data.
+func (l *lexer) next() (token, bool) {
+	for {
+		l.skipWhite()
+		if l.pos >= len(l.data) {
+			return token{}, false
+		}
+		c := l.data[l.pos]
+		switch {
+		case c == '/':
+			l.pos++
+			return token{kind: tokenName, text: l.word()}, true
+		case c == '(':
+			l.pos++
+			return token{kind: tokenString, str: l.literal()}, true
+		case c == '<' && l.peek(1) == '<':
+			l.pos += 2
+			l.skipDict()
+			return token{kind: tokenDict}, true
+		case c == '<':
+			l.pos++
+			return token{kind: tokenString, str: l.hexString()}, true
+		case c == '[':
+			l.pos++
+			return token{kind: tokenArray, array: l.array()}, true
+		case c == ']' || c == '>' || c == ')' || c == '{' || c == '}':
+			// stray delimiters, and PostScript procedures in CMaps, carry no text
+			l.pos++
+			continue
+		}
+
+		w := l.word()
+		if n, err := strconv.ParseFloat(w, 64); err == nil {
+			return token{kind: tokenNumber, num: n, text: w}, true
+		}
+		if w == "ID" {
+			l.skipInlineImage()
+		}
+		return token{kind: tokenOperator, text: w}, true
+	}
+}
+
+func (l *lexer) peek(offset int) byte {
+	if l.pos+offset < len(l.data) {
+		return l.data[l.pos+offset]
+	}
+	return 0
+}
+
+func (l *lexer) word() string {
+	start := l.pos
+	for l.pos < len(l.data) && !isWhite(l.data[l.pos]) && !isDelimiter(l.data[l.pos]) {
+		l.pos++
+	}
+	if l.pos == start && l.pos < len(l.data) {
+		// a delimiter we have no use for, e.g. a lone '%' inside a name
+		l.pos++
+	}
+	return string(l.data[start:l.pos])
+}
+
+// literal reads a (string) after its opening parenthesis, resolving escapes.
+func (l *lexer) literal() []byte {
+	var out []byte
+	depth := 1
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		l.pos++
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			if depth--; depth == 0 {
+				return out
+			}
+		case '\\':
+			if l.pos >= len(l.data) {
+				return out
+			}
+			e := l.data[l.pos]
+			l.pos++
+			switch e {
+			case 'n':
+				c = '\n'
+			case 'r':
+				c = '\r'
+			case 't':
+				c = '\t'
+			case 'b':
+				c = '\b'
+			case 'f':
+				c = '\f'
+			case '\r':
+				if l.peek(0) == '\n' {
+					l.pos++
+				}
+				continue
+			case '\n':
+				continue
+			default:
+				if e >= '0' && e <= '7' {
+					v := int(e - '0')
+					for i := 0; i < 2 && l.pos < len(l.data) && l.data[l.pos] >= '0' && l.data[l.pos] <= '7'; i++ {
+						v = v*8 + int(l.data[l.pos]-'0')
+						l.pos++
+					}
+					c = byte(v)
+				} else {
+					c = e
+				}
+			}
+		}
+		out = append(out, c)
+	}
+	return out
+}
+
+// hexString reads a <hex string> after its opening bracket.
+func (l *lexer) hexString() []byte {
+	end := bytes.IndexByte(l.data[l.pos:], '>')
+	if end < 0 {
+		end = len(l.data) - l.pos
+	}
+	digits := make([]byte, 0, end)
+	for _, c := range l.data[l.pos : l.pos+end] {
+		if !isWhite(c) {
+			digits = append(digits, c)
+		}
+	}
+	l.pos += end + 1
+	if len(digits)%2 == 1 {
+		digits = append(digits, '0')
+	}
+	out := make([]byte, len(digits)/2)
+	n, _ := hex.Decode(out, digits)
+	return out[:n]
+}
+
+func (l *lexer) array() []token {
+	var tokens []token
+	for {
+		l.skipWhite()
+		if l.pos >= len(l.data) {
+			return tokens
+		}
+		if l.data[l.pos] == ']' {
+			l.pos++
+			return tokens
+		}
+		t, ok := l.next()
+		if !ok {
+			return tokens
+		}
+		tokens = append(tokens, t)
+	}
+}
+
+// skipDict skips a <<dictionary>> after its opening brackets, e.g. the properties of a marked content sequence.
+func (l *lexer) skipDict() {
+	depth := 1
+	for l.pos < len(l.data) && depth > 0 {
+		switch {
+		case l.data[l.pos] == '(':
+			l.pos++
+			l.literal()
+			continue
+		case l.data[l.pos] == '<' && l.peek(1) == '<':
+			depth++
+			l.pos++
+		case l.data[l.pos] == '>' && l.peek(1) == '>':
+			depth--
+			l.pos++
+		}
+		l.pos++
+	}
+}
+
+// skipInlineImage skips the binary data of an inline image, up to its EI operator.
+func (l *lexer) skipInlineImage() {
+	for i := l.pos + 1; i+1 < len(l.data); i++ {
+		if l.data[i] == 'E' && l.data[i+1] == 'I' && isWhite(l.data[i-1]) &&
+			(i+2 == len(l.data) || isWhite(l.data[i+2])) {
+			l.pos = i + 2
+			return
+		}
+	}
+	l.pos = len(l.data)
+}
@@ -0,0 +1,279 @@
+// Package pdftext extracts the text layer of PDFs, decoding the text operators of their content streams with pdfcpu.
+// Scans without a text layer yield no text, they need OCR.
+package pdftext
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+
+	"ciascrape/pkg/rag"
+)
+
+var (
+	ErrNotPDF = errors.New("not a PDF")
+	// ErrNoText is returned for PDFs without a text layer, e.g. scans.
+	ErrNoText = errors.New("no text in PDF")
+)
+
+// spaceThreshold is the gap in a TJ array, in thousandths of a text space unit, read as a space between words.
+const spaceThreshold = 200
+
+// Page is the text of a page of a PDF.
+type Page struct {
+	Number int
+	Text   string
+}
+
+func config() *model.Configuration {
+	conf := model.NewDefaultConfiguration()
+	conf.ValidationMode = model.ValidationRelaxed
+	return conf
+}
+
+// IsPDF reports whether data looks like a PDF.
+func IsPDF(data []byte) bool {
+	return bytes.HasPrefix(bytes.TrimLeft(data, "\x00\t\n\r "), []byte("%PDF"))
+}
+
+// Guard runs f, which reads a PDF with pdfcpu, and turns a panic into an error, as pdfcpu panics on
+// some malformed files. Every pdfcpu call on downloaded PDFs should go through it.
+func Guard(f func() error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("failed to read PDF: %v", r)
+		}
+	}()
+	return f()
+}
+
+// readContext parses the PDF in data up to its page tree. Callers run it through Guard.
+func readContext(data []byte) (*model.Context, error) {
+	if !IsPDF(data) {
+		return nil, ErrNotPDF
+	}
+	ctx, err := api.ReadContext(bytes.NewReader(data), config())
+	if err != nil {
+		return nil, fmt.Errorf("failed to read PDF: %w", err)
+	}
+	if err = ctx.EnsurePageCount(); err != nil {
+		return nil, fmt.Errorf("failed to read PDF: %w", err)
+	}
+	return ctx, nil
+}
+
+// Extract returns the text of every page of the PDF in data, including pages without text.
+func Extract(data []byte) ([]Page, error) {
+	var pages []Page
+	err := Guard(func() error {
+		ctx, err := readContext(data)
+		if err != nil {
+			return err
+		}
+		pages = make([]Page, 0, ctx.PageCount)
+		for n := 1; n <= ctx.PageCount; n++ {
+			text, err := pageText(ctx, n)
+			if err != nil {
+				return fmt.Errorf("failed to read page %d: %w", n, err)
+			}
+			pages = append(pages, Page{Number: n, Text: text})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return pages, nil
+}
+
+// Text returns the text of the PDF in data, pages separated by blank lines, or ErrNoText if it has none.
+func Text(data []byte) (string, error) {
+	pages, err := Extract(data)
+	if err != nil {
+		return "", err
+	}
+	texts := make([]string, 0, len(pages))
+	for _, p := range pages {
+		if p.Text != "" {
+			texts = append(texts, p.Text)
+		}
+	}
+	if len(texts) == 0 {
+		return "", ErrNoText
+	}
+	return strings.Join(texts, "\n\n"), nil
+}
+
+// Extractor returns the text of a PDF, or of a text file, for the backends that index text themselves.
+// Files it can't read are rag.ErrUnsupported.
+func Extractor(name string, data []byte) (string, error) {
+	if !IsPDF(data) {
+		if utf8.Valid(data) {
+			return string(data), nil
+		}
+		return "", fmt.Errorf("%w: '%s': %w", rag.ErrUnsupported, name, ErrNotPDF)
+	}
+	text, err := Text(data)
+	if err != nil {
+		return "", fmt.Errorf("%w: '%s': %w", rag.ErrUnsupported, name, err)
+	}
+	return text, nil
+}
+
+func pageText(ctx *model.Context, n int) (string, error) {
+	d, _, inherited, err := ctx.PageDict(n, false)
+	if err != nil {
+		return "", err
+	}
+	content, err := pdfcpu.ExtractPageContent(ctx, n)
+	if err != nil {
+		return "", err
+	}
+	data := &bytes.Buffer{}
+	if _, err = data.ReadFrom(content); err != nil {
+		return "", err
+	}
+
+	resources, _ := ctx.DereferenceDict(d["Resources"])
+	if resources == nil && inherited != nil {
+		resources = inherited.Resources
+	}
+	return textOf(data.Bytes(), pageFonts(ctx, resources)), nil
+}
+
+// textWriter lays out the text shown by a content stream in lines.
+type textWriter struct {
+	lines []string
+	line  strings.Builder
+	y     float64
+	haveY bool
+}
+
+func (w *textWriter) write(s string) {
+	w.line.WriteString(s)
+}
+
+func (w *textWriter) space() {
+	if s := w.line.String(); s != "" && !strings.HasSuffix(s, " ") {
+		w.line.WriteByte(' ')
+	}
+}
+
+func (w *textWriter) newline() {
+	w.lines = append(w.lines, w.line.String())
+	w.line.Reset()
+}
+
+// moveTo starts a new line if y is on another line than the text so far, or a new word if not.
+func (w *textWriter) moveTo(y float64) {
+	if w.haveY && math.Abs(y-w.y) > 1 {
+		w.newline()
+	} else {
+		w.space()
+	}
+	w.y, w.haveY = y, true
+}
+
+func (w *textWriter) String() string {
+	w.newline()
+	lines := make([]string, 0, len(w.lines))
+	for _, line := range w.lines {
+		if line = strings.Join(strings.Fields(line), " "); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// textOf interprets the text operators of a content stream.
+func textOf(content []byte, fonts map[string]*font) string {
+	l := &lexer{data: content}
+	w := &textWriter{}
+	current := simpleFont
+	// lineY is the y of the text line matrix, leading the distance T* moves it by
+	var (
+		operands []token
+		lineY    float64
+		leading  float64
+	)
+
+	show := func(t token) {
+		if t.kind == tokenString {
+			w.write(current.decode(t.str))
+		}
+	}
+	for {
+		t, ok := l.next()
+		if !ok {
+			break
+		}
+		if t.kind != tokenOperator {
+			operands = append(operands, t)
+			continue
+		}
+		n := len(operands)
+		switch t.text {
+		case "Tf":
+			current = simpleFont
+			if n >= 2 && operands[n-2].kind == tokenName {
+				if f, ok := fonts[operands[n-2].text]; ok {
+					current = f
+				}
+			}
+		case "TL":
+			if n >= 1 {
+				leading = operands[n-1].num
+			}
+		case "Td", "TD":
+			if n >= 2 {
+				lineY += operands[n-1].num
+				if t.text == "TD" {
+					leading = -operands[n-1].num
+				}
+				w.moveTo(lineY)
+			}
+		case "Tm":
+			if n >= 6 {
+				lineY = operands[n-1].num
+				w.moveTo(lineY)
+			}
+		case "T*":
+			lineY -= leading
+			w.newline()
+			w.y, w.haveY = lineY, true
+		case "Tj":
+			if n >= 1 {
+				show(operands[n-1])
+			}
+		case "'", "\"":
+			lineY -= leading
+			w.newline()
+			w.y, w.haveY = lineY, true
+			if n >= 1 {
+				show(operands[n-1])
+			}
+		case "TJ":
+			if n >= 1 {
+				for _, e := range operands[n-1].array {
+					if e.kind == tokenNumber && e.num < -spaceThreshold {
+						w.space()
+					}
+					show(e)
+				}
+			}
+		case "BT":
+			lineY = 0
+		case "ET":
+			w.space()
+		}
+		operands = operands[:0]
+	}
+	return w.String()
+}
@@ -0,0 +1,143 @@
+package pdftext
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"ciascrape/internal/pdftest"
+	"ciascrape/pkg/rag"
+)
+
+const toUnicode = `/CIDInit /ProcSet findresource begin
+12 dict begin
+begincmap
+1 begincodespacerange
+<0000> <FFFF>
+endcodespacerange
+2 beginbfchar
+<0001> <0053>
+<0002> <0054>
+endbfchar
+1 beginbfrange
+<0010> <0012> <0041>
+endbfrange
+1 beginbfrange
+<0020> <0021> [<0047> <0045>]
+endbfrange
+endcmap
+CMapName currentdict /CMap defineresource pop
+end
+end`
+
+func testPDF() []byte {
+	page1 := `BT /F1 12 Tf 72 720 Td (TASK FORCE) Tj 0 -14 Td [(remote) -300 (vie) 20 (wing)] TJ 14 TL T* (of Soviet \(naval\) facilities\222) Tj ET
+BT /F1 12 Tf 1 0 0 1 72 680 Tm (MEMORANDUM) Tj 1 0 0 1 200 680 Tm (FOR) Tj ET
+/Span << /ActualText (ignored) >> BDC BI /W 1 /H 1 /BPC 8 /CS /G ID ` + "\x00EI\x01" + ` EI EMC`
+	page2 := `BT /F2 10 Tf 72 700 Td <00010002> Tj [-400 <0010001100120020 0021>] TJ ET`
+	page3 := `q 100 0 0 100 0 0 cm Q`
+
+	return pdftest.Build(
+		`<< /Type /Catalog /Pages 2 0 R >>`,
+		`<< /Type /Pages /Kids [3 0 R 4 0 R 5 0 R] /Count 3 /Resources << /Font << /F1 9 0 R >> >> >>`,
+		`<< /Type /Page /Parent 2 0 R /MediaBox [0 0 612 792] /Contents 6 0 R >>`,
+		`<< /Type /Page /Parent 2 0 R /MediaBox [0 0 612 792] /Contents 7 0 R /Resources << /Font << /F2 10 0 R >> >> >>`,
+		`<< /Type /Page /Parent 2 0 R /MediaBox [0 0 612 792] /Contents 8 0 R >>`,
+		pdftest.Stream("", []byte(page1)),
+		pdftest.Stream("/Filter /FlateDecode", pdftest.Deflate(page2)),
+		pdftest.Stream("", []byte(page3)),
+		`<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>`,
+		`<< /Type /Font /Subtype /Type0 /BaseFont /Courier /Encoding /Identity-H /DescendantFonts [] /ToUnicode 11 0 R >>`,
+		pdftest.Stream("", []byte(toUnicode)),
+	)
+}
+
+func TestExtract(t *testing.T) {
+	pages, err := Extract(testPDF())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pages) != 3 {
+		t.Fatalf("expected 3 pages, got %d", len(pages))
+	}
+	want := []string{
+		"TASK FORCE\nremote viewing\nof Soviet (naval) facilities'\nMEMORANDUM FOR",
+		"ST ABCGE",
+		"",
+	}
+	for i, p := range pages {
+		if p.Number != i+1 || p.Text != want[i] {
+			t.Errorf("page %d: expected %q, got %q", i+1, want[i], p.Text)
+		}
+	}
+
+	if _, err = Extract([]byte("Access Denied")); !errors.Is(err, ErrNotPDF) {
+		t.Errorf("expected %v, got %v", ErrNotPDF, err)
+	}
+	if _, err = Extract([]byte("%PDF-1.4\ngarbage")); err == nil {
+		t.Error("expected an error for a broken PDF")
+	}
+}
+
+func TestExtractor(t *testing.T) {
+	text, err := Extractor("doc.pdf", testPDF())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(text, "TASK FORCE\n") || !strings.HasSuffix(text, "MEMORANDUM FOR\n\nST ABCGE") {
+		t.Errorf("unexpected text: %q", text)
+	}
+
+	scan := pdftest.Build(
+		`<< /Type /Catalog /Pages 2 0 R >>`,
+		`<< /Type /Pages /Kids [3 0 R] /Count 1 >>`,
+		`<< /Type /Page /Parent 2 0 R /MediaBox [0 0 612 792] /Contents 4 0 R >>`,
+		pdftest.Stream("", []byte("q 612 0 0 792 0 0 cm Q")),
+	)
+	if _, err = Extractor("scan.pdf", scan); !errors.Is(err, ErrNoText) || !errors.Is(err, rag.ErrUnsupported) {
+		t.Errorf("expected %v and %v, got %v", ErrNoText, rag.ErrUnsupported, err)
+	}
+	if text, err = Extractor("doc.txt", []byte("TASK FORCE")); err != nil || text != "TASK FORCE" {
+		t.Errorf("expected text files to pass through, got %q, %v", text, err)
+	}
+	if _, err = Extractor("doc.bin", []byte{0xff, 0xfe, 0x00}); !errors.Is(err, rag.ErrUnsupported) {
+		t.Errorf("expected %v, got %v", rag.ErrUnsupported, err)
+	}
+}
+
+func TestReadInfo(t *testing.T) {
+	data := pdftest.BuildTrailer("/Info 5 0 R",
+		`<< /Type /Catalog /Pages 2 0 R >>`,
+		`<< /Type /Pages /Kids [3 0 R 4 0 R] /Count 2 >>`,
+		`<< /Type /Page /Parent 2 0 R /MediaBox [0 0 612 792] >>`,
+		`<< /Type /Page /Parent 2 0 R /MediaBox [0 0 612 792] >>`,
+		`<< /Title (TASK FORCE) /Author <FEFF0043004900410020> /Producer (Adobe Acrobat 9.0 Paper Capture Plug-in)
+		/CreationDate (D:20000808153045-04'00') /ModDate (garbage) >>`,
+	)
+	info, err := ReadInfo(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Title != "TASK FORCE" || info.Author != "CIA" || info.Producer != "Adobe Acrobat 9.0 Paper Capture Plug-in" || info.PageCount != 2 {
+		t.Errorf("unexpected info: %+v", info)
+	}
+	if want := time.Date(2000, 8, 8, 19, 30, 45, 0, time.UTC); !info.Created.Equal(want) {
+		t.Errorf("expected creation date %v, got %v", want, info.Created)
+	}
+	if !info.Modified.IsZero() {
+		t.Errorf("expected an unparsable date to be zero, got %v", info.Modified)
+	}
+
+	// PDFs without an information dictionary still have a page count
+	if info, err = ReadInfo(pdftest.Build(
+		`<< /Type /Catalog /Pages 2 0 R >>`,
+		`<< /Type /Pages /Kids [3 0 R] /Count 1 >>`,
+		`<< /Type /Page /Parent 2 0 R /MediaBox [0 0 612 792] >>`,
+	)); err != nil || info.PageCount != 1 || info.Title != "" {
+		t.Errorf("unexpected info %+v, %v", info, err)
+	}
+	if _, err = ReadInfo([]byte("<html>")); !errors.Is(err, ErrNotPDF) {
+		t.Errorf("expected %v, got %v", ErrNotPDF, err)
+	}
+}
@@ -0,0 +1,82 @@
+// Package rag defines what the scraper needs from a RAG store, so the same crawl can feed different ones.
+package rag
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"unicode/utf8"
+
+	"ciascrape/pkg/cia"
+)
+
+// ReadingRoomSource is the source backends credit the scraped documents to.
+const ReadingRoomSource = "CIA FOIA Electronic Reading Room"
+
+var (
+	// ErrDuplicate is returned when uploading a document the backend already has.
+	ErrDuplicate = errors.New("already seen link")
+	// ErrAccessDenied is returned when what was uploaded turned out to be a throttle or maintenance page.
+	ErrAccessDenied = errors.New("access denied")
+	// ErrUnsupported is returned by backends that can't do something, e.g. fetch links themselves.
+	ErrUnsupported = errors.New("not supported by backend")
+)
+
+// Document is a document stored in a backend.
+type Document struct {
+	ID string
+	// Location is where the backend keeps the document, e.g. its path or file ID.
+	Location string
+	URL      string
+	Title    string
+	// Parts are the further documents the source was stored as, e.g. the page ranges of a split PDF.
+	// Attach and Delete apply to them along with the document.
+	Parts []*Document
+}
+
+// Backend is a RAG store the scraped documents are uploaded to and attached to a collection
+// (an AnythingLLM workspace, an Open WebUI knowledge base, ...) of.
+type Backend interface {
+	// Name identifies the backend in logs.
+	Name() string
+	// Validate checks the backend can be used, creates the collection if it is missing
+	// and lists the documents already stored, for Seen.
+	Validate() error
+	// Seen reports whether the document at url is already stored.
+	Seen(url string) bool
+
+	// UploadText uploads a document fetched from the reading room as text with its metadata.
+	UploadText(doc *cia.Document) (*Document, error)
+	// UploadFile uploads a file, e.g. a PDF, downloaded from url.
+	UploadFile(url, name string, data []byte) (*Document, error)
+	// UploadLink has the backend fetch url itself, or returns ErrUnsupported.
+	UploadLink(url string) (*Document, error)
+
+	// Attach adds documents to the collection. It may batch them until Flush.
+	Attach(docs ...*Document) error
+	// Delete removes documents from the backend.
+	Delete(docs ...*Document) error
+
+	// Flush finishes attaching documents, until ctx is done.
+	Flush(ctx context.Context) error
+	Close() error
+}
+
+// IsAccessDenied reports whether doc is the reading room's throttle or maintenance page rather than a document,
+// which backends refuse to upload with ErrAccessDenied.
+func IsAccessDenied(doc *cia.Document) bool {
+	return cia.IsAccessDenied(doc.Title) || cia.IsAccessDenied(doc.Body)
+}
+
+// Extractor returns the text of a file, e.g. a PDF, or ErrUnsupported if it can't.
+// It is used by the backends that index text themselves.
+type Extractor func(name string, data []byte) (string, error)
+
+// PlainText is the default Extractor, which only takes text files.
+func PlainText(name string, data []byte) (string, error) {
+	if bytes.HasPrefix(data, []byte("%PDF")) || !utf8.Valid(data) {
+		return "", fmt.Errorf("%w: no text extractor for '%s'", ErrUnsupported, name)
+	}
+	return string(data), nil
+}
@@ -0,0 +1,107 @@
+package rotate
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// FIFO rotates by writing to a named pipe that an external script (see mullvad_switch.sh) reads from.
+// If an acknowledgement pipe is set, Rotate waits until the script writes a line to it.
+type FIFO struct {
+	trigger string
+	ack     string
+}
+
+func NewFIFO(trigger string) *FIFO {
+	return &FIFO{trigger: trigger}
+}
+
+// WithAck waits for a line on the named pipe at path after every trigger.
+func (f *FIFO) WithAck(path string) *FIFO {
+	f.ack = path
+	return f
+}
+
+func ensureFIFO(path string) error {
+	_, err := os.Stat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		err = syscall.Mkfifo(path, 0644)
+	}
+	return err
+}
+
+// openFIFO opens a named pipe, which blocks until the other end is opened too, unless ctx is done first.
+func openFIFO(ctx context.Context, path string, flag int) (*os.File, error) {
+	type result struct {
+		f   *os.File
+		err error
+	}
+	ch := make(chan result, 1)
+	go func() {
+		f, err := os.OpenFile(path, flag, os.ModeNamedPipe)
+		ch <- result{f, err}
+	}()
+	select {
+	case res := <-ch:
+		return res.f, res.err
+	case <-ctx.Done():
+		go func() {
+			if res := <-ch; res.f != nil {
+				_ = res.f.Close()
+			}
+		}()
+		return nil, ctx.Err()
+	}
+}
+
+func (f *FIFO) Rotate(ctx context.Context) error {
+	for _, path := range []string{f.trigger, f.ack} {
+		if path == "" {
+			continue
+		}
+		if err := ensureFIFO(path); err != nil {
+			return fmt.Errorf("%w: fifo '%s': %v", ErrRotationFailed, path, err)
+		}
+	}
+
+	w, err := openFIFO(ctx, f.trigger, os.O_WRONLY)
+	if err != nil {
+		return fmt.Errorf("%w: fifo open error: %v", ErrRotationFailed, err)
+	}
+	_, err = w.Write([]byte("x"))
+	_ = w.Close()
+	if err != nil {
+		return fmt.Errorf("%w: fifo write error: %v", ErrRotationFailed, err)
+	}
+
+	if f.ack == "" {
+		return nil
+	}
+
+	r, err := openFIFO(ctx, f.ack, os.O_RDONLY)
+	if err != nil {
+		return fmt.Errorf("%w: fifo open error: %v", ErrRotationFailed, err)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := bufio.NewReader(r).ReadString('\n')
+		done <- err
+	}()
+
+	select {
+	case err = <-done:
+		_ = r.Close()
+		if err != nil {
+			return fmt.Errorf("%w: fifo read error: %v", ErrRotationFailed, err)
+		}
+		return nil
+	case <-ctx.Done():
+		_ = r.Close()
+		return ctx.Err()
+	}
+}
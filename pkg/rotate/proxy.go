@@ -0,0 +1,52 @@
+package rotate
+
+import (
+	"context"
+	"log"
+	"net/url"
+	"strings"
+	"sync"
+
+	http2 "ciascrape/pkg/http"
+)
+
+// ProxyList rotates by switching to the next proxy of a list, wrapping around at the end.
+// set is called with the proxy to use from now on, e.g. http.Client.WithProxy.
+type ProxyList struct {
+	proxies []*url.URL
+	set     func(*url.URL)
+	next    int
+	mu      sync.Mutex
+}
+
+// NewProxyList parses proxies (http://, https:// or socks5:// URLs) and switches to the first one right away.
+func NewProxyList(set func(*url.URL), proxies ...string) (*ProxyList, error) {
+	p := &ProxyList{set: set}
+	for _, proxy := range proxies {
+		proxy = strings.TrimSpace(proxy)
+		if proxy == "" {
+			continue
+		}
+		u, err := http2.ParseProxy(proxy)
+		if err != nil {
+			return nil, err
+		}
+		p.proxies = append(p.proxies, u)
+	}
+	if len(p.proxies) == 0 {
+		return nil, http2.ErrNoProxies
+	}
+	_ = p.Rotate(context.Background())
+	return p, nil
+}
+
+func (p *ProxyList) Rotate(_ context.Context) error {
+	p.mu.Lock()
+	proxy := p.proxies[p.next]
+	p.next = (p.next + 1) % len(p.proxies)
+	p.mu.Unlock()
+
+	p.set(proxy)
+	log.Printf("[rotate] using proxy %s", proxy.Redacted())
+	return nil
+}
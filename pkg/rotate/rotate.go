@@ -0,0 +1,147 @@
+package rotate
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"ciascrape/pkg/mu"
+)
+
+const DefaultTimeout = 2 * time.Minute
+
+var ErrRotationFailed = errors.New("rotation failed")
+
+// Rotator changes the address our traffic to the reading room leaves from, e.g. by switching VPN relays.
+// Rotate returns once the new address is usable, or with an error if it is not.
+type Rotator interface {
+	Rotate(ctx context.Context) error
+}
+
+// Command rotates by running a shell command, e.g. "mullvad relay set location se && mullvad reconnect --wait".
+type Command struct {
+	command string
+}
+
+func NewCommand(command string) *Command {
+	return &Command{command: strings.TrimSpace(command)}
+}
+
+func (c *Command) Rotate(ctx context.Context) error {
+	out, err := exec.CommandContext(ctx, "sh", "-c", c.command).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%w: '%s': %v: %s", ErrRotationFailed, c.command, err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// Webhook rotates by POSTing to a URL. The endpoint is expected to answer once the rotation is done.
+type Webhook struct {
+	url    string
+	client *http.Client
+}
+
+func NewWebhook(url string) *Webhook {
+	return &Webhook{url: strings.TrimSpace(url), client: &http.Client{}}
+}
+
+func (w *Webhook) Rotate(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, strings.NewReader(`{"event":"throttled"}`))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := w.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrRotationFailed, err)
+	}
+	defer func() {
+		_ = res.Body.Close()
+	}()
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		body, _ := io.ReadAll(io.LimitReader(res.Body, 512))
+		return fmt.Errorf("%w: webhook returned %s: %s", ErrRotationFailed, res.Status, bytes.TrimSpace(body))
+	}
+	return nil
+}
+
+type rotation struct {
+	done chan struct{}
+	err  error
+}
+
+// Rotation runs a Rotator on behalf of every part of the scraper that notices throttling.
+// While a rotation is in progress the global "net" lock is held, so no request leaves from the old address,
+// and callers noticing the same throttling wait for that rotation instead of starting another.
+// A nil *Rotation or one without a Rotator does nothing.
+type Rotation struct {
+	rotator Rotator
+	timeout time.Duration
+	current *rotation
+	mu      sync.Mutex
+}
+
+func NewRotation(r Rotator) *Rotation {
+	return &Rotation{rotator: r, timeout: DefaultTimeout}
+}
+
+// WithTimeout limits how long a single rotation may take.
+func (r *Rotation) WithTimeout(timeout time.Duration) *Rotation {
+	if timeout > 0 {
+		r.timeout = timeout
+	}
+	return r
+}
+
+// Rotate rotates and blocks until the rotation is done. Callers must not hold the "net" lock.
+func (r *Rotation) Rotate(ctx context.Context) error {
+	if r == nil || r.rotator == nil {
+		return nil
+	}
+
+	r.mu.Lock()
+	if current := r.current; current != nil {
+		r.mu.Unlock()
+		select {
+		case <-current.done:
+			return current.err
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	current := &rotation{done: make(chan struct{})}
+	r.current = current
+	r.mu.Unlock()
+
+	log.Printf("[rotate] rotating address...")
+
+	net := mu.GetMutex("net")
+	net.Lock()
+	rctx, cancel := context.WithTimeout(ctx, r.timeout)
+	current.err = r.rotator.Rotate(rctx)
+	cancel()
+	net.Unlock()
+
+	if current.err != nil {
+		log.Printf("[err][rotate] %v", current.err)
+	} else {
+		log.Printf("[rotate] address rotated")
+	}
+
+	r.mu.Lock()
+	r.current = nil
+	r.mu.Unlock()
+	close(current.done)
+
+	return current.err
+}
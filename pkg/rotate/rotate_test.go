@@ -0,0 +1,166 @@
+package rotate
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	http2 "ciascrape/pkg/http"
+)
+
+type countingRotator struct {
+	calls atomic.Int32
+	delay time.Duration
+}
+
+func (c *countingRotator) Rotate(ctx context.Context) error {
+	c.calls.Add(1)
+	time.Sleep(c.delay)
+	return nil
+}
+
+func TestCommand_Rotate(t *testing.T) {
+	if err := NewCommand("true").Rotate(context.Background()); err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+	if err := NewCommand("echo nope; false").Rotate(context.Background()); !errors.Is(err, ErrRotationFailed) {
+		t.Errorf("expected %v, got %v", ErrRotationFailed, err)
+	}
+}
+
+func TestWebhook_Rotate(t *testing.T) {
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		if r.URL.Path == "/fail" {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer server.Close()
+
+	if err := NewWebhook(server.URL + "/rotate").Rotate(context.Background()); err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+	if err := NewWebhook(server.URL + "/fail").Rotate(context.Background()); !errors.Is(err, ErrRotationFailed) {
+		t.Errorf("expected %v, got %v", ErrRotationFailed, err)
+	}
+	if calls != 2 {
+		t.Errorf("expected 2 webhook calls, got %d", calls)
+	}
+}
+
+func TestFIFO_RotateWaitsForAck(t *testing.T) {
+	dir := t.TempDir()
+	trigger, ack := filepath.Join(dir, "trigger"), filepath.Join(dir, "ack")
+	for _, path := range []string{trigger, ack} {
+		if err := ensureFIFO(path); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	}
+
+	// stand-in for mullvad_switch.sh
+	acked := make(chan struct{})
+	go func() {
+		f, err := os.Open(trigger)
+		if err != nil {
+			t.Errorf("expected no error, got %v", err)
+			return
+		}
+		_, _ = bufio.NewReader(f).ReadString('\n')
+		_ = f.Close()
+		time.Sleep(50 * time.Millisecond)
+		close(acked)
+		if err = os.WriteFile(ack, []byte("done\n"), 0644); err != nil {
+			t.Errorf("expected no error, got %v", err)
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := NewFIFO(trigger).WithAck(ack).Rotate(ctx); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	select {
+	case <-acked:
+	default:
+		t.Errorf("expected Rotate to wait for the acknowledgement")
+	}
+}
+
+func TestFIFO_RotateTimesOutWithoutReader(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err := NewFIFO(filepath.Join(t.TempDir(), "trigger")).Rotate(ctx)
+	if !errors.Is(err, ErrRotationFailed) {
+		t.Errorf("expected %v, got %v", ErrRotationFailed, err)
+	}
+}
+
+func TestProxyList_Cycles(t *testing.T) {
+	var used []string
+	p, err := NewProxyList(func(u *url.URL) { used = append(used, u.String()) },
+		"http://127.0.0.1:8080", " socks5://127.0.0.1:1080 ")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	_ = p.Rotate(context.Background())
+	_ = p.Rotate(context.Background())
+
+	expected := []string{"http://127.0.0.1:8080", "socks5://127.0.0.1:1080", "http://127.0.0.1:8080"}
+	if len(used) != len(expected) {
+		t.Fatalf("expected %v, got %v", expected, used)
+	}
+	for i := range expected {
+		if used[i] != expected[i] {
+			t.Errorf("expected %v, got %v", expected, used)
+		}
+	}
+
+	if _, err = NewProxyList(func(*url.URL) {}, "ftp://127.0.0.1"); err == nil {
+		t.Errorf("expected error for unsupported scheme, got nil")
+	}
+	if _, err = NewProxyList(func(*url.URL) {}); !errors.Is(err, http2.ErrNoProxies) {
+		t.Errorf("expected %v, got %v", http2.ErrNoProxies, err)
+	}
+}
+
+func TestRotation_CoalescesConcurrentCalls(t *testing.T) {
+	rotator := &countingRotator{delay: 100 * time.Millisecond}
+	rotation := NewRotation(rotator)
+
+	wg := &sync.WaitGroup{}
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := rotation.Rotate(context.Background()); err != nil {
+				t.Errorf("expected no error, got %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if calls := rotator.calls.Load(); calls != 1 {
+		t.Errorf("expected 1 rotation, got %d", calls)
+	}
+}
+
+func TestRotation_NilDoesNothing(t *testing.T) {
+	var rotation *Rotation
+	if err := rotation.Rotate(context.Background()); err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+}
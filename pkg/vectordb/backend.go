@@ -0,0 +1,200 @@
+package vectordb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+
+	"ciascrape/pkg/cia"
+	"ciascrape/pkg/rag"
+)
+
+// Backend chunks and embeds documents locally and upserts them into a Store. Documents are searchable
+// as soon as they are uploaded, so attaching them does nothing.
+type Backend struct {
+	store      Store
+	embedder   *Embedder
+	collection string
+	chunkSize  int
+	overlap    int
+	extract    rag.Extractor
+	seen       map[string]string
+	mu         sync.RWMutex
+}
+
+var _ rag.Backend = (*Backend)(nil)
+
+func NewBackend(store Store, embedder *Embedder, collection string) *Backend {
+	return &Backend{
+		store:      store,
+		embedder:   embedder,
+		collection: collection,
+		chunkSize:  DefaultChunkSize,
+		overlap:    DefaultChunkOverlap,
+		extract:    rag.PlainText,
+		seen:       make(map[string]string),
+	}
+}
+
+// WithChunking sets the size of the chunks documents are split into and how much consecutive chunks overlap, in characters.
+func (b *Backend) WithChunking(size, overlap int) *Backend {
+	if size > 0 {
+		b.chunkSize = size
+	}
+	if overlap >= 0 {
+		b.overlap = overlap
+	}
+	return b
+}
+
+// WithExtractor sets how the text of uploaded files is read.
+func (b *Backend) WithExtractor(extract rag.Extractor) *Backend {
+	if extract != nil {
+		b.extract = extract
+	}
+	return b
+}
+
+func (b *Backend) Name() string {
+	return b.store.Name()
+}
+
+// Validate checks the embeddings endpoint, creates the collection for the size of its vectors if need be,
+// and lists the documents already in it.
+func (b *Backend) Validate() error {
+	if strings.TrimSpace(b.collection) == "" {
+		return errors.New("missing collection")
+	}
+	probe, err := b.embedder.Embed([]string{"CIA FOIA Electronic Reading Room"})
+	if err != nil {
+		return err
+	}
+	if len(probe[0]) == 0 {
+		return fmt.Errorf("%w: empty embedding", ErrEmbeddings)
+	}
+	if err = b.store.Ensure(b.collection, len(probe[0])); err != nil {
+		return err
+	}
+	docs, err := b.store.Documents(b.collection)
+	if err != nil {
+		return err
+	}
+	b.mu.Lock()
+	for url, id := range docs {
+		b.seen[url] = id
+	}
+	b.mu.Unlock()
+	log.Printf("total existing documents in %s collection '%s' observed for dedupe purposes: %d", b.Name(), b.collection, len(docs))
+	return nil
+}
+
+func (b *Backend) Seen(url string) bool {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	_, ok := b.seen[url]
+	return ok
+}
+
+// put chunks and embeds text and upserts it with the metadata of payload.
+func (b *Backend) put(text string, payload Payload) (*rag.Document, error) {
+	if b.Seen(payload.URL) {
+		return nil, rag.ErrDuplicate
+	}
+	chunks := Chunk(text, b.chunkSize, b.overlap)
+	if len(chunks) == 0 {
+		return nil, fmt.Errorf("no text in '%s'", payload.URL)
+	}
+	vectors, err := b.embedder.Embed(chunks)
+	if err != nil {
+		return nil, err
+	}
+
+	payload.DocID = uuidFor(payload.URL)
+	payload.Source = rag.ReadingRoomSource
+	points := make([]Point, 0, len(chunks))
+	for i, chunk := range chunks {
+		p := payload
+		p.Chunk, p.Text = i, chunk
+		points = append(points, Point{ID: uuidFor(fmt.Sprintf("%s#%d", payload.URL, i)), Vector: vectors[i], Payload: p})
+	}
+	// a document uploaded again may have had more chunks
+	if err = b.store.Delete(b.collection, payload.DocID); err != nil {
+		return nil, err
+	}
+	if err = b.store.Upsert(b.collection, points); err != nil {
+		return nil, err
+	}
+
+	b.mu.Lock()
+	b.seen[payload.URL] = payload.DocID
+	b.mu.Unlock()
+
+	return &rag.Document{ID: payload.DocID, Location: payload.DocID, URL: payload.URL, Title: payload.Title}, nil
+}
+
+func (b *Backend) UploadText(doc *cia.Document) (*rag.Document, error) {
+	if rag.IsAccessDenied(doc) {
+		return nil, rag.ErrAccessDenied
+	}
+	published := doc.PublicationDate
+	if published == "" {
+		published = doc.ReleaseDate
+	}
+	return b.put(doc.Text(), Payload{
+		URL:            doc.URL,
+		Title:          doc.Title,
+		DocumentNumber: doc.DocumentNumber,
+		DocumentType:   doc.DocumentType,
+		Collection:     doc.Collection,
+		Published:      published,
+		Classification: doc.OriginalClassification,
+		Fields:         doc.Fields,
+	})
+}
+
+func (b *Backend) UploadFile(url, name string, data []byte) (*rag.Document, error) {
+	if b.Seen(url) {
+		return nil, rag.ErrDuplicate
+	}
+	text, err := b.extract(name, data)
+	if err != nil {
+		return nil, err
+	}
+	return b.put(text, Payload{URL: url, Title: name})
+}
+
+// UploadLink is not supported, only what we fetched ourselves is embedded.
+func (b *Backend) UploadLink(string) (*rag.Document, error) {
+	return nil, rag.ErrUnsupported
+}
+
+// Attach does nothing, documents are in the collection once uploaded.
+func (b *Backend) Attach(...*rag.Document) error {
+	return nil
+}
+
+func (b *Backend) Delete(docs ...*rag.Document) error {
+	for _, doc := range docs {
+		if doc == nil || doc.ID == "" {
+			continue
+		}
+		if err := b.store.Delete(b.collection, doc.ID); err != nil {
+			return err
+		}
+		b.mu.Lock()
+		delete(b.seen, doc.URL)
+		b.mu.Unlock()
+	}
+	return nil
+}
+
+func (b *Backend) Flush(context.Context) error {
+	return nil
+}
+
+func (b *Backend) Close() error {
+	return nil
+}
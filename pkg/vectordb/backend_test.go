@@ -0,0 +1,279 @@
+package vectordb
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"ciascrape/pkg/cia"
+	"ciascrape/pkg/rag"
+)
+
+// fakeVectors keeps the points of a single collection for the fake stores.
+type fakeVectors struct {
+	exists bool
+	dim    int
+	points map[string]map[string]interface{}
+	texts  map[string]string
+	mu     sync.Mutex
+}
+
+func newFakeVectors() *fakeVectors {
+	existing := map[string]interface{}{"doc_id": "doc-0", "url": "https://www.cia.gov/readingroom/document/doc-0", "chunk": 0}
+	return &fakeVectors{
+		points: map[string]map[string]interface{}{"point-0": existing},
+		texts:  map[string]string{"point-0": "already here"},
+	}
+}
+
+func (f *fakeVectors) deleteDoc(docID string) {
+	for id, payload := range f.points {
+		if payload["doc_id"] == docID {
+			delete(f.points, id)
+			delete(f.texts, id)
+		}
+	}
+}
+
+func (f *fakeVectors) chunks(docID string) []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	texts := make([]string, 0)
+	for i := 0; ; i++ {
+		found := false
+		for id, payload := range f.points {
+			if payload["doc_id"] == docID && payload["chunk"] == float64(i) {
+				texts, found = append(texts, f.texts[id]), true
+			}
+		}
+		if !found {
+			return texts
+		}
+	}
+}
+
+// fakeQdrant is a minimal stand-in for the Qdrant REST API, holding the collection "stargate".
+func fakeQdrant(t *testing.T, f *fakeVectors) Store {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("api-key") != "testKey" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		req := map[string]interface{}{}
+		_ = json.NewDecoder(r.Body).Decode(&req)
+
+		path := strings.TrimPrefix(r.URL.Path, "/collections/stargate")
+		switch {
+		case path == r.URL.Path:
+			w.WriteHeader(http.StatusNotFound)
+		case path == "" && r.Method == http.MethodGet:
+			if !f.exists {
+				w.WriteHeader(http.StatusNotFound)
+				_, _ = w.Write([]byte(`{"status": {"error": "Not found: Collection stargate doesn't exist!"}}`))
+				return
+			}
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{
+				"result": map[string]interface{}{"config": map[string]interface{}{"params": map[string]interface{}{
+					"vectors": map[string]interface{}{"size": f.dim, "distance": "Cosine"},
+				}}},
+			})
+		case path == "" && r.Method == http.MethodPut:
+			f.exists = true
+			f.dim = int(req["vectors"].(map[string]interface{})["size"].(float64))
+			_, _ = w.Write([]byte(`{"result": true}`))
+		case !f.exists:
+			w.WriteHeader(http.StatusNotFound)
+		case path == "/points" && r.Method == http.MethodPut:
+			for _, p := range req["points"].([]interface{}) {
+				point := p.(map[string]interface{})
+				id, payload := point["id"].(string), point["payload"].(map[string]interface{})
+				if len(point["vector"].([]interface{})) != f.dim {
+					w.WriteHeader(http.StatusBadRequest)
+					return
+				}
+				f.points[id], f.texts[id] = payload, payload["text"].(string)
+			}
+			_, _ = w.Write([]byte(`{"result": {"status": "completed"}}`))
+		case path == "/points/delete":
+			must := req["filter"].(map[string]interface{})["must"].([]interface{})[0].(map[string]interface{})
+			f.deleteDoc(must["match"].(map[string]interface{})["value"].(string))
+			_, _ = w.Write([]byte(`{"result": {"status": "completed"}}`))
+		case path == "/points/scroll":
+			// one point per page, to exercise paging
+			var points []map[string]interface{}
+			for id, payload := range f.points {
+				points = append(points, map[string]interface{}{"id": id, "payload": payload})
+			}
+			start := 0
+			if offset, ok := req["offset"].(float64); ok {
+				start = int(offset)
+			}
+			page := map[string]interface{}{"points": points[start:min(start+1, len(points))], "next_page_offset": nil}
+			if start+1 < len(points) {
+				page["next_page_offset"] = start + 1
+			}
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{"result": page})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return NewQdrant(server.URL).WithAPIKey("testKey")
+}
+
+// fakeChroma is a minimal stand-in for the Chroma v1 REST API, holding the collection "stargate".
+func fakeChroma(t *testing.T, f *fakeVectors) Store {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Chroma-Token") != "testKey" || r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		req := map[string]interface{}{}
+		_ = json.NewDecoder(r.Body).Decode(&req)
+
+		switch r.URL.Path {
+		case "/api/v1/collections":
+			if req["name"] != "stargate" || req["get_or_create"] != true {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			f.exists = true
+			_, _ = w.Write([]byte(`{"id": "c-1", "name": "stargate"}`))
+		case "/api/v1/collections/c-1/upsert":
+			ids := req["ids"].([]interface{})
+			for i, id := range ids {
+				f.points[id.(string)] = req["metadatas"].([]interface{})[i].(map[string]interface{})
+				f.texts[id.(string)] = req["documents"].([]interface{})[i].(string)
+			}
+			_, _ = w.Write([]byte(`true`))
+		case "/api/v1/collections/c-1/delete":
+			f.deleteDoc(req["where"].(map[string]interface{})["doc_id"].(string))
+			_, _ = w.Write([]byte(`[]`))
+		case "/api/v1/collections/c-1/get":
+			page := map[string][]interface{}{"ids": {}, "metadatas": {}}
+			for id, payload := range f.points {
+				page["ids"] = append(page["ids"], id)
+				page["metadatas"] = append(page["metadatas"], payload)
+			}
+			_ = json.NewEncoder(w).Encode(page)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return NewChroma(server.URL).WithAPIKey("testKey")
+}
+
+func TestBackend_UploadDelete(t *testing.T) {
+	for name, newStore := range map[string]func(*testing.T, *fakeVectors) Store{
+		"qdrant": fakeQdrant,
+		"chroma": fakeChroma,
+	} {
+		t.Run(name, func(t *testing.T) {
+			f := newFakeVectors()
+			embeddings := fakeEmbeddings(t, nil)
+			var backend rag.Backend = NewBackend(newStore(t, f), NewEmbedder(embeddings.URL+"/v1/", ""), "stargate").WithChunking(40, 10)
+			if backend.Name() != name {
+				t.Errorf("expected name %q, got %q", name, backend.Name())
+			}
+			if err := backend.Validate(); err != nil {
+				t.Fatal(err)
+			}
+			if !f.exists {
+				t.Fatal("expected the collection to be created")
+			}
+			if !backend.Seen("https://www.cia.gov/readingroom/document/doc-0") {
+				t.Error("expected the document already in the collection to be seen")
+			}
+
+			doc := &cia.Document{
+				URL:                    "https://www.cia.gov/readingroom/document/doc-1",
+				Title:                  "(TAB A) TASK FORCE",
+				DocumentNumber:         "CIA-RDP96-00788R001200410003-2",
+				OriginalClassification: "S",
+				ReleaseDate:            "December 4, 1998",
+				Body:                   "TASK FORCE on the remote viewing of the Soviet facilities, as tasked by the director.",
+			}
+			text, err := backend.UploadText(doc)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err = backend.UploadText(doc); !errors.Is(err, rag.ErrDuplicate) {
+				t.Errorf("expected %v, got %v", rag.ErrDuplicate, err)
+			}
+			if text.ID != uuidFor(doc.URL) || text.URL != doc.URL || text.Title != doc.Title {
+				t.Errorf("unexpected document: %+v", text)
+			}
+			chunks := f.chunks(text.ID)
+			if len(chunks) < 2 || !strings.Contains(strings.Join(chunks, " "), "remote viewing") {
+				t.Errorf("unexpected chunks: %q", chunks)
+			}
+			payload := f.points[uuidFor(doc.URL+"#0")]
+			if payload["document_number"] != doc.DocumentNumber || payload["classification"] != "S" ||
+				payload["published"] != doc.ReleaseDate || payload["source"] != rag.ReadingRoomSource {
+				t.Errorf("unexpected payload: %v", payload)
+			}
+
+			if _, err = backend.UploadFile("https://www.cia.gov/readingroom/docs/doc-1.pdf", "doc-1.pdf", []byte("%PDF-1.4")); !errors.Is(err, rag.ErrUnsupported) {
+				t.Errorf("expected %v, got %v", rag.ErrUnsupported, err)
+			}
+			if _, err = backend.UploadLink(doc.URL); !errors.Is(err, rag.ErrUnsupported) {
+				t.Errorf("expected %v, got %v", rag.ErrUnsupported, err)
+			}
+			if err = backend.Attach(text); err != nil {
+				t.Fatal(err)
+			}
+
+			if err = backend.Delete(text); err != nil {
+				t.Fatal(err)
+			}
+			if len(f.chunks(text.ID)) != 0 || backend.Seen(doc.URL) {
+				t.Error("expected the document to be removed")
+			}
+
+			doc.URL, doc.Title = doc.URL+"-denied", "Access Denied"
+			if _, err = backend.UploadText(doc); !errors.Is(err, rag.ErrAccessDenied) {
+				t.Errorf("expected %v, got %v", rag.ErrAccessDenied, err)
+			}
+		})
+	}
+}
+
+func TestBackend_WithExtractor(t *testing.T) {
+	f := newFakeVectors()
+	embeddings := fakeEmbeddings(t, nil)
+	backend := NewBackend(fakeQdrant(t, f), NewEmbedder(embeddings.URL+"/v1/", ""), "stargate").
+		WithExtractor(func(name string, data []byte) (string, error) {
+			return "extracted from " + name, nil
+		})
+	if err := backend.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	doc, err := backend.UploadFile("https://www.cia.gov/readingroom/docs/doc-1.pdf", "doc-1.pdf", []byte("%PDF-1.4"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if chunks := f.chunks(doc.ID); len(chunks) != 1 || chunks[0] != "extracted from doc-1.pdf" {
+		t.Errorf("unexpected chunks: %q", chunks)
+	}
+}
+
+func TestQdrant_DimensionMismatch(t *testing.T) {
+	f := newFakeVectors()
+	f.exists, f.dim = true, 768
+	embeddings := fakeEmbeddings(t, nil)
+	err := NewBackend(fakeQdrant(t, f), NewEmbedder(embeddings.URL+"/v1/", ""), "stargate").Validate()
+	if err == nil || !strings.Contains(err.Error(), "size 768") {
+		t.Errorf("expected a dimension mismatch, got %v", err)
+	}
+}
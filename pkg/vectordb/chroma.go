@@ -0,0 +1,128 @@
+package vectordb
+
+import (
+	"net/http"
+	"net/url"
+	"sync"
+)
+
+const DefaultChromaEndpoint = "http://localhost:8000/"
+
+// Chroma keeps points in a Chroma collection through its v1 REST API.
+type Chroma struct {
+	client
+	ids map[string]string
+	mu  sync.Mutex
+}
+
+var _ Store = (*Chroma)(nil)
+
+func NewChroma(endpoint string) *Chroma {
+	if endpoint == "" {
+		endpoint = DefaultChromaEndpoint
+	}
+	return &Chroma{client: newClient(endpoint, "X-Chroma-Token"), ids: make(map[string]string)}
+}
+
+func (c *Chroma) WithAPIKey(key string) *Chroma {
+	c.apiKey = key
+	return c
+}
+
+func (c *Chroma) Name() string {
+	return "chroma"
+}
+
+// collectionID returns the ID Chroma addresses collection by, creating the collection if need be.
+func (c *Chroma) collectionID(collection string) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if id, ok := c.ids[collection]; ok {
+		return id, nil
+	}
+	info := struct {
+		ID string `json:"id"`
+	}{}
+	_, err := c.do(http.MethodPost, "api/v1/collections", map[string]interface{}{
+		"name":          collection,
+		"metadata":      map[string]string{"hnsw:space": "cosine"},
+		"get_or_create": true,
+	}, &info)
+	if err != nil {
+		return "", err
+	}
+	c.ids[collection] = info.ID
+	return info.ID, nil
+}
+
+// Ensure creates the collection. Chroma takes the vector size from the first points added.
+func (c *Chroma) Ensure(collection string, _ int) error {
+	_, err := c.collectionID(collection)
+	return err
+}
+
+func (c *Chroma) Upsert(collection string, points []Point) error {
+	id, err := c.collectionID(collection)
+	if err != nil {
+		return err
+	}
+	req := struct {
+		IDs        []string                 `json:"ids"`
+		Embeddings [][]float32              `json:"embeddings"`
+		Documents  []string                 `json:"documents"`
+		Metadatas  []map[string]interface{} `json:"metadatas"`
+	}{}
+	for _, p := range points {
+		req.IDs = append(req.IDs, p.ID)
+		req.Embeddings = append(req.Embeddings, p.Vector)
+		req.Documents = append(req.Documents, p.Payload.Text)
+		req.Metadatas = append(req.Metadatas, p.Payload.flat())
+	}
+	_, err = c.do(http.MethodPost, "api/v1/collections/"+url.PathEscape(id)+"/upsert", &req, nil)
+	return err
+}
+
+func (c *Chroma) Delete(collection string, docID string) error {
+	id, err := c.collectionID(collection)
+	if err != nil {
+		return err
+	}
+	_, err = c.do(http.MethodPost, "api/v1/collections/"+url.PathEscape(id)+"/delete", map[string]interface{}{
+		"where": map[string]string{"doc_id": docID},
+	}, nil)
+	return err
+}
+
+func (c *Chroma) Documents(collection string) (map[string]string, error) {
+	id, err := c.collectionID(collection)
+	if err != nil {
+		return nil, err
+	}
+	const limit = 1000
+	docs := make(map[string]string)
+	for offset := 0; ; offset += limit {
+		page := struct {
+			IDs       []string `json:"ids"`
+			Metadatas []struct {
+				DocID string `json:"doc_id"`
+				URL   string `json:"url"`
+			} `json:"metadatas"`
+		}{}
+		_, err = c.do(http.MethodPost, "api/v1/collections/"+url.PathEscape(id)+"/get", map[string]interface{}{
+			"limit":   limit,
+			"offset":  offset,
+			"include": []string{"metadatas"},
+		}, &page)
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range page.Metadatas {
+			if m.URL != "" {
+				docs[m.URL] = m.DocID
+			}
+		}
+		if len(page.IDs) < limit {
+			return docs, nil
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package vectordb
+
+import (
+	"strings"
+	"unicode"
+)
+
+const (
+	DefaultChunkSize    = 1000
+	DefaultChunkOverlap = 200
+)
+
+// Chunk splits text into pieces of at most size runes, each starting overlap runes before the end of the
+// previous one. Pieces are cut at whitespace where possible and runs of whitespace are collapsed.
+func Chunk(text string, size, overlap int) []string {
+	if size <= 0 {
+		size = DefaultChunkSize
+	}
+	if overlap < 0 || overlap >= size {
+		overlap = size / 5
+	}
+
+	runes := []rune(strings.Join(strings.Fields(text), " "))
+	var chunks []string
+	for start := 0; start < len(runes); {
+		end := min(start+size, len(runes))
+		if end < len(runes) {
+			// cut at the last space of the second half of the chunk, if any
+			for i := end; i > start+size/2; i-- {
+				if unicode.IsSpace(runes[i]) {
+					end = i
+					break
+				}
+			}
+		}
+		if chunk := strings.TrimSpace(string(runes[start:end])); chunk != "" {
+			chunks = append(chunks, chunk)
+		}
+		if end == len(runes) {
+			break
+		}
+
+		next := end - overlap
+		// start the overlap at a word boundary
+		for next > start && next < end && !unicode.IsSpace(runes[next-1]) {
+			next++
+		}
+		if next <= start || next >= end {
+			next = end
+		}
+		start = next
+	}
+	return chunks
+}
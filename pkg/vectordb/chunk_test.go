@@ -0,0 +1,46 @@
+package vectordb
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestChunk(t *testing.T) {
+	words := make([]string, 0, 300)
+	for i := 0; i < 300; i++ {
+		words = append(words, "stargate")
+	}
+	text := strings.Join(words, " \n\t")
+
+	chunks := Chunk(text, 100, 20)
+	if len(chunks) < 2 {
+		t.Fatalf("expected several chunks, got %d", len(chunks))
+	}
+	for i, chunk := range chunks {
+		if n := len([]rune(chunk)); n > 100 {
+			t.Errorf("chunk %d is %d runes long", i, n)
+		}
+		if strings.HasPrefix(chunk, " ") || strings.HasSuffix(chunk, " ") || strings.Contains(chunk, "  ") {
+			t.Errorf("chunk %d has stray whitespace: %q", i, chunk)
+		}
+		for _, word := range strings.Fields(chunk) {
+			if word != "stargate" {
+				t.Fatalf("chunk %d cuts a word: %q", i, chunk)
+			}
+		}
+	}
+	if !strings.HasPrefix(chunks[1], "stargate") || len(strings.Join(chunks, " ")) <= len(strings.Join(strings.Fields(text), " ")) {
+		t.Error("expected consecutive chunks to overlap")
+	}
+
+	if chunks = Chunk("  \n ", 100, 20); len(chunks) != 0 {
+		t.Errorf("expected no chunks of blank text, got %q", chunks)
+	}
+	if chunks = Chunk("TASK FORCE", 100, 20); len(chunks) != 1 || chunks[0] != "TASK FORCE" {
+		t.Errorf("unexpected chunks of short text: %q", chunks)
+	}
+	// a single word longer than a chunk still makes progress
+	if chunks = Chunk(strings.Repeat("x", 250), 100, 20); len(chunks) != 3 {
+		t.Errorf("expected 3 chunks, got %d", len(chunks))
+	}
+}
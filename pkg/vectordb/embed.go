@@ -0,0 +1,128 @@
+package vectordb
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	http2 "ciascrape/pkg/http"
+
+	"ciascrape/pkg/mu"
+)
+
+const (
+	DefaultEmbeddingsEndpoint = "http://localhost:11434/v1/"
+	DefaultEmbeddingsModel    = "nomic-embed-text"
+
+	embedBatchSize = 64
+)
+
+var ErrEmbeddings = errors.New("embeddings request failed")
+
+// Embedder turns text into vectors through an OpenAI-compatible /v1/embeddings endpoint,
+// e.g. a local Ollama or llama.cpp server.
+type Embedder struct {
+	Endpoint string
+	Model    string
+	APIKey   string
+}
+
+func NewEmbedder(endpoint, model string) *Embedder {
+	if endpoint == "" {
+		endpoint = DefaultEmbeddingsEndpoint
+	}
+	if !strings.HasSuffix(endpoint, "/") {
+		endpoint += "/"
+	}
+	if model == "" {
+		model = DefaultEmbeddingsModel
+	}
+	return &Embedder{Endpoint: endpoint, Model: model}
+}
+
+func (e *Embedder) WithAPIKey(key string) *Embedder {
+	e.APIKey = strings.TrimSpace(key)
+	return e
+}
+
+type embeddingsRequest struct {
+	Model string   `json:"model"`
+	Input []string `json:"input"`
+}
+
+type embeddingsResponse struct {
+	Data []struct {
+		Index     int       `json:"index"`
+		Embedding []float32 `json:"embedding"`
+	} `json:"data"`
+	Error *struct {
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// Embed returns the vectors of texts, in order.
+func (e *Embedder) Embed(texts []string) ([][]float32, error) {
+	vectors := make([][]float32, 0, len(texts))
+	for start := 0; start < len(texts); start += embedBatchSize {
+		batch, err := e.embed(texts[start:min(start+embedBatchSize, len(texts))])
+		if err != nil {
+			return nil, err
+		}
+		vectors = append(vectors, batch...)
+	}
+	return vectors, nil
+}
+
+func (e *Embedder) embed(texts []string) ([][]float32, error) {
+	dat, err := json.Marshal(&embeddingsRequest{Model: e.Model, Input: texts})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(http.MethodPost, e.Endpoint+"embeddings", bytes.NewReader(dat))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if e.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+e.APIKey)
+	}
+
+	mu.GetMutex("net").RLock()
+	res, err := http2.DefaultClient.Do(req)
+	mu.GetMutex("net").RUnlock()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrEmbeddings, err)
+	}
+	data, err := io.ReadAll(res.Body)
+	_ = res.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrEmbeddings, err)
+	}
+
+	er := &embeddingsResponse{}
+	if err = json.Unmarshal(data, er); err != nil && res.StatusCode == http.StatusOK {
+		return nil, fmt.Errorf("%w: failed to unmarshal response: %v", ErrEmbeddings, err)
+	}
+	if er.Error != nil {
+		return nil, fmt.Errorf("%w: %s", ErrEmbeddings, er.Error.Message)
+	}
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%w: bad status code: %s", ErrEmbeddings, res.Status)
+	}
+	if len(er.Data) != len(texts) {
+		return nil, fmt.Errorf("%w: got %d embeddings for %d inputs", ErrEmbeddings, len(er.Data), len(texts))
+	}
+
+	vectors := make([][]float32, len(texts))
+	for _, d := range er.Data {
+		if d.Index < 0 || d.Index >= len(texts) {
+			return nil, fmt.Errorf("%w: embedding index %d out of range", ErrEmbeddings, d.Index)
+		}
+		vectors[d.Index] = d.Embedding
+	}
+	return vectors, nil
+}
@@ -0,0 +1,70 @@
+package vectordb
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// fakeEmbeddings is an OpenAI-compatible embeddings endpoint handing out vectors of size 3,
+// derived from the length of each input. It answers in reverse order, as the API allows.
+func fakeEmbeddings(t *testing.T, requests *int) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/embeddings" || r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		req := embeddingsRequest{}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Model != "nomic-embed-text" {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"error": {"message": "model not found"}}`))
+			return
+		}
+		if requests != nil {
+			*requests++
+		}
+		res := embeddingsResponse{}
+		for i := len(req.Input) - 1; i >= 0; i-- {
+			res.Data = append(res.Data, struct {
+				Index     int       `json:"index"`
+				Embedding []float32 `json:"embedding"`
+			}{i, []float32{float32(len(req.Input[i])), 1, 0}})
+		}
+		_ = json.NewEncoder(w).Encode(res)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestEmbedder_Embed(t *testing.T) {
+	requests := 0
+	server := fakeEmbeddings(t, &requests)
+
+	texts := make([]string, embedBatchSize+2)
+	for i := range texts {
+		texts[i] = string(make([]byte, i))
+	}
+	vectors, err := NewEmbedder(server.URL+"/v1", "").Embed(texts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if requests != 2 {
+		t.Errorf("expected the inputs to be sent in 2 batches, got %d", requests)
+	}
+	if len(vectors) != len(texts) {
+		t.Fatalf("expected %d vectors, got %d", len(texts), len(vectors))
+	}
+	for i, v := range vectors {
+		if len(v) != 3 || v[0] != float32(i) {
+			t.Fatalf("vector %d out of order: %v", i, v)
+		}
+	}
+
+	_, err = NewEmbedder(server.URL+"/v1/", "text-embedding-3-small").Embed([]string{"TASK FORCE"})
+	if !errors.Is(err, ErrEmbeddings) || err.Error() != "embeddings request failed: model not found" {
+		t.Errorf("expected the endpoint's error, got %v", err)
+	}
+}
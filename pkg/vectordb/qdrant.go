@@ -0,0 +1,134 @@
+package vectordb
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+const DefaultQdrantEndpoint = "http://localhost:6333/"
+
+// Qdrant keeps points in a Qdrant collection through its REST API.
+type Qdrant struct {
+	client
+}
+
+var _ Store = (*Qdrant)(nil)
+
+func NewQdrant(endpoint string) *Qdrant {
+	if endpoint == "" {
+		endpoint = DefaultQdrantEndpoint
+	}
+	return &Qdrant{client: newClient(endpoint, "api-key")}
+}
+
+func (q *Qdrant) WithAPIKey(key string) *Qdrant {
+	q.apiKey = key
+	return q
+}
+
+func (q *Qdrant) Name() string {
+	return "qdrant"
+}
+
+func (q *Qdrant) Ensure(collection string, dim int) error {
+	info := struct {
+		Result struct {
+			Config struct {
+				Params struct {
+					Vectors struct {
+						Size int `json:"size"`
+					} `json:"vectors"`
+				} `json:"params"`
+			} `json:"config"`
+		} `json:"result"`
+	}{}
+	status, err := q.do(http.MethodGet, "collections/"+url.PathEscape(collection), nil, &info)
+	if err == nil {
+		if size := info.Result.Config.Params.Vectors.Size; size != 0 && size != dim {
+			return fmt.Errorf("qdrant collection '%s' holds vectors of size %d, the embeddings model makes %d", collection, size, dim)
+		}
+		return nil
+	}
+	if status != http.StatusNotFound {
+		return err
+	}
+
+	_, err = q.do(http.MethodPut, "collections/"+url.PathEscape(collection), map[string]interface{}{
+		"vectors": map[string]interface{}{"size": dim, "distance": "Cosine"},
+	}, nil)
+	return err
+}
+
+type qdrantPoint struct {
+	ID      string    `json:"id"`
+	Vector  []float32 `json:"vector"`
+	Payload Payload   `json:"payload"`
+}
+
+func (q *Qdrant) Upsert(collection string, points []Point) error {
+	qp := make([]qdrantPoint, 0, len(points))
+	for _, p := range points {
+		qp = append(qp, qdrantPoint{ID: p.ID, Vector: p.Vector, Payload: p.Payload})
+	}
+	_, err := q.do(http.MethodPut, "collections/"+url.PathEscape(collection)+"/points?wait=true",
+		map[string]interface{}{"points": qp}, nil)
+	return err
+}
+
+func docFilter(docID string) map[string]interface{} {
+	return map[string]interface{}{
+		"must": []interface{}{
+			map[string]interface{}{"key": "doc_id", "match": map[string]interface{}{"value": docID}},
+		},
+	}
+}
+
+func (q *Qdrant) Delete(collection string, docID string) error {
+	_, err := q.do(http.MethodPost, "collections/"+url.PathEscape(collection)+"/points/delete?wait=true",
+		map[string]interface{}{"filter": docFilter(docID)}, nil)
+	return err
+}
+
+func (q *Qdrant) Documents(collection string) (map[string]string, error) {
+	docs := make(map[string]string)
+	var offset interface{}
+	for {
+		page := struct {
+			Result struct {
+				Points []struct {
+					Payload Payload `json:"payload"`
+				} `json:"points"`
+				NextPageOffset interface{} `json:"next_page_offset"`
+			} `json:"result"`
+		}{}
+		req := map[string]interface{}{
+			"limit":        1000,
+			"with_payload": []string{"doc_id", "url"},
+			"with_vector":  false,
+		}
+		if offset != nil {
+			req["offset"] = offset
+		}
+		status, err := q.do(http.MethodPost, "collections/"+url.PathEscape(collection)+"/points/scroll", req, &page)
+		if status == http.StatusNotFound {
+			return docs, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range page.Result.Points {
+			if p.Payload.URL != "" {
+				docs[p.Payload.URL] = p.Payload.DocID
+			}
+		}
+		if page.Result.NextPageOffset == nil {
+			return docs, nil
+		}
+		if fmt.Sprint(offset) == fmt.Sprint(page.Result.NextPageOffset) {
+			return nil, errors.New("qdrant scroll is not advancing")
+		}
+		offset = page.Result.NextPageOffset
+	}
+}
@@ -0,0 +1,134 @@
+// Package vectordb stores the scraped documents straight in a vector database, chunking and embedding them locally.
+package vectordb
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	http2 "ciascrape/pkg/http"
+
+	"ciascrape/pkg/mu"
+)
+
+// Point is an embedded chunk of a document.
+type Point struct {
+	ID      string
+	Vector  []float32
+	Payload Payload
+}
+
+// Payload is what is stored with each chunk: the chunk text and the CREST metadata of its document.
+type Payload struct {
+	DocID          string            `json:"doc_id"`
+	URL            string            `json:"url"`
+	Title          string            `json:"title,omitempty"`
+	Source         string            `json:"source,omitempty"`
+	DocumentNumber string            `json:"document_number,omitempty"`
+	DocumentType   string            `json:"document_type,omitempty"`
+	Collection     string            `json:"collection,omitempty"`
+	Published      string            `json:"published,omitempty"`
+	Classification string            `json:"classification,omitempty"`
+	Fields         map[string]string `json:"fields,omitempty"`
+	Chunk          int               `json:"chunk"`
+	Text           string            `json:"text"`
+}
+
+// flat returns the payload as a map of scalars, for stores that don't take nested metadata.
+func (p Payload) flat() map[string]interface{} {
+	m := map[string]interface{}{
+		"doc_id": p.DocID,
+		"url":    p.URL,
+		"chunk":  p.Chunk,
+	}
+	for key, value := range map[string]string{
+		"title":           p.Title,
+		"source":          p.Source,
+		"document_number": p.DocumentNumber,
+		"document_type":   p.DocumentType,
+		"collection":      p.Collection,
+		"published":       p.Published,
+		"classification":  p.Classification,
+	} {
+		if value != "" {
+			m[key] = value
+		}
+	}
+	return m
+}
+
+// Store is a vector database the points of a collection are kept in.
+type Store interface {
+	Name() string
+	// Ensure creates the collection for vectors of size dim if it does not exist yet.
+	Ensure(collection string, dim int) error
+	Upsert(collection string, points []Point) error
+	// Delete removes the points of the document docID.
+	Delete(collection string, docID string) error
+	// Documents returns the URL of every document in the collection, mapped to its ID.
+	Documents(collection string) (map[string]string, error)
+}
+
+// uuidFor derives a stable UUID from s, so re-uploading a document overwrites its points.
+func uuidFor(s string) string {
+	sum := sha1.Sum([]byte(s))
+	sum[6] = sum[6]&0x0f | 0x50
+	sum[8] = sum[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", sum[0:4], sum[4:6], sum[6:8], sum[8:10], sum[10:16])
+}
+
+// client is the REST plumbing shared by the stores.
+type client struct {
+	endpoint string
+	header   string
+	apiKey   string
+}
+
+func newClient(endpoint, header string) client {
+	return client{endpoint: strings.TrimSuffix(endpoint, "/") + "/", header: header}
+}
+
+// do sends v as JSON and unmarshals a 2xx response into out, if not nil. It returns the status code.
+func (c client) do(method, endpoint string, v, out interface{}) (int, error) {
+	var body io.Reader
+	if v != nil {
+		dat, err := json.Marshal(v)
+		if err != nil {
+			return 0, err
+		}
+		body = bytes.NewReader(dat)
+	}
+	req, err := http.NewRequest(method, c.endpoint+endpoint, body)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.apiKey != "" {
+		req.Header.Set(c.header, c.apiKey)
+	}
+
+	mu.GetMutex("net").RLock()
+	res, err := http2.DefaultClient.Do(req)
+	mu.GetMutex("net").RUnlock()
+	if err != nil {
+		return 0, err
+	}
+	data, err := io.ReadAll(res.Body)
+	_ = res.Body.Close()
+	if err != nil {
+		return res.StatusCode, fmt.Errorf("failed to read response: %w", err)
+	}
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return res.StatusCode, fmt.Errorf("%s %s: bad status code: %s: %s", method, endpoint, res.Status, bytes.TrimSpace(data))
+	}
+	if out != nil {
+		if err = json.Unmarshal(data, out); err != nil {
+			return res.StatusCode, fmt.Errorf("failed to unmarshal response: %w", err)
+		}
+	}
+	return res.StatusCode, nil
+}